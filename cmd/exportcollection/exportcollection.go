@@ -0,0 +1,171 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/freetaxii/libstix2/datastore"
+	"github.com/freetaxii/libstix2/datastore/sqlite3"
+	"github.com/freetaxii/server/internal/config"
+	"github.com/freetaxii/server/internal/export"
+	"github.com/gologme/log"
+	"github.com/pborman/getopt"
+)
+
+// These global variables hold build information. The Build variable will be
+// populated by the Makefile and uses the Git Head hash as its identifier.
+// These variables are used in the console output for --version and --help.
+var (
+	Version = "0.3.1"
+	Build   string
+)
+
+// These global variables are for dealing with command line options
+var (
+	defaultServerConfigFilename = "../etc/freetaxii.conf"
+	sOptServerConfigFilename    = getopt.StringLong("config", 'c', defaultServerConfigFilename, "System Configuration File", "string")
+	sOptCollection              = getopt.StringLong("collection", 'l', "", "Collection resource ID or collection ID to export (default all)", "string")
+	sOptOutputDir               = getopt.StringLong("output", 'o', ".", "Directory to write the bundles to", "string")
+	iOptBundleSize              = getopt.IntLong("size", 's', 0, "Maximum number of objects per bundle (default one bundle per collection)", "int")
+	iOptPageSize                = getopt.IntLong("page", 'p', export.DefaultPageSize, "Number of records to read from the datastore at a time", "int")
+	bOptHelp                    = getopt.BoolLong("help", 0, "Help")
+	bOptVer                     = getopt.BoolLong("version", 0, "Version")
+)
+
+func main() {
+	processCommandLineFlags()
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	logger.EnableLevel("info")
+	logger.EnableLevel("warn")
+
+	// --------------------------------------------------
+	// Load System and Server Configuration
+	// --------------------------------------------------
+	config, err := config.New(logger, *sOptServerConfigFilename)
+	if err != nil {
+		logger.Fatalln(err)
+	}
+
+	// --------------------------------------------------
+	// Setup Database Connection
+	// --------------------------------------------------
+	var ds datastore.Datastorer
+	switch config.Global.DbType {
+	case "sqlite3":
+		databaseFilename := config.Path(config.Global.DbFile)
+		ds = sqlite3.New(logger, databaseFilename, config.CollectionResourceMap())
+	default:
+		logger.Fatalln("ERROR: unknown database type, or no database type defined in the server global configuration")
+	}
+	defer ds.Close()
+
+	if err := os.MkdirAll(*sOptOutputDir, 0755); err != nil {
+		logger.Fatalln("ERROR: unable to create output directory", *sOptOutputDir, err)
+	}
+
+	// --------------------------------------------------
+	// Export Collections
+	// --------------------------------------------------
+	// Sort the resource IDs so the output is the same from run to run
+	var resourceIDs []string
+	for key, c := range config.CollectionResources {
+		if *sOptCollection == "" || *sOptCollection == key || *sOptCollection == c.ID {
+			resourceIDs = append(resourceIDs, key)
+		}
+	}
+	sort.Strings(resourceIDs)
+
+	if len(resourceIDs) == 0 {
+		logger.Fatalln("ERROR: no collection matching", *sOptCollection, "was found in the configuration file")
+	}
+
+	x := export.New(logger, ds)
+	x.PageSize = *iOptPageSize
+	x.BundleSize = *iOptBundleSize
+
+	failed := 0
+	for _, key := range resourceIDs {
+		collectionID := config.CollectionResources[key].ID
+		fileCounter := 0
+
+		write := func(b *export.Bundle) error {
+			fileCounter++
+			filename := filepath.Join(*sOptOutputDir, fmt.Sprintf("%s-%04d.json", collectionID, fileCounter))
+			return writeBundle(filename, b)
+		}
+
+		total, err := x.Export(collectionID, write)
+		if err != nil {
+			logger.Errorln("ERROR: export of collection", key, "(", collectionID, ") failed after", total, "objects:", err)
+			failed++
+			continue
+		}
+		logger.Infoln("INFO: Exported", total, "objects from collection", key, "(", collectionID, ") in", fileCounter, "bundle(s)")
+	}
+
+	if failed > 0 {
+		logger.Fatalln("ERROR:", failed, "collection(s) could not be exported")
+	}
+}
+
+// --------------------------------------------------
+// Private functions
+// --------------------------------------------------
+
+// writeBundle - This function will write a single bundle to a file
+func writeBundle(filename string, b *export.Bundle) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	j := json.NewEncoder(f)
+	j.SetIndent("", "    ")
+	return j.Encode(b)
+}
+
+// processCommandLineFlags - This function will process the command line flags
+// and will print the version or help information as needed.
+func processCommandLineFlags() {
+	getopt.HelpColumn = 35
+	getopt.DisplayWidth = 120
+	getopt.SetParameters("")
+	getopt.Parse()
+
+	// Lets check to see if the version command line flag was given. If it is
+	// lets print out the version infomration and exit.
+	if *bOptVer {
+		printOutputHeader()
+		os.Exit(0)
+	}
+
+	// Lets check to see if the help command line flag was given. If it is lets
+	// print out the help information and exit.
+	if *bOptHelp {
+		printOutputHeader()
+		getopt.Usage()
+		os.Exit(0)
+	}
+}
+
+// printOutputHeader - This function will print a header for all console output
+func printOutputHeader() {
+	fmt.Println("")
+	fmt.Println("FreeTAXII - Collection Export")
+	fmt.Println("Copyright: Bret Jordan")
+	fmt.Println("Version:", Version)
+	if Build != "" {
+		fmt.Println("Build:", Build)
+	}
+	fmt.Println("")
+}
@@ -7,15 +7,32 @@ package main
 
 import (
 	"crypto/tls"
+	"expvar"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/freetaxii/libstix2/datastore"
 	"github.com/freetaxii/libstix2/datastore/sqlite3"
 	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/server/internal/compress"
 	"github.com/freetaxii/server/internal/config"
+	"github.com/freetaxii/server/internal/feeds"
+	"github.com/freetaxii/server/internal/graph"
 	"github.com/freetaxii/server/internal/handlers"
+	"github.com/freetaxii/server/internal/headers"
+	"github.com/freetaxii/server/internal/ingest"
+	"github.com/freetaxii/server/internal/markings"
+	"github.com/freetaxii/server/internal/retention"
+	"github.com/freetaxii/server/internal/search"
+	"github.com/freetaxii/server/internal/stream"
+	"github.com/freetaxii/server/internal/templates"
+	"github.com/freetaxii/server/internal/tlsconfig"
+	"github.com/freetaxii/server/internal/webhooks"
 	"github.com/gologme/log"
 	"github.com/gorilla/mux"
 	"github.com/pborman/getopt"
@@ -83,7 +100,7 @@ func main() {
 
 	// Only enable logging to a file if it is turned on in the configuration file
 	if config.Logging.Enabled == true {
-		logFile, err := os.OpenFile(config.Logging.LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+		logFile, err := os.OpenFile(config.Path(config.Logging.LogFile), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 		if err != nil {
 			logger.Fatalf("ERROR: can not open file: %v", err)
 		}
@@ -91,19 +108,97 @@ func main() {
 		logger.SetOutput(logFile)
 	}
 
+	// --------------------------------------------------
+	// Setup HTML Templates
+	// --------------------------------------------------
+	// The templates are parsed once here, after the configuration has been
+	// verified, so that a broken template stops the server from starting
+	// instead of failing the first request that uses it.
+	htmlTemplates := templates.New(logger)
+	htmlTemplates.DevMode = config.HTML.DevMode
+	if err := htmlTemplates.Load(config.HTMLTemplateFiles()...); err != nil {
+		logger.Fatalln("ERROR: Unable to parse the HTML templates:", err)
+	}
+
 	// --------------------------------------------------
 	// Setup Database Connection
 	// --------------------------------------------------
 	var ds datastore.Datastorer
+	var purger retention.Purger
+	var index search.Index
+	var edges graph.Index
+	var versions ingest.VersionFinder
 	switch config.Global.DbType {
 	case "sqlite3":
-		databaseFilename := config.Global.Prefix + config.Global.DbFile
-		ds = sqlite3.New(logger, databaseFilename, config.CollectionResources)
+		databaseFilename := config.Path(config.Global.DbFile)
+		store := sqlite3.New(logger, databaseFilename, config.CollectionResourceMap())
+		purger = retention.NewSQLitePurger(store.DB)
+		versions = ingest.NewSQLiteFinder(store.DB)
+		ds = store
+
+		// The search index needs the sqlite3 driver to be built with FTS5
+		if config.Search.Enabled == true {
+			sqliteIndex, err := search.NewSQLiteIndex(store.DB)
+			if err != nil {
+				logger.Fatalln("ERROR: Unable to create the search index, is the server built with the sqlite_fts5 tag:", err)
+			}
+			index = sqliteIndex
+		}
+
+		// The graph follows the relationships and sightings that refer to
+		// an object from this index
+		edgeIndex, err := graph.NewSQLiteIndex(store.DB)
+		if err != nil {
+			logger.Fatalln("ERROR: Unable to create the graph index:", err)
+		}
+		edges = edgeIndex
 	default:
 		logger.Fatalln("ERROR: unknown database type, or no database type defined in the server global configuration")
 	}
 	defer ds.Close()
 
+	// --------------------------------------------------
+	// Setup Notifications
+	// --------------------------------------------------
+	// Every object that is added to a collection wakes up the live streams of
+	// that collection and, if any are enabled, is sent to its webhooks.
+	hub := stream.NewHub()
+	notifiers := ingest.Notifiers{hub}
+
+	// Objects are added to the search index as they are added to a collection,
+	// and the objects that are already in the datastore are added in the
+	// background, so that the objects added before search was enabled are found
+	if index != nil {
+		notifiers = append(notifiers, search.NewIndexer(logger, index))
+		go func() {
+			n := search.Rebuild(logger, index, ds, config.CollectionIDs())
+			logger.Infoln("INFO: Added", n, "objects in the datastore to the search index")
+		}()
+	}
+
+	// The relationships and sightings are added to the graph index the same way
+	notifiers = append(notifiers, graph.NewIndexer(logger, edges))
+	go func() {
+		n := graph.Rebuild(logger, edges, ds, config.CollectionIDs())
+		logger.Infoln("INFO: Added", n, "relationships and sightings in the datastore to the graph index")
+	}()
+
+	var dispatcher *webhooks.Dispatcher
+	if config.WebhooksEnabled() == true {
+		var deadLetter io.Writer
+		if config.Webhooks.DeadLetterFile != "" {
+			deadLetterFile, err := os.OpenFile(config.Path(config.Webhooks.DeadLetterFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+			if err != nil {
+				logger.Fatalf("ERROR: can not open file: %v", err)
+			}
+			defer deadLetterFile.Close()
+			deadLetter = deadLetterFile
+		}
+		dispatcher = webhooks.New(logger, config, deadLetter)
+		notifiers = append(notifiers, dispatcher)
+	}
+	var notifier ingest.Notifier = notifiers
+
 	// --------------------------------------------------
 	//
 	// Configure HTTP Router
@@ -113,6 +208,24 @@ func main() {
 	router := mux.NewRouter()
 	config.Router = router
 
+	// Publish the server metrics, if a path for them is defined
+	if config.Global.MetricsPath != "" {
+		logger.Infoln("Starting metrics service at:", config.Global.MetricsPath)
+		router.Handle(config.Global.MetricsPath, expvar.Handler()).Methods("GET")
+	}
+
+	// The CSS and JavaScript files that the built in HTML templates use
+	if config.HTML.Enabled.Value == true {
+		logger.Infoln("Starting HTML assets service at:", templates.AssetsPath)
+		router.PathPrefix(templates.AssetsPath).Handler(templates.Assets()).Methods("GET")
+	}
+
+	// Requests for paths that are not served get a TAXII error, which is shown
+	// with the HTML error template when a browser asks for HTML
+	errorSrv, _ := handlers.NewErrorHandler(logger, config.HTML.HTMLConfig)
+	errorSrv.Templates = htmlTemplates
+	router.NotFoundHandler = http.HandlerFunc(errorSrv.NotFoundHandler)
+
 	// --------------------------------------------------
 	//
 	// Start Server
@@ -137,6 +250,11 @@ func main() {
 
 				// Configuration for this specific instance and its resource
 				ts, _ := handlers.NewDiscoveryHandler(logger, s, config.DiscoveryResources[s.ResourceID])
+				ts.Templates = htmlTemplates
+
+				// The discovery resource is the same in TAXII 2.0, so it is
+				// offered to TAXII 2.0 clients when any API root serves them.
+				ts.TAXII20 = config.TAXII20Enabled()
 
 				logger.Infoln("Starting TAXII GET Discovery service at:", s.Path)
 				router.HandleFunc(s.Path, ts.DiscoveryHandler).Methods("GET")
@@ -161,6 +279,7 @@ func main() {
 
 				logger.Infoln("Starting TAXII GET API Root service at:", api.Path)
 				ts, _ := handlers.NewAPIRootHandler(logger, api, config.APIRootResources[api.ResourceID])
+				ts.Templates = htmlTemplates
 				router.HandleFunc(api.Path, ts.APIRootHandler).Methods("GET")
 				serviceCounter++
 
@@ -174,7 +293,7 @@ func main() {
 					// copy called colResources and set the CanRead to true
 					for _, c := range api.Collections.ReadAccess {
 						if _, found := colResources[c]; !found {
-							a := config.CollectionResources[c]
+							a := config.CollectionResources[c].Collection
 							colResources[c] = &a
 							colResources[c].CanRead = true
 						}
@@ -185,7 +304,7 @@ func main() {
 					// CanWrite to true
 					for _, c := range api.Collections.WriteAccess {
 						if _, found := colResources[c]; !found {
-							a := config.CollectionResources[c]
+							a := config.CollectionResources[c].Collection
 							colResources[c] = &a
 						}
 						colResources[c].CanWrite = true
@@ -207,12 +326,31 @@ func main() {
 					// Example: /api1/collections/
 					// --------------------------------------------------
 					collectionsSrv, _ := handlers.NewCollectionsHandler(logger, api, *collections, config.Global.ServerRecordLimit)
+					collectionsSrv.Templates = htmlTemplates
 					logger.Infoln("Starting TAXII GET Collections service of:", collectionsSrv.URLPath)
 					router.HandleFunc(collectionsSrv.URLPath, collectionsSrv.CollectionsHandler).Methods("GET")
 
+					// The collections of this API Root that have read access,
+					// with their data markings, are shared by the search and
+					// graph handlers
+					readCollections := make(map[string]*markings.Policy)
+					for resourceID, collectionResourse := range colResources {
+						if collectionResourse.CanRead == true {
+							readCollections[collectionResourse.ID] = markingPolicy(config.CollectionResources[resourceID])
+						}
+					}
+
 					// Loop through all the collections that we have identified
 					// that should have basic read or write access.
-					for _, collectionResourse := range colResources {
+					for resourceID, collectionResourse := range colResources {
+
+						// Only objects that match the media types of the
+						// collection are accepted and returned
+						specVersions := headers.SpecVersions(collectionResourse.MediaTypes)
+
+						// Only objects with the data markings that are allowed
+						// in the collection are accepted and returned
+						policy := markingPolicy(config.CollectionResources[resourceID])
 
 						// --------------------------------------------------
 						// Start a Collection handler
@@ -220,6 +358,7 @@ func main() {
 						// --------------------------------------------------
 						// We do not need to check to see if the collection is enabled because that was already done
 						collectionSrv, _ := handlers.NewCollectionHandler(logger, api, *collectionResourse, config.Global.ServerRecordLimit)
+						collectionSrv.Templates = htmlTemplates
 						logger.Infoln("Starting TAXII GET Collection service of:", collectionSrv.URLPath)
 						router.HandleFunc(collectionSrv.URLPath, collectionSrv.CollectionHandler).Methods("GET")
 
@@ -229,15 +368,42 @@ func main() {
 						// --------------------------------------------------
 						srvObjects, _ := handlers.NewObjectsHandler(logger, api, collectionResourse.ID, config.Global.ServerRecordLimit)
 						srvObjects.DS = ds
-
+						srvObjects.Templates = htmlTemplates
+						srvObjects.SpecVersions = specVersions
+						srvObjects.Markings = policy
+						srvObjects.Notifier = notifier
+						srvObjects.Versions = versions
+						srvObjects.MaxContentLength = int64(config.APIRootResources[api.ResourceID].MaxContentLength)
+
+						// A client that does not have access to a collection gets a
+						// 403 Forbidden instead of a 404 Not Found
 						if collectionResourse.CanRead == true {
 							logger.Infoln("Starting TAXII GET Object service of:", srvObjects.URLPath)
 							config.Router.HandleFunc(srvObjects.URLPath, srvObjects.STIXContentServerHandler).Methods("GET")
+						} else {
+							config.Router.HandleFunc(srvObjects.URLPath, srvObjects.ForbiddenHandler).Methods("GET")
 						}
 
 						if collectionResourse.CanWrite == true {
 							logger.Infoln("Starting TAXII POST Object service of:", srvObjects.URLPath)
 							config.Router.HandleFunc(srvObjects.URLPath, srvObjects.ObjectsServerWriteHandler).Methods("POST")
+						} else {
+							config.Router.HandleFunc(srvObjects.URLPath, srvObjects.ForbiddenHandler).Methods("POST")
+						}
+
+						// --------------------------------------------------
+						// Start a Stream handler
+						// Example: /api1/collections/9cfa669c-ee94-4ece-afd2-f8edac37d8fd/stream/
+						// --------------------------------------------------
+						srvStream, _ := handlers.NewStreamHandler(logger, api, collectionResourse.ID, config.Global.ServerRecordLimit)
+						srvStream.DS = ds
+						srvStream.SpecVersions = specVersions
+						srvStream.Markings = policy
+						srvStream.Hub = hub
+
+						if collectionResourse.CanRead == true {
+							logger.Infoln("Starting TAXII GET Stream service of:", srvStream.URLPath)
+							config.Router.HandleFunc(srvStream.URLPath, srvStream.StreamHandler).Methods("GET")
 						}
 
 						// --------------------------------------------------
@@ -246,10 +412,15 @@ func main() {
 						// --------------------------------------------------
 						srvObjectsByID, _ := handlers.NewObjectsByIDHandler(logger, api, collectionResourse.ID, config.Global.ServerRecordLimit)
 						srvObjectsByID.DS = ds
+						srvObjectsByID.Templates = htmlTemplates
+						srvObjectsByID.SpecVersions = specVersions
+						srvObjectsByID.Markings = policy
 
 						if collectionResourse.CanRead == true {
 							logger.Infoln("Starting TAXII GET Object by ID service of:", srvObjectsByID.URLPath)
 							config.Router.HandleFunc(srvObjectsByID.URLPath, srvObjectsByID.STIXContentServerHandler).Methods("GET")
+						} else {
+							config.Router.HandleFunc(srvObjectsByID.URLPath, srvObjectsByID.ForbiddenHandler).Methods("GET")
 						}
 
 						// --------------------------------------------------
@@ -258,10 +429,15 @@ func main() {
 						// --------------------------------------------------
 						srvObjectVersions, _ := handlers.NewObjectVersionsHandler(logger, api, collectionResourse.ID, config.Global.ServerRecordLimit)
 						srvObjectVersions.DS = ds
+						srvObjectVersions.Templates = htmlTemplates
+						srvObjectVersions.SpecVersions = specVersions
+						srvObjectVersions.Markings = policy
 
 						if collectionResourse.CanRead == true {
 							logger.Infoln("Starting TAXII GET Object Versions service of:", srvObjectVersions.URLPath)
 							config.Router.HandleFunc(srvObjectVersions.URLPath, srvObjectVersions.STIXContentServerHandler).Methods("GET")
+						} else {
+							config.Router.HandleFunc(srvObjectVersions.URLPath, srvObjectVersions.ForbiddenHandler).Methods("GET")
 						}
 
 						// --------------------------------------------------
@@ -270,13 +446,48 @@ func main() {
 						// --------------------------------------------------
 						srvManifest, _ := handlers.NewManifestHandler(logger, api, collectionResourse.ID, config.Global.ServerRecordLimit)
 						srvManifest.DS = ds
+						srvManifest.Templates = htmlTemplates
+						srvManifest.SpecVersions = specVersions
+						srvManifest.Markings = policy
 
 						if collectionResourse.CanRead == true {
 							logger.Infoln("Starting TAXII GET Manifest service of:", srvManifest.URLPath)
 							config.Router.HandleFunc(srvManifest.URLPath, srvManifest.STIXContentServerHandler).Methods("GET")
+						} else {
+							config.Router.HandleFunc(srvManifest.URLPath, srvManifest.ForbiddenHandler).Methods("GET")
+						}
+
+						// --------------------------------------------------
+						// Start a Graph handler
+						// Example: /api1/collections/9cfa669c-ee94-4ece-afd2-f8edac37d8fd/x-freetaxii/graph/{objectid}/
+						// --------------------------------------------------
+						srvGraph, _ := handlers.NewGraphHandler(logger, api, collectionResourse.ID)
+						srvGraph.DS = ds
+						srvGraph.Markings = policy
+						srvGraph.Edges = edges
+						srvGraph.ReadCollections = readCollections
+
+						if collectionResourse.CanRead == true {
+							logger.Infoln("Starting Graph service of:", srvGraph.URLPath)
+							config.Router.HandleFunc(srvGraph.URLPath, srvGraph.GraphHandler).Methods("GET")
 						}
 
 					} // End for loop api.Collections.ResourceIDs
+
+					// --------------------------------------------------
+					// Start a Search handler
+					// Example: /api1/x-freetaxii/search/
+					// --------------------------------------------------
+					// Search is not part of TAXII. It covers every collection
+					// of this API root that has read access.
+					if index != nil {
+						srvSearch, _ := handlers.NewSearchHandler(logger, api, config.Global.ServerRecordLimit)
+						srvSearch.Index = index
+						srvSearch.ReadCollections = readCollections
+
+						logger.Infoln("Starting Search service of:", srvSearch.URLPath)
+						config.Router.HandleFunc(srvSearch.URLPath, srvSearch.SearchHandler).Methods("GET")
+					}
 				} // End if Collections.Enabled == true
 			} // End if api.Enabled == true
 		} // End for loop API Root Services
@@ -292,41 +503,142 @@ func main() {
 		logger.Fatalln("No TAXII services defined")
 	}
 
+	// --------------------------------------------------
+	//
+	// Start Background Jobs
+	//
+	// --------------------------------------------------
+
+	// The webhook deliveries that have not been sent when the server is
+	// stopped are written to the dead letter log before it exits
+	stopWebhooks := make(chan struct{})
+	webhooksDone := make(chan struct{})
+	if dispatcher != nil {
+		go func() {
+			dispatcher.Run(stopWebhooks)
+			close(webhooksDone)
+		}()
+	} else {
+		close(webhooksDone)
+	}
+
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-shutdown
+		logger.Infoln("INFO: Received", sig, "stopping the server")
+		close(stopWebhooks)
+		<-webhooksDone
+		os.Exit(0)
+	}()
+
+	if config.IngestServer.Enabled == true {
+		for _, s := range config.IngestServer.Services {
+			if s.Enabled == true {
+				collectionID := config.CollectionResources[s.ResourceID].ID
+				in := ingest.New(logger, ds, collectionID)
+				in.Notifier = notifier
+				in.SpecVersions = headers.SpecVersions(config.CollectionResources[s.ResourceID].MediaTypes)
+				in.Versions = versions
+				in.Markings = markingPolicy(config.CollectionResources[s.ResourceID])
+				watcher := ingest.NewWatcher(logger, config.Path(s.Directory), config.IngestServer.IntervalDuration, in)
+				go watcher.Run(nil)
+			}
+		}
+	}
+
+	if config.Feeds.Enabled == true {
+		cursor := feeds.NewFileCursorStore(config.Path(config.Feeds.StateDir))
+		for _, f := range config.Feeds.Services {
+			if f.Enabled == true {
+				collectionID := config.CollectionResources[f.ResourceID].ID
+				in := ingest.New(logger, ds, collectionID)
+				in.Notifier = notifier
+				in.SpecVersions = headers.SpecVersions(config.CollectionResources[f.ResourceID].MediaTypes)
+				in.Versions = versions
+				in.Markings = markingPolicy(config.CollectionResources[f.ResourceID])
+				feed := feeds.New(logger, f, cursor, in)
+				go feed.Run(nil)
+			}
+		}
+	}
+
+	if config.Retention.Enabled == true {
+		retentionJob := retention.New(logger, ds, purger, config)
+		go retentionJob.Run(nil)
+	}
+
 	// --------------------------------------------------
 	//
 	// Listen for Incoming Connections
 	//
 	// --------------------------------------------------
 
+	// --------------------------------------------------
+	// Configure TLS settings
+	// --------------------------------------------------
+	// The versions, cipher suites, and curves come from the tls section
+	// of the configuration file. The certificate and its OCSP response are
+	// loaded again when the server gets a SIGHUP.
+	var tlsConfig *tls.Config
+	var tlsCert *tlsconfig.Certificate
+	if config.Global.Protocol == "https" {
+		tlsConfig = config.TLSConfig()
+
+		ocspFile := ""
+		if config.TLS.OCSPStapleFile != "" {
+			ocspFile = config.TLSPath(config.TLS.OCSPStapleFile)
+		}
+		var err error
+		tlsCert, err = tlsconfig.NewCertificate(config.TLSPath(config.Global.TLSCrt), config.TLSPath(config.Global.TLSKey), ocspFile)
+		if err != nil {
+			logger.Fatalln("ERROR: Unable to load the TLS certificate:", err)
+		}
+		tlsConfig.GetCertificate = tlsCert.GetCertificate
+
+		if config.TLS.SessionTicketRotationDuration > 0 {
+			go tlsconfig.RotateSessionTickets(tlsConfig, config.TLS.SessionTicketRotationDuration, nil)
+		}
+	}
+
+	// Everything that is loaded again when the server gets a SIGHUP is done
+	// here, so there is only one place that receives the signal
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			logger.Infoln("INFO: Received SIGHUP, reloading the HTML templates")
+			htmlTemplates.Reload()
+
+			if tlsCert != nil {
+				logger.Infoln("INFO: Received SIGHUP, reloading the TLS certificate")
+				if err := tlsCert.Load(); err != nil {
+					logger.Errorln("ERROR: Unable to reload the TLS certificate, the previous one is still used:", err)
+				}
+			}
+		}
+	}()
+
 	if config.Global.Protocol == "http" {
 		logger.Infoln("Listening on:", config.Global.Listen)
-		logger.Fatalln(http.ListenAndServe(config.Global.Listen, router))
+		logger.Fatalln(http.ListenAndServe(config.Global.Listen, compress.Handler(router)))
 	} else if config.Global.Protocol == "https" {
-		// --------------------------------------------------
-		// Configure TLS settings
-		// --------------------------------------------------
-		// TODO move TLS elements to configuration file
-		tlsConfig := &tls.Config{
-			MinVersion:               tls.VersionTLS12,
-			CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
-			PreferServerCipherSuites: true,
-			CipherSuites: []uint16{
-				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-				tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
-				tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
-				tls.TLS_RSA_WITH_AES_256_CBC_SHA,
-			},
-		}
 		tlsServer := &http.Server{
 			Addr:         config.Global.Listen,
-			Handler:      router,
-			TLSConfig:    tlsConfig,
+			Handler:      compress.Handler(router),
 			TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler), 0),
 		}
 
-		tlsKeyPath := "etc/tls/" + config.Global.TLSKey
-		tlsCrtPath := "etc/tls/" + config.Global.TLSCrt
-		logger.Fatalln(tlsServer.ListenAndServeTLS(tlsCrtPath, tlsKeyPath))
+		// The listener is made here instead of with ListenAndServeTLS, which
+		// uses a copy of the tls.Config that the rotated session ticket keys
+		// are never set on
+		ln, err := net.Listen("tcp", config.Global.Listen)
+		if err != nil {
+			logger.Fatalln("ERROR: Unable to listen on", config.Global.Listen+":", err)
+		}
+
+		logger.Infoln("Listening on:", config.Global.Listen)
+		logger.Fatalln(tlsServer.Serve(tls.NewListener(ln, tlsConfig)))
 	} else {
 		logger.Fatalln("No valid protocol was defined in the configuration file")
 	} // end if statement
@@ -370,6 +682,17 @@ func processCommandLineFlags() string {
 	return *sOptServerConfigFilename
 }
 
+/*
+markingPolicy - This function will return the data marking policy of a
+collection resource, or nil if the collection does not enforce one.
+*/
+func markingPolicy(r config.CollectionResource) *markings.Policy {
+	if r.Markings.Enabled == false {
+		return nil
+	}
+	return markings.New(r.Markings.Allowed, r.Markings.Default)
+}
+
 /*
 printOutputHeader - This function will print a header for all console output
 */
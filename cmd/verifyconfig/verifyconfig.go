@@ -10,6 +10,7 @@ import (
 	"os"
 
 	"github.com/freetaxii/server/internal/config"
+	"github.com/freetaxii/server/internal/templates"
 	"github.com/gologme/log"
 	"github.com/pborman/getopt"
 )
@@ -41,15 +42,25 @@ func main() {
 	// Define variables
 	// --------------------------------------------------
 
-	_, err := config.New(logger, *sOptServerConfigFilename)
+	c, err := config.New(logger, *sOptServerConfigFilename)
 
 	if err != nil {
 		logger.Fatalln(err)
 	}
 
+	// The HTML templates must also parse, or the server will not start
+	if err := templates.New(logger).Load(c.HTMLTemplateFiles()...); err != nil {
+		logger.Fatalln("ERROR: Unable to parse the HTML templates:", err)
+	}
+
 	// --------------------------------------------------
-	// Load System and Server Configuration
+	// Report the paths the server will use
 	// --------------------------------------------------
+	// Every path is resolved from global.prefix unless it is absolute, so
+	// these are the files the server opens no matter where it is started.
+	for _, p := range c.ResolvedPaths() {
+		logger.Println("PATH:", p.Directive, "=", p.Path)
+	}
 
 	logger.Println("No errors found")
 }
@@ -0,0 +1,206 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package browse
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"github.com/freetaxii/libstix2/resources/envelope"
+	"github.com/freetaxii/libstix2/resources/manifest"
+	"github.com/freetaxii/libstix2/resources/versions"
+)
+
+// FilterParameters - The URL parameters that are shown in the filter form, in
+// the order they are shown.
+var FilterParameters = []string{
+	"match[type]",
+	"match[id]",
+	"match[version]",
+	"match[spec_version]",
+	"match[relationship_type]",
+	"match[labels]",
+	"added_after",
+	"limit",
+}
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Page - This type holds everything the HTML templates need to show a page of a
+collection.
+
+CollectionURL - The URL path of the collection, ending in a slash
+Path          - The URL path of this page
+ObjectID      - The object the page is for, on the object and versions pages
+Objects       - A summary of each object on the page
+Manifest      - The manifest records on the page
+Versions      - The versions on the page
+More          - Are there more results after this page
+NextURL       - The URL of the next page, if there is one
+Filters       - The value of each filter parameter, keyed by its name
+*/
+type Page struct {
+	CollectionURL string
+	Path          string
+	ObjectID      string
+	Objects       []Object
+	Manifest      []manifest.ManifestRecord
+	Versions      []string
+	More          bool
+	NextURL       string
+	Filters       map[string]string
+}
+
+/*
+Object - This type holds the properties of a STIX object that are shown in the
+tables of the HTML pages. The references are only found on relationships and
+sightings.
+*/
+type Object struct {
+	ID               string `json:"id"`
+	Type             string `json:"type"`
+	Name             string `json:"name"`
+	SpecVersion      string `json:"spec_version"`
+	Created          string `json:"created"`
+	Modified         string `json:"modified"`
+	RelationshipType string `json:"relationship_type"`
+	SourceRef        string `json:"source_ref"`
+	TargetRef        string `json:"target_ref"`
+	SightingOfRef    string `json:"sighting_of_ref"`
+	JSON             string `json:"-"`
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+New - This function will create a Page for a resource that was found for the
+request URL provided. The resource is an envelope, a manifest, or a list of
+versions. The objectID is empty unless the page is for a single object.
+*/
+func New(collectionURL string, u *url.URL, objectID string, resource interface{}) *Page {
+	var p Page
+	p.CollectionURL = collectionURL
+	p.Path = u.Path
+	p.ObjectID = objectID
+
+	values := u.Query()
+	p.Filters = make(map[string]string)
+	for _, name := range FilterParameters {
+		p.Filters[name] = values.Get(name)
+	}
+
+	switch r := resource.(type) {
+	case envelope.Envelope:
+		p.More = r.More
+		for _, o := range r.Objects {
+			p.Objects = append(p.Objects, NewObject(o))
+		}
+	case manifest.Manifest:
+		p.More = r.More
+		p.Manifest = r.Objects
+	case versions.Versions:
+		p.More = r.More
+		p.Versions = r.Versions
+	}
+	return &p
+}
+
+/*
+NewObject - This function will create the summary of a STIX object. Properties
+that the object does not have are left empty.
+*/
+func NewObject(o interface{}) Object {
+	var obj Object
+	data, err := json.Marshal(o)
+	if err != nil {
+		return obj
+	}
+	json.Unmarshal(data, &obj)
+
+	if indented, err := json.MarshalIndent(o, "", "    "); err == nil {
+		obj.JSON = string(indented)
+	}
+	return obj
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Page
+// ----------------------------------------------------------------------
+
+/*
+SetNext - This method will set the link to the next page, which is the request
+URL with its next parameter set to the value provided, the date_added of the
+last object on this page or the next property of the envelope. The added_after
+parameter is removed since it can not be sent with next.
+*/
+func (p *Page) SetNext(u *url.URL, next string) {
+	if p.More == false || next == "" {
+		return
+	}
+
+	values := u.Query()
+	values.Del("added_after")
+	values.Set("next", next)
+	p.NextURL = u.Path + "?" + values.Encode()
+}
+
+/*
+ObjectsURL - This method will return the URL path of the objects of the
+collection.
+*/
+func (p *Page) ObjectsURL() string {
+	return p.CollectionURL + "objects/"
+}
+
+/*
+ManifestURL - This method will return the URL path of the manifest of the
+collection.
+*/
+func (p *Page) ManifestURL() string {
+	return p.CollectionURL + "manifest/"
+}
+
+/*
+ObjectURL - This method will return the URL path of an object.
+*/
+func (p *Page) ObjectURL(id string) string {
+	return p.ObjectsURL() + url.PathEscape(id) + "/"
+}
+
+/*
+VersionsURL - This method will return the URL path of the versions of an
+object.
+*/
+func (p *Page) VersionsURL(id string) string {
+	return p.ObjectURL(id) + "versions/"
+}
+
+/*
+VersionURL - This method will return the URL of one version of an object.
+*/
+func (p *Page) VersionURL(id, version string) string {
+	return p.ObjectURL(id) + "?" + url.Values{"match[version]": {version}}.Encode()
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Object
+// ----------------------------------------------------------------------
+
+/*
+Title - This method will return the text that names an object in a table. That
+is its name, or for a relationship the relationship type.
+*/
+func (o Object) Title() string {
+	if o.Name != "" {
+		return o.Name
+	}
+	return o.RelationshipType
+}
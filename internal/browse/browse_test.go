@@ -0,0 +1,138 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package browse
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/freetaxii/libstix2/resources/envelope"
+	"github.com/freetaxii/libstix2/resources/manifest"
+	"github.com/freetaxii/libstix2/resources/versions"
+	"github.com/freetaxii/server/internal/storetest"
+	"github.com/freetaxii/server/internal/templates"
+)
+
+const collectionURL = "/api1/collections/9cfa669c-ee94-4ece-afd2-f8edac37d8fd/"
+
+// ----------------------------------------------------------------------
+func Test_New(t *testing.T) {
+	u, _ := url.Parse(collectionURL + "objects/?match%5Btype%5D=relationship&limit=2")
+
+	var e envelope.Envelope
+	e.More = true
+	e.Objects = []interface{}{
+		map[string]interface{}{
+			"type":     "indicator",
+			"id":       "indicator--1",
+			"name":     "Bad IP",
+			"created":  "2018-01-01T00:00:00.000Z",
+			"modified": "2018-01-02T00:00:00.000Z",
+		},
+		map[string]interface{}{
+			"type":              "relationship",
+			"id":                "relationship--1",
+			"relationship_type": "indicates",
+			"source_ref":        "indicator--1",
+			"target_ref":        "malware--1",
+		},
+	}
+
+	p := New(collectionURL, u, "", e)
+
+	if len(p.Objects) != 2 || p.More != true {
+		t.Fatalf("got %d objects, more %v", len(p.Objects), p.More)
+	}
+	if o := p.Objects[0]; o.Title() != "Bad IP" || o.Modified != "2018-01-02T00:00:00.000Z" || o.JSON == "" {
+		t.Errorf("wrong indicator summary %+v", o)
+	}
+	if o := p.Objects[1]; o.Title() != "indicates" || o.SourceRef != "indicator--1" || o.TargetRef != "malware--1" {
+		t.Errorf("wrong relationship summary %+v", o)
+	}
+	if p.Filters["match[type]"] != "relationship" || p.Filters["limit"] != "2" || p.Filters["match[id]"] != "" {
+		t.Errorf("wrong filters %v", p.Filters)
+	}
+
+	if got := p.ObjectURL("malware--1"); got != collectionURL+"objects/malware--1/" {
+		t.Errorf("wrong object URL %s", got)
+	}
+	if got := p.VersionURL("malware--1", "2018-01-02T00:00:00.000Z"); got != collectionURL+"objects/malware--1/?match%5Bversion%5D=2018-01-02T00%3A00%3A00.000Z" {
+		t.Errorf("wrong version URL %s", got)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_SetNext(t *testing.T) {
+	u, _ := url.Parse(collectionURL + "manifest/?added_after=2017-01-01T00:00:00Z&limit=10")
+
+	var m manifest.Manifest
+	m.Objects = []manifest.ManifestRecord{{ID: "indicator--1", DateAdded: "2018-01-01T00:00:00Z", Version: "2018-01-01T00:00:00Z"}}
+
+	p := New(collectionURL, u, "", m)
+	p.SetNext(u, "2018-01-01T00:00:00Z")
+	if p.NextURL != "" || len(p.Manifest) != 1 {
+		t.Errorf("next page without more results: %q", p.NextURL)
+	}
+
+	m.More = true
+	p = New(collectionURL, u, "", m)
+	p.SetNext(u, "2018-01-01T00:00:00Z")
+	if want := collectionURL + "manifest/?limit=10&next=2018-01-01T00%3A00%3A00Z"; p.NextURL != want {
+		t.Errorf("got %s want %s", p.NextURL, want)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Templates(t *testing.T) {
+	c := templates.New(storetest.Logger())
+
+	var e envelope.Envelope
+	e.More = true
+	e.Objects = []interface{}{
+		map[string]interface{}{"type": "relationship", "id": "relationship--1", "relationship_type": "indicates", "source_ref": "indicator--1", "target_ref": "malware--1"},
+	}
+	var m manifest.Manifest
+	m.Objects = []manifest.ManifestRecord{{ID: "malware--1", DateAdded: "2018-01-01T00:00:00Z", Version: "2018-01-01T00:00:00Z"}}
+	var v versions.Versions
+	v.Versions = []string{"2018-01-01T00:00:00Z"}
+
+	tests := []struct {
+		template string
+		path     string
+		objectID string
+		resource interface{}
+		want     string
+	}{
+		{templates.Objects, "objects/?limit=1", "", e, `href="` + collectionURL + `objects/malware--1/"`},
+		{templates.Objects, "objects/relationship--1/", "relationship--1", e, `href="` + collectionURL + `objects/relationship--1/versions/"`},
+		{templates.Manifest, "manifest/", "", m, `href="` + collectionURL + `objects/malware--1/"`},
+		{templates.Versions, "objects/malware--1/versions/", "malware--1", v, `href="` + collectionURL + `objects/malware--1/?match%5Bversion%5D=2018-01-01T00%3A00%3A00Z"`},
+	}
+
+	for _, tt := range tests {
+		u, _ := url.Parse(collectionURL + tt.path)
+		p := New(collectionURL, u, tt.objectID, tt.resource)
+		p.SetNext(u, "2018-01-01T00:00:00Z")
+		resource, _ := json.MarshalIndent(tt.resource, "", "    ")
+		data := struct {
+			URLPath  string
+			Resource string
+			Page     *Page
+		}{collectionURL, string(resource), p}
+
+		var b bytes.Buffer
+		if err := c.Execute(&b, templates.BuiltIn+tt.template, data); err != nil {
+			t.Errorf("%s: %v", tt.template, err)
+			continue
+		}
+		if !strings.Contains(b.String(), tt.want) {
+			t.Errorf("%s %s: output does not contain %s", tt.template, tt.path, tt.want)
+		}
+	}
+}
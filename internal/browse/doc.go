@@ -0,0 +1,12 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package browse prepares the objects, manifest, and versions resources of a
+collection for the HTML templates. A Page holds a summary of every object, the
+links between the pages of a collection, the values of the match filters the
+client sent so the filter form can show them, and the link to the next page.
+*/
+package browse
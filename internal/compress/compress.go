@@ -0,0 +1,343 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package compress
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// These are the content codings that are supported, in the order that they
+// are preferred when the client does not prefer one over another.
+const (
+	Brotli   = "br"
+	Gzip     = "gzip"
+	Deflate  = "deflate"
+	Identity = "identity"
+)
+
+var encodings = []string{Brotli, Gzip, Deflate}
+
+// ErrTooLarge - Returned when reading a request body that is larger than the
+// limit once it is decompressed.
+var ErrTooLarge = errors.New("request body is too large")
+
+// ErrUnsupportedEncoding - Returned for a request body with a Content-Encoding
+// that is not supported.
+var ErrUnsupportedEncoding = errors.New("content encoding is not supported")
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+responseWriter - This type compresses everything that is written to it, when
+the response is a type that is worth compressing.
+*/
+type responseWriter struct {
+	http.ResponseWriter
+	encoding    string
+	w           io.WriteCloser
+	wroteHeader bool
+}
+
+/*
+limitedReader - This type returns ErrTooLarge, instead of io.EOF, once more than
+the limit has been read.
+*/
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+/*
+body - This type closes both the decompressor and the original request body.
+*/
+type body struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+Handler - This function will wrap a handler so that its responses are
+compressed with the content coding that the client prefers in the
+Accept-Encoding header. Only JSON and HTML responses are compressed. Server-Sent
+Events and anything that already has a Content-Encoding are sent as they are.
+*/
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := Negotiate(r.Header.Get("Accept-Encoding"))
+		if encoding == Identity {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &responseWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+/*
+Negotiate - This function will return the supported content coding with the
+highest quality value in an Accept-Encoding header, or identity if the client
+does not accept any of them. Ties are broken by the order of preference of the
+server.
+*/
+func Negotiate(acceptEncoding string) string {
+	quality := make(map[string]float64)
+	wildcard := -1.0
+
+	for _, element := range strings.Split(acceptEncoding, ",") {
+		parts := strings.Split(element, ";")
+		coding := strings.ToLower(strings.TrimSpace(parts[0]))
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, p := range parts[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 && strings.ToLower(strings.TrimSpace(kv[0])) == "q" {
+				v, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+				if err != nil || !(v >= 0 && v <= 1) {
+					v = 0
+				}
+				q = v
+			}
+		}
+
+		if coding == "*" {
+			wildcard = q
+		} else {
+			quality[coding] = q
+		}
+	}
+
+	best := Identity
+	bestQ := 0.0
+	for _, e := range encodings {
+		q, found := quality[e]
+		if !found {
+			q = wildcard
+		}
+		if q > bestQ {
+			best = e
+			bestQ = q
+		}
+	}
+	return best
+}
+
+/*
+Body - This function will return a reader for the body of a request that
+decompresses it according to its Content-Encoding header and returns
+ErrTooLarge once more than limit bytes of decompressed data are read. A limit
+of 0 or less does not limit the body. ErrUnsupportedEncoding is returned for a
+content coding that is not supported.
+*/
+func Body(r *http.Request, limit int64) (io.ReadCloser, error) {
+	var reader io.Reader = r.Body
+	closers := []io.Closer{r.Body}
+
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+	case "", Identity:
+
+	case Gzip, "x-gzip":
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		reader = gz
+		closers = append(closers, gz)
+
+	case Deflate:
+		// The deflate content coding is zlib wrapped deflate data, but some
+		// clients send raw deflate data so both are accepted
+		buffered := bufio.NewReader(r.Body)
+		if header, err := buffered.Peek(2); err == nil && isZlib(header) {
+			z, err := zlib.NewReader(buffered)
+			if err != nil {
+				return nil, err
+			}
+			reader = z
+			closers = append(closers, z)
+		} else {
+			f := flate.NewReader(buffered)
+			reader = f
+			closers = append(closers, f)
+		}
+
+	case Brotli:
+		reader = brotli.NewReader(r.Body)
+
+	default:
+		return nil, ErrUnsupportedEncoding
+	}
+
+	if limit > 0 {
+		reader = &limitedReader{r: reader, remaining: limit}
+	}
+	return &body{Reader: reader, closers: closers}, nil
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - responseWriter
+// ----------------------------------------------------------------------
+
+/*
+WriteHeader - This method will decide if the response is compressed, based on
+its Content-Type and status code, before the headers are sent.
+*/
+func (c *responseWriter) WriteHeader(code int) {
+	if c.wroteHeader == true {
+		return
+	}
+	c.wroteHeader = true
+
+	h := c.Header()
+	if compressible(h.Get("Content-Type")) && h.Get("Content-Encoding") == "" && code >= 200 && code != http.StatusNoContent && code != http.StatusNotModified {
+		h.Set("Content-Encoding", c.encoding)
+		h.Del("Content-Length")
+		c.w = newWriter(c.encoding, c.ResponseWriter)
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+/*
+Write - This method will write data to the compressor, or straight through if
+the response is not compressed.
+*/
+func (c *responseWriter) Write(data []byte) (int, error) {
+	if c.wroteHeader == false {
+		if c.Header().Get("Content-Type") == "" {
+			c.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.w != nil {
+		return c.w.Write(data)
+	}
+	return c.ResponseWriter.Write(data)
+}
+
+/*
+Flush - This method will flush the compressor and the underlying writer, so
+that streaming responses still reach the client as they are written.
+*/
+func (c *responseWriter) Flush() {
+	if f, ok := c.w.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - responseWriter
+// ----------------------------------------------------------------------
+
+/*
+close - This method will write out the end of the compressed data.
+*/
+func (c *responseWriter) close() {
+	if c.w != nil {
+		c.w.Close()
+	}
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - limitedReader
+// ----------------------------------------------------------------------
+
+/*
+Read - This method will read from the underlying reader until the limit is
+passed.
+*/
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrTooLarge
+	}
+
+	// Read one byte more than the limit so that a body that is exactly the
+	// limit is not rejected
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - body
+// ----------------------------------------------------------------------
+
+/*
+Close - This method will close the decompressor and the request body.
+*/
+func (b *body) Close() error {
+	var err error
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		if e := b.closers[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+newWriter - This function will create the compressor for a content coding.
+*/
+func newWriter(encoding string, w io.Writer) io.WriteCloser {
+	switch encoding {
+	case Brotli:
+		return brotli.NewWriterLevel(w, brotli.DefaultCompression)
+	case Deflate:
+		return zlib.NewWriter(w)
+	}
+	return gzip.NewWriter(w)
+}
+
+/*
+compressible - This function will return true for the media types that are
+compressed, which are JSON, including the TAXII and STIX media types, and HTML.
+*/
+func compressible(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return strings.HasSuffix(mediaType, "json") || mediaType == "text/html"
+}
+
+/*
+isZlib - This function will return true if the first two bytes of data are a
+valid zlib header.
+*/
+func isZlib(header []byte) bool {
+	return header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
@@ -0,0 +1,154 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ----------------------------------------------------------------------
+func Test_Negotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", Identity},
+		{"gzip", Gzip},
+		{"gzip, deflate, br", Brotli},
+		{"gzip;q=1, br;q=0.5", Gzip},
+		{"deflate", Deflate},
+		{"*", Brotli},
+		{"*;q=0.5, gzip", Gzip},
+		{"br;q=0, *", Gzip},
+		{"compress, identity", Identity},
+		{"gzip;q=bad", Identity},
+	}
+
+	for _, tt := range tests {
+		if got := Negotiate(tt.accept); got != tt.want {
+			t.Errorf("Negotiate(%q) = %q want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Handler(t *testing.T) {
+	payload := strings.Repeat(`{"type": "indicator"}`, 100)
+
+	h := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("X-Test-Content-Type"))
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, payload)
+	}))
+
+	readers := map[string]func(io.Reader) (io.Reader, error){
+		Gzip:    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		Deflate: func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+		Brotli:  func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	}
+
+	for encoding, newReader := range readers {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Test-Content-Type", "application/taxii+json;version=2.1")
+		req.Header.Set("Accept-Encoding", encoding)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Header().Get("Content-Encoding") != encoding {
+			t.Errorf("%s: wrong Content-Encoding %q", encoding, rec.Header().Get("Content-Encoding"))
+			continue
+		}
+		r, err := newReader(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil || string(data) != payload {
+			t.Errorf("%s: response did not decompress to the payload: %v", encoding, err)
+		}
+	}
+
+	// Server-Sent Events are not compressed
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Test-Content-Type", "text/event-stream")
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != payload {
+		t.Error("an event stream was compressed")
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Body(t *testing.T) {
+	payload := []byte(strings.Repeat("a", 1000))
+
+	var gz, z, f, br bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(payload)
+	gw.Close()
+	zw := zlib.NewWriter(&z)
+	zw.Write(payload)
+	zw.Close()
+	fw, _ := flate.NewWriter(&f, flate.DefaultCompression)
+	fw.Write(payload)
+	fw.Close()
+	bw := brotli.NewWriter(&br)
+	bw.Write(payload)
+	bw.Close()
+
+	tests := []struct {
+		encoding string
+		body     []byte
+		limit    int64
+		err      error
+	}{
+		{"", payload, 1000, nil},
+		{"", payload, 999, ErrTooLarge},
+		{"gzip", gz.Bytes(), 1000, nil},
+		{"gzip", gz.Bytes(), 100, ErrTooLarge},
+		{"deflate", z.Bytes(), 0, nil},
+		{"deflate", f.Bytes(), 0, nil},
+		{"br", br.Bytes(), 1000, nil},
+		{"br", br.Bytes(), 10, ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(tt.body))
+		req.Header.Set("Content-Encoding", tt.encoding)
+
+		body, err := Body(req, tt.limit)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.encoding, err)
+		}
+		data, err := ioutil.ReadAll(body)
+		body.Close()
+
+		if err != tt.err {
+			t.Errorf("%s limit %d: got error %v want %v", tt.encoding, tt.limit, err, tt.err)
+		}
+		if tt.err == nil && !bytes.Equal(data, payload) {
+			t.Errorf("%s: body did not decompress to the payload", tt.encoding)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(payload))
+	req.Header.Set("Content-Encoding", "compress")
+	if _, err := Body(req, 0); err != ErrUnsupportedEncoding {
+		t.Errorf("unsupported encoding not rejected: %v", err)
+	}
+}
@@ -0,0 +1,14 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package compress adds HTTP content coding to the server. Responses are
+compressed with brotli, gzip, or deflate when the client asks for it in the
+Accept-Encoding header, and request bodies that are sent with one of those
+Content-Encoding values are decompressed. The size limit of a request body is
+applied to the decompressed data, so a small compressed body can not expand in
+to more data than the server accepts.
+*/
+package compress
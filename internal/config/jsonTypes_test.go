@@ -7,14 +7,15 @@ package config
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
 type Dataset struct {
-	HTMLConfigType
-	Service1 HTMLConfigType
-	Service2 HTMLConfigType
-	Service3 HTMLConfigType
+	HTMLConfig
+	Service1 HTMLConfig
+	Service2 HTMLConfig
+	Service3 HTMLConfig
 }
 
 // type HTMLConfigType struct {
@@ -38,7 +39,7 @@ var data = `
   "TemplatePath": "/foo/",
   "TemplateFiles": {
   	"Discovery": "d1",
-  	"APIRoot":   "a1"
+  	"APIRoot":   "a1",
   	"Collections": "cols1",
   	"Collection": "col1",
   	"Objects": "o1",
@@ -50,7 +51,7 @@ var data = `
 		"TemplatePath": "/bar/",
 		"TemplateFiles": {
 	 		"Discovery": "d1",
-	  		"APIRoot":   "a2"
+	  		"APIRoot":   "a2",
 	  		"Collections": "cols1",
 	  		"Collection": "col1",
 	  		"Objects": "o2",
@@ -63,7 +64,7 @@ var data = `
 		"TemplatePath": "/bar/",
 		"TemplateFiles": {
 	 		"Discovery": "d1",
-	  		"APIRoot":   "a2"
+	  		"APIRoot":   "a2",
 	  		"Collections": "cols1",
 	  		"Collection": "col1",
 	  		"Objects": "o2",
@@ -81,11 +82,11 @@ var data = `
 func Test_HTMLConfigType(t *testing.T) {
 	var c Dataset
 
-	decoder := json.NewDecoder(data)
-	err := decoder.Decode(c)
+	decoder := json.NewDecoder(strings.NewReader(data))
+	err := decoder.Decode(&c)
 
 	if err != nil {
-		return t.Errorf("error parsing the configuration file: %v", err)
+		t.Errorf("error parsing the configuration file: %v", err)
 	}
 
 	// t.Log("Test 1: get an error for no collection id")
@@ -0,0 +1,98 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package config
+
+import (
+	"path/filepath"
+	"strconv"
+)
+
+/*
+ResolvedPath - This type holds the full path of a file or directory from the
+configuration file along with the directive that defines it.
+*/
+type ResolvedPath struct {
+	Directive string
+	Path      string
+}
+
+/*
+Path - This method will return the full path of a file or directory from the
+configuration file. Every file and directory that the server uses is found
+with this method. Each name is relative to the one before it and the first one
+is relative to the global.prefix directive, so directories need the ending
+slash. A name that is an absolute path is used as it is, along with the names
+after it. Example: Path(c.Global.TLSDir, c.Global.TLSCrt)
+*/
+func (c *ServerConfig) Path(names ...string) string {
+	p := c.Global.Prefix
+	for _, name := range names {
+		if filepath.IsAbs(name) {
+			p = name
+		} else {
+			p += name
+		}
+	}
+	return p
+}
+
+/*
+TLSPath - This method will return the full path of a file in the directory of
+the global.tlsdir directive.
+*/
+func (c *ServerConfig) TLSPath(file string) string {
+	return c.Path(c.Global.TLSDir, file)
+}
+
+/*
+ResolvedPaths - This method will return the full path of every file and
+directory that the server will use with this configuration, in the order they
+are found in the configuration file. It is used after the configuration is
+verified, so that the paths can be reported.
+*/
+func (c *ServerConfig) ResolvedPaths() []ResolvedPath {
+	var paths []ResolvedPath
+	add := func(directive, path string) {
+		paths = append(paths, ResolvedPath{Directive: directive, Path: path})
+	}
+
+	add("global.prefix", c.Global.Prefix)
+	if c.Global.Protocol == "https" {
+		add("global.tlsdir", c.TLSPath(""))
+		add("global.tlscrt", c.TLSPath(c.Global.TLSCrt))
+		add("global.tlskey", c.TLSPath(c.Global.TLSKey))
+		if c.TLS.OCSPStapleFile != "" {
+			add("tls.ocspstaplefile", c.TLSPath(c.TLS.OCSPStapleFile))
+		}
+	}
+	add("global.dbfile", c.Path(c.Global.DbFile))
+
+	// Templates that are built in to the server start with builtin:
+	for _, f := range c.HTMLTemplateFiles() {
+		add("html.templatefiles", f)
+	}
+
+	if c.Logging.Enabled == true {
+		add("logging.logfile", c.Path(c.Logging.LogFile))
+	}
+
+	if c.WebhooksEnabled() == true && c.Webhooks.DeadLetterFile != "" {
+		add("webhooks.deadletterfile", c.Path(c.Webhooks.DeadLetterFile))
+	}
+
+	if c.IngestServer.Enabled == true {
+		for i, s := range c.IngestServer.Services {
+			if s.Enabled == true {
+				add("ingest_server.services["+strconv.Itoa(i)+"].directory", c.Path(s.Directory))
+			}
+		}
+	}
+
+	if c.Feeds.Enabled == true {
+		add("feeds.statedir", c.Path(c.Feeds.StateDir))
+	}
+	return paths
+}
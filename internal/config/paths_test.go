@@ -0,0 +1,133 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license that can be
+// found in the LICENSE file in the root of the source tree.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+// ----------------------------------------------------------------------
+func Test_Path(t *testing.T) {
+	var tests = []struct {
+		prefix string
+		names  []string
+		path   string
+	}{
+		{"/opt/freetaxii/", nil, "/opt/freetaxii/"},
+		{"/opt/freetaxii/", []string{"db/freetaxii.db"}, "/opt/freetaxii/db/freetaxii.db"},
+		{"/opt/freetaxii/", []string{"etc/tls/", "server.crt"}, "/opt/freetaxii/etc/tls/server.crt"},
+		{"/opt/freetaxii/", []string{"/var/db/freetaxii.db"}, "/var/db/freetaxii.db"},
+		{"/opt/freetaxii/", []string{"/etc/tls/", "server.crt"}, "/etc/tls/server.crt"},
+		{"/opt/freetaxii/", []string{"etc/tls/", "/etc/ssl/server.crt"}, "/etc/ssl/server.crt"},
+		{"", []string{"db/freetaxii.db"}, "db/freetaxii.db"},
+	}
+
+	for _, test := range tests {
+		var c ServerConfig
+		c.Global.Prefix = test.prefix
+		if v := c.Path(test.names...); v != test.path {
+			t.Errorf("path of %q with prefix %q is %q, expected %q", test.names, test.prefix, v, test.path)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_TLSPath(t *testing.T) {
+	var tests = []struct {
+		tlsDir string
+		file   string
+		path   string
+	}{
+		{"etc/tls/", "server.crt", "/opt/freetaxii/etc/tls/server.crt"},
+		{"etc/tls/", "", "/opt/freetaxii/etc/tls/"},
+		{"/etc/tls/", "server.key", "/etc/tls/server.key"},
+		{"etc/tls/", "/etc/ssl/server.key", "/etc/ssl/server.key"},
+	}
+
+	for _, test := range tests {
+		var c ServerConfig
+		c.Global.Prefix = "/opt/freetaxii/"
+		c.Global.TLSDir = test.tlsDir
+		if v := c.TLSPath(test.file); v != test.path {
+			t.Errorf("TLS path of %q in %q is %q, expected %q", test.file, test.tlsDir, v, test.path)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_ResolvedPaths(t *testing.T) {
+	newConfig := func() ServerConfig {
+		var c ServerConfig
+		c.Global.Prefix = "/opt/freetaxii/"
+		c.Global.Protocol = "http"
+		c.Global.TLSDir = "etc/tls/"
+		c.Global.TLSCrt = "server.crt"
+		c.Global.TLSKey = "server.key"
+		c.Global.DbFile = "db/freetaxii.db"
+		c.Logging.LogFile = "log/freetaxii.log"
+		return c
+	}
+
+	var tests = []struct {
+		name   string
+		change func(c *ServerConfig)
+		paths  []ResolvedPath
+	}{
+		{
+			"http",
+			func(c *ServerConfig) {},
+			[]ResolvedPath{
+				{"global.prefix", "/opt/freetaxii/"},
+				{"global.dbfile", "/opt/freetaxii/db/freetaxii.db"},
+			},
+		},
+		{
+			"https",
+			func(c *ServerConfig) {
+				c.Global.Protocol = "https"
+				c.TLS.OCSPStapleFile = "/etc/ssl/server.ocsp"
+			},
+			[]ResolvedPath{
+				{"global.prefix", "/opt/freetaxii/"},
+				{"global.tlsdir", "/opt/freetaxii/etc/tls/"},
+				{"global.tlscrt", "/opt/freetaxii/etc/tls/server.crt"},
+				{"global.tlskey", "/opt/freetaxii/etc/tls/server.key"},
+				{"tls.ocspstaplefile", "/etc/ssl/server.ocsp"},
+				{"global.dbfile", "/opt/freetaxii/db/freetaxii.db"},
+			},
+		},
+		{
+			"enabled services",
+			func(c *ServerConfig) {
+				c.Global.DbFile = "/var/db/freetaxii.db"
+				c.Logging.Enabled = true
+				c.IngestServer.Enabled = true
+				c.IngestServer.Services = []IngestService{
+					{Enabled: false, Directory: "ingest/old/"},
+					{Enabled: true, Directory: "ingest/new/"},
+				}
+				c.Feeds.Enabled = true
+				c.Feeds.StateDir = "feeds/"
+			},
+			[]ResolvedPath{
+				{"global.prefix", "/opt/freetaxii/"},
+				{"global.dbfile", "/var/db/freetaxii.db"},
+				{"logging.logfile", "/opt/freetaxii/log/freetaxii.log"},
+				{"ingest_server.services[1].directory", "/opt/freetaxii/ingest/new/"},
+				{"feeds.statedir", "/opt/freetaxii/feeds/"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		c := newConfig()
+		test.change(&c)
+		if v := c.ResolvedPaths(); reflect.DeepEqual(v, test.paths) == false {
+			t.Errorf("%s: resolved paths are %v, expected %v", test.name, v, test.paths)
+		}
+	}
+}
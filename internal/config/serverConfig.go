@@ -6,9 +6,12 @@
 package config
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
+	"time"
 
 	"github.com/freetaxii/libstix2/resources/apiroot"
 	"github.com/freetaxii/libstix2/resources/collections"
@@ -34,15 +37,38 @@ type ServerConfig struct {
 		DbType            string
 		DbFile            string
 		ServerRecordLimit int
+		MetricsPath       string
+	}
+	TLS struct {
+		MinVersion                    string
+		MaxVersion                    string
+		CipherSuites                  []string
+		Curves                        []string
+		SessionTicketRotation         string
+		OCSPStapleFile                string
+		MinVersionID                  uint16        // Set in verifyTLSConfig()
+		MaxVersionID                  uint16        // Set in verifyTLSConfig(), 0 for the newest version
+		CipherSuiteIDs                []uint16      // Set in verifyTLSConfig()
+		CurveIDs                      []tls.CurveID // Set in verifyTLSConfig()
+		SessionTicketRotationDuration time.Duration // Set in verifyTLSConfig()
 	}
 	HTML struct {
 		HTMLConfig
+		DevMode bool // Parse a template again as soon as its file changes
 	}
 	Logging struct {
 		Enabled bool
 		Level   int
 		LogFile string
 	}
+	Retention struct {
+		Enabled          bool
+		Interval         string
+		IntervalDuration time.Duration // Set in verifyRetentionConfig()
+	}
+	Search struct {
+		Enabled bool // Index the objects that are added and serve the search endpoint of each API root
+	}
 	DiscoveryServer struct {
 		Enabled  bool
 		Services []DiscoveryService
@@ -51,9 +77,26 @@ type ServerConfig struct {
 		Enabled  bool
 		Services []APIRootService
 	} `json:"apiroot_server,omitempty"`
-	DiscoveryResources  map[string]discovery.Discovery    `json:"discovery_resources,omitempty"`  // The key in the map is the ResourceID
-	APIRootResources    map[string]apiroot.APIRoot        `json:"apiroot_resources,omitempty"`    // The key in the map is the ResourceID
-	CollectionResources map[string]collections.Collection `json:"collection_resources,omitempty"` // The key in the map is the ResourceID
+	IngestServer struct {
+		Enabled          bool
+		Interval         string
+		IntervalDuration time.Duration // Set in verifyIngestConfig()
+		Services         []IngestService
+	} `json:"ingest_server,omitempty"`
+	Webhooks struct {
+		MaxAttempts     int
+		Backoff         string
+		BackoffDuration time.Duration // Set in verifyWebhooksConfig()
+		DeadLetterFile  string
+	}
+	Feeds struct {
+		Enabled  bool
+		StateDir string
+		Services []FeedService
+	} `json:"feeds,omitempty"`
+	DiscoveryResources  map[string]discovery.Discovery `json:"discovery_resources,omitempty"`  // The key in the map is the ResourceID
+	APIRootResources    map[string]apiroot.APIRoot     `json:"apiroot_resources,omitempty"`    // The key in the map is the ResourceID
+	CollectionResources map[string]CollectionResource  `json:"collection_resources,omitempty"` // The key in the map is the ResourceID
 }
 
 /*
@@ -90,9 +133,12 @@ ReadAccess - This is a list of collection resource IDs that may have GET access
 at the API Root level
 WriteAccess - This is a list of collection resource IDs that may have POST access
 at the API Root level
+TAXII20 - Also serve TAXII 2.0 representations to clients that ask for them in
+the Accept header
 */
 type APIRootService struct {
 	BaseService
+	TAXII20     bool // User defined in configuration file
 	Collections struct {
 		Enabled     bool     // User defined in configuration file
 		ReadAccess  []string // User defined in configuration file.
@@ -100,6 +146,113 @@ type APIRootService struct {
 	}
 }
 
+/*
+IngestService - This struct represents a directory that is watched for STIX
+bundle and envelope files. Each file that is found is added to the collection
+and then moved to the done or failed sub directory along with a status report.
+
+Enabled    - Is this service enabled
+Directory  - The directory to watch, relative to the base of the application (prefix)
+ResourceID - The collection resource that the objects are added to
+*/
+type IngestService struct {
+	Enabled    bool   // User defined in configuration file
+	Directory  string // User defined in configuration file
+	ResourceID string // User defined in configuration file
+}
+
+/*
+FeedService - This struct represents an upstream TAXII 2.1 collection that is
+mirrored in to a local collection. The upstream collection is polled for new
+objects and the last date_added that was seen is kept in the state directory
+so that polling picks up where it left off after a restart.
+
+Name          - A unique name for this feed, used for logging and the state file
+APIRoot       - The URL of the upstream API root, example https://example.com/api1/
+CollectionID  - The ID of the collection at the upstream API root
+Username      - The username for HTTP basic authentication, if needed
+Password      - The password for HTTP basic authentication, if needed
+Interval      - How often the upstream collection is polled (example "15m")
+ResourceID    - The local collection resource that the objects are added to
+*/
+type FeedService struct {
+	Enabled          bool          // User defined in configuration file
+	Name             string        // User defined in configuration file
+	APIRoot          string        // User defined in configuration file
+	CollectionID     string        // User defined in configuration file
+	Username         string        // User defined in configuration file
+	Password         string        // User defined in configuration file
+	Interval         string        // User defined in configuration file
+	IntervalDuration time.Duration // Set in verifyFeedsConfig()
+	ResourceID       string        // User defined in configuration file
+}
+
+/*
+CollectionResource - This struct represents a collection resource from the
+configuration file. It holds the TAXII collection resource that is sent to
+clients along with the server side settings for that collection that are never
+sent to clients.
+
+Retention - The retention policy that is enforced on the contents of this collection
+Webhooks  - The webhooks that are notified when objects are added to this collection
+Markings  - The data markings that objects in this collection may carry
+*/
+type CollectionResource struct {
+	collections.Collection
+	Retention RetentionPolicy
+	Webhooks  []Webhook
+	Markings  MarkingPolicy
+}
+
+/*
+MarkingPolicy - This struct defines the data markings, like TLP, that objects
+in a collection may carry. Markings are listed by marking-definition id or by
+TLP name, example "tlp:red". The TLP names are changed to their ids in
+verifyMarkingsConfig().
+
+Enabled - Is the marking policy enforced for this collection
+Allowed - The markings objects may carry, an empty list allows any marking
+Default - The markings that are added to objects without object_marking_refs when they are added
+*/
+type MarkingPolicy struct {
+	Enabled bool
+	Allowed []string
+	Default []string
+}
+
+/*
+RetentionPolicy - This struct defines how long the contents of a collection are
+kept. A background job removes anything that falls outside of the policy.
+
+Enabled               - Is the retention policy enforced for this collection
+MaxAge                - Remove objects whose date_added is older than this duration (example "2160h")
+DropExpiredIndicators - Remove indicators whose valid_until is in the past
+MaxVersions           - Keep only this many of the most recent versions of an object, 0 keeps all
+*/
+type RetentionPolicy struct {
+	Enabled               bool
+	MaxAge                string
+	MaxAgeDuration        time.Duration // Set in verifyRetentionConfig()
+	DropExpiredIndicators bool
+	MaxVersions           int
+}
+
+/*
+Webhook - This struct defines a URL that receives a notification of the objects
+that were added to a collection.
+
+Enabled - Is this webhook enabled
+URL     - The http or https URL that the notification is posted to
+Secret  - The secret used to sign each notification with HMAC-SHA256, if defined
+Types   - Only notify for these STIX object types, an empty list notifies for all
+*/
+type Webhook struct {
+	Enabled bool
+	URL     string
+	Secret  string
+	Types   []string
+}
+
 /*
 HTMLConfig - This struct holds the configuration elements for generating HTML
 output. This is used at the top level of the configuration file as well as in
@@ -126,6 +279,7 @@ type HTMLConfig struct {
 		Objects     JSONstring
 		Versions    JSONstring
 		Manifest    JSONstring
+		Error       JSONstring
 	}
 	FullTemplatePath string // Set in verifyHTMLConfig(), this is the full path to template files
 }
@@ -198,6 +352,100 @@ func (c *ServerConfig) loadServerConfig(filename string) error {
 	return nil
 }
 
+/*
+CollectionResourceMap - This method will return just the TAXII collection
+resources from the configuration, as they are needed by the datastore.
+*/
+func (c *ServerConfig) CollectionResourceMap() map[string]collections.Collection {
+	m := make(map[string]collections.Collection)
+	for key, value := range c.CollectionResources {
+		m[key] = value.Collection
+	}
+	return m
+}
+
+/*
+CollectionIDs - This method will return the ID of every collection resource in
+the configuration, in order.
+*/
+func (c *ServerConfig) CollectionIDs() []string {
+	var ids []string
+	for _, value := range c.CollectionResources {
+		ids = append(ids, value.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+/*
+TAXII20Enabled - This method will return true if any enabled API root serves
+TAXII 2.0 representations.
+*/
+func (c *ServerConfig) TAXII20Enabled() bool {
+	for _, api := range c.APIRootServer.Services {
+		if api.Enabled == true && api.TAXII20 == true {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+HTMLTemplateFiles - This method will return the full path of every HTML
+template that is used by an enabled service with HTML output, once each. It is
+used after the configuration is verified, so that the templates can be parsed
+before the server starts.
+*/
+func (c *ServerConfig) HTMLTemplateFiles() []string {
+	var files []string
+	found := make(map[string]bool)
+
+	add := func(h HTMLConfig, templates ...JSONstring) {
+		if h.Enabled.Value == false {
+			return
+		}
+		for _, t := range templates {
+			f := h.FullTemplatePath + t.Value
+			if t.Value != "" && found[f] == false {
+				found[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+
+	if c.DiscoveryServer.Enabled == true {
+		for _, s := range c.DiscoveryServer.Services {
+			if s.Enabled == true {
+				add(s.HTML, s.HTML.TemplateFiles.Discovery, s.HTML.TemplateFiles.Error)
+			}
+		}
+	}
+
+	if c.APIRootServer.Enabled == true {
+		for _, s := range c.APIRootServer.Services {
+			if s.Enabled == true {
+				f := s.HTML.TemplateFiles
+				add(s.HTML, f.APIRoot, f.Collections, f.Collection, f.Objects, f.Versions, f.Manifest, f.Error)
+			}
+		}
+	}
+	return files
+}
+
+/*
+TLSConfig - This method will return the TLS settings of the tls section as a
+tls.Config. It is used after the configuration is verified. The certificate and
+the session ticket keys are set up by the caller.
+*/
+func (c *ServerConfig) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:       c.TLS.MinVersionID,
+		MaxVersion:       c.TLS.MaxVersionID,
+		CipherSuites:     c.TLS.CipherSuiteIDs,
+		CurvePreferences: c.TLS.CurveIDs,
+	}
+}
+
 /*
 exists - This method checks to see if the filename exists on the file system.
 This is used by several of the configuration directive checks, basically anytime
@@ -54,6 +54,52 @@ func (c *ServerConfig) Verify() error {
 		}
 	}
 
+	// --------------------------------------------------
+	// Ingest Server
+	// --------------------------------------------------
+	// Only verify the directory ingest configuration if it is enabled.
+	if c.IngestServer.Enabled == true {
+		problemsFound += c.verifyIngestConfig()
+	}
+
+	// --------------------------------------------------
+	// Upstream Feeds
+	// --------------------------------------------------
+	// Only verify the upstream feeds if mirroring is enabled.
+	if c.Feeds.Enabled == true {
+		problemsFound += c.verifyFeedsConfig()
+	}
+
+	// --------------------------------------------------
+	// Webhooks
+	// --------------------------------------------------
+	// Only verify the webhooks if at least one of them is enabled.
+	if c.WebhooksEnabled() == true {
+		problemsFound += c.verifyWebhooksConfig()
+	}
+
+	// --------------------------------------------------
+	// Retention
+	// --------------------------------------------------
+	// Only verify the retention policies if the retention job is enabled.
+	if c.Retention.Enabled == true {
+		problemsFound += c.verifyRetentionConfig()
+	}
+
+	// --------------------------------------------------
+	// Search
+	// --------------------------------------------------
+	// Only verify the search index if search is enabled.
+	if c.Search.Enabled == true {
+		problemsFound += c.verifySearchConfig()
+	}
+
+	// --------------------------------------------------
+	// Data Markings
+	// --------------------------------------------------
+	// Only the collections that enable a marking policy are checked.
+	problemsFound += c.verifyMarkingsConfig()
+
 	if problemsFound > 0 {
 		c.Logger.Println("ERROR: The configuration has", problemsFound, "error(s)")
 		return errors.New("ERROR: Configuration errors found")
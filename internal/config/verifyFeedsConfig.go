@@ -0,0 +1,91 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package config
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+verifyFeedsConfig - This method will verify all of the configuration
+directives for the upstream feeds and will return the number of errors found.
+It will also populate the parsed poll intervals.
+*/
+func (c *ServerConfig) verifyFeedsConfig() int {
+	var problemsFound = 0
+
+	// The state directory holds the last date_added that was seen for each feed
+	if c.Feeds.StateDir == "" {
+		c.Logger.Println("CONFIG: The feeds.statedir directive is missing from the configuration file")
+		problemsFound++
+	} else {
+		if !strings.HasSuffix(c.Feeds.StateDir, "/") {
+			c.Logger.Println("CONFIG: The feeds.statedir directive is missing the ending slash '/'")
+			problemsFound++
+		}
+
+		filepath := c.Path(c.Feeds.StateDir)
+		if !c.exists(filepath) {
+			c.Logger.Println("CONFIG: The feeds state directory", filepath, "can not be opened")
+			problemsFound++
+		}
+	}
+
+	names := make(map[string]bool)
+	for i, value := range c.Feeds.Services {
+		text := "feeds.services[" + strconv.Itoa(i) + "]"
+
+		// The name is used for the state file so it must be unique and safe to
+		// use as a filename
+		if value.Name == "" {
+			c.Logger.Println("CONFIG: The " + text + " is missing the 'name' directive in the configuration file")
+			problemsFound++
+		} else if strings.ContainsAny(value.Name, `/\`) || strings.HasPrefix(value.Name, ".") {
+			c.Logger.Println("CONFIG: The " + text + ".name directive " + value.Name + " can not contain a slash or start with a '.'")
+			problemsFound++
+		} else if names[value.Name] == true {
+			c.Logger.Println("CONFIG: The " + text + ".name directive " + value.Name + " is used by more than one feed")
+			problemsFound++
+		}
+		names[value.Name] = true
+
+		u, err := url.Parse(value.APIRoot)
+		if value.APIRoot == "" || err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			c.Logger.Println("CONFIG: The " + text + ".apiroot directive must be an http or https URL")
+			problemsFound++
+		} else if !strings.HasSuffix(value.APIRoot, "/") {
+			c.Logger.Println("CONFIG: The " + text + ".apiroot directive is missing the ending slash '/'")
+			problemsFound++
+		}
+
+		if value.CollectionID == "" {
+			c.Logger.Println("CONFIG: The " + text + " is missing the 'collectionid' directive in the configuration file")
+			problemsFound++
+		}
+
+		d, err := time.ParseDuration(value.Interval)
+		if err != nil || d <= 0 {
+			c.Logger.Println("CONFIG: The " + text + ".interval directive " + value.Interval + " is not a valid duration, example: 15m")
+			problemsFound++
+		}
+		c.Feeds.Services[i].IntervalDuration = d
+
+		// Verify the Collection Resource that is referenced actually exists
+		if _, ok := c.CollectionResources[value.ResourceID]; !ok {
+			c.Logger.Println("CONFIG: The " + text + " is using a collection of " + value.ResourceID + " that is missing from the configuration file")
+			problemsFound++
+		}
+	}
+
+	// Return errors if there were any
+	if problemsFound > 0 {
+		c.Logger.Println("ERROR: The Feeds configuration has", problemsFound, "error(s)")
+	}
+	return problemsFound
+}
@@ -6,7 +6,12 @@
 package config
 
 import (
+	"crypto/tls"
+	"path"
 	"strings"
+	"time"
+
+	"github.com/freetaxii/server/internal/tlsconfig"
 )
 
 /*
@@ -50,10 +55,22 @@ func (c *ServerConfig) verifyGlobalConfig() int {
 		problemsFound++
 	}
 
+	// Metrics Path Directive
+	if c.Global.MetricsPath != "" && !strings.HasPrefix(c.Global.MetricsPath, "/") {
+		c.Logger.Println("CONFIG: The global.metricspath directive is missing the starting slash '/'")
+		problemsFound++
+	}
+
 	// Logging File
 	if c.Logging.Enabled == true && c.Logging.LogFile == "" {
 		c.Logger.Println("CONFIG: The logging.logfile directive is missing from the configuration file")
 		problemsFound++
+	} else if c.Logging.Enabled == true {
+		dir := path.Dir(c.Path(c.Logging.LogFile))
+		if !c.exists(dir) {
+			c.Logger.Println("CONFIG: The directory", dir, "for the logging.logfile directive can not be opened")
+			problemsFound++
+		}
 	}
 
 	// ----------------------------------------------------------------------
@@ -67,7 +84,9 @@ func (c *ServerConfig) verifyGlobalConfig() int {
 
 /*
 verifyTLSConfig - This method will verify that each required TLS configuration
-directive are present.
+directive are present and that the names in the tls section are known. It will
+also populate the TLS versions, cipher suites, curves, and the session ticket
+rotation interval that are used to configure the server.
 */
 func (c *ServerConfig) verifyTLSConfig() int {
 	var problemsFound = 0
@@ -76,7 +95,7 @@ func (c *ServerConfig) verifyTLSConfig() int {
 		c.Logger.Println("CONFIG: The global.tlsdir directive is missing from the configuration file")
 		problemsFound++
 	} else {
-		filepath := c.Global.Prefix + c.Global.TLSDir
+		filepath := c.TLSPath("")
 
 		if !strings.HasSuffix(c.Global.TLSDir, "/") {
 			c.Logger.Println("CONFIG: The global.tlsdir directive is missing the ending slash '/'")
@@ -93,7 +112,7 @@ func (c *ServerConfig) verifyTLSConfig() int {
 		c.Logger.Println("CONFIG: The global.tlscrt directive is missing from the configuration file")
 		problemsFound++
 	} else {
-		file := c.Global.Prefix + c.Global.TLSDir + c.Global.TLSCrt
+		file := c.TLSPath(c.Global.TLSCrt)
 		if !c.exists(file) {
 			c.Logger.Println("CONFIG: The TLS Cert file", file, "can not be opened")
 			problemsFound++
@@ -104,12 +123,94 @@ func (c *ServerConfig) verifyTLSConfig() int {
 		c.Logger.Println("CONFIG: The global.tlskey directive is missing from the configuration file")
 		problemsFound++
 	} else {
-		file := c.Global.Prefix + c.Global.TLSDir + c.Global.TLSKey
+		file := c.TLSPath(c.Global.TLSKey)
 		if !c.exists(file) {
 			c.Logger.Println("CONFIG: The TLS Key file", file, "can not be opened")
 			problemsFound++
 		}
 	}
 
+	// TLS Versions - TLS 1.2 is the oldest version that is allowed and is the
+	// default, there is no maximum unless one is defined
+	if c.TLS.MinVersion == "" {
+		c.TLS.MinVersion = "1.2"
+	}
+	if v, found := tlsconfig.Version(c.TLS.MinVersion); found {
+		c.TLS.MinVersionID = v
+	} else {
+		c.Logger.Println("CONFIG: The tls.minversion directive " + c.TLS.MinVersion + " is not a known TLS version, use one of: " + strings.Join(tlsconfig.VersionNames(), ", "))
+		problemsFound++
+	}
+
+	if c.TLS.MaxVersion != "" {
+		if v, found := tlsconfig.Version(c.TLS.MaxVersion); found {
+			c.TLS.MaxVersionID = v
+		} else {
+			c.Logger.Println("CONFIG: The tls.maxversion directive " + c.TLS.MaxVersion + " is not a known TLS version, use one of: " + strings.Join(tlsconfig.VersionNames(), ", "))
+			problemsFound++
+		}
+
+		if c.TLS.MinVersionID != 0 && c.TLS.MaxVersionID != 0 && c.TLS.MaxVersionID < c.TLS.MinVersionID {
+			c.Logger.Println("CONFIG: The tls.maxversion directive " + c.TLS.MaxVersion + " is older than the tls.minversion directive " + c.TLS.MinVersion)
+			problemsFound++
+		}
+	}
+
+	// Cipher Suites - The cipher suites of TLS 1.3 can not be configured, so
+	// these are only used for TLS 1.2. Only ECDHE cipher suites with an AEAD
+	// cipher are allowed, and all of them are used if none are defined.
+	c.TLS.CipherSuiteIDs = nil
+	for _, name := range c.TLS.CipherSuites {
+		id, err := tlsconfig.CipherSuite(name)
+		if err == tlsconfig.ErrInsecureCipherSuite {
+			c.Logger.Println("CONFIG: The tls.ciphersuites value " + name + " is insecure and can not be used, only ECDHE cipher suites with AES-GCM or ChaCha20-Poly1305 are allowed")
+			problemsFound++
+		} else if err != nil {
+			c.Logger.Println("CONFIG: The tls.ciphersuites value " + name + " is not a known cipher suite, use one of: " + strings.Join(tlsconfig.CipherSuiteNames(), ", "))
+			problemsFound++
+		} else {
+			c.TLS.CipherSuiteIDs = append(c.TLS.CipherSuiteIDs, id)
+		}
+	}
+
+	if len(c.TLS.CipherSuites) == 0 {
+		c.TLS.CipherSuiteIDs = tlsconfig.DefaultCipherSuites()
+	}
+
+	if len(c.TLS.CipherSuites) > 0 && c.TLS.MinVersionID == tls.VersionTLS13 {
+		c.Logger.Println("CONFIG: The tls.ciphersuites directive is not used since tls.minversion is 1.3 and the TLS 1.3 cipher suites can not be configured")
+	}
+
+	// Curves - Go chooses them if none are defined
+	c.TLS.CurveIDs = nil
+	for _, name := range c.TLS.Curves {
+		if id, found := tlsconfig.Curve(name); found {
+			c.TLS.CurveIDs = append(c.TLS.CurveIDs, id)
+		} else {
+			c.Logger.Println("CONFIG: The tls.curves value " + name + " is not a known curve, use one of: " + strings.Join(tlsconfig.CurveNames(), ", "))
+			problemsFound++
+		}
+	}
+
+	// Session Ticket Rotation - Go rotates the session ticket keys on its own
+	// if no interval is defined
+	if c.TLS.SessionTicketRotation != "" {
+		d, err := time.ParseDuration(c.TLS.SessionTicketRotation)
+		if err != nil || d <= 0 {
+			c.Logger.Println("CONFIG: The tls.sessionticketrotation directive", c.TLS.SessionTicketRotation, "is not a valid duration, example: 12h")
+			problemsFound++
+		}
+		c.TLS.SessionTicketRotationDuration = d
+	}
+
+	// OCSP Staple File - The DER encoded OCSP response for the certificate
+	if c.TLS.OCSPStapleFile != "" {
+		file := c.TLSPath(c.TLS.OCSPStapleFile)
+		if !c.exists(file) {
+			c.Logger.Println("CONFIG: The TLS OCSP staple file", file, "can not be opened")
+			problemsFound++
+		}
+	}
+
 	return problemsFound
 }
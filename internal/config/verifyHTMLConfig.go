@@ -8,6 +8,8 @@ package config
 import (
 	"strconv"
 	"strings"
+
+	"github.com/freetaxii/server/internal/templates"
 )
 
 // ----------------------------------------
@@ -22,22 +24,31 @@ func (c *ServerConfig) verifyGlobalHTMLConfig() int {
 	var problemsFound = 0
 
 	// ----------------------------------------------------------------------
-	// Verify TemplateDir is defined and exists on the file system
+	// Verify TemplateDir exists on the file system
 	// ----------------------------------------------------------------------
-	// Check to see if the template directory is implicitly set to null ("") or
-	// explicitly set to null ("null"). When set explicitly to null that means
-	// it is also invalid.
+	// If the template directory is implicitly set to null ("") or explicitly
+	// set to null ("null") then the templates that are built in to the server
+	// are used.
 	if c.HTML.TemplateDir.Value == "" || c.HTML.TemplateDir.Valid == false {
-		c.Logger.Println("CONFIG: The global HTML configuration is missing the html.templatedir directive in the configuration file")
-		problemsFound++
+		c.HTML.FullTemplatePath = templates.BuiltIn
 	} else {
 		problemsFound += c.verifyHTMLTemplateDir("html.templatedir", c.HTML.TemplateDir)
-		c.HTML.FullTemplatePath = c.Global.Prefix + c.HTML.TemplateDir.Value
+		c.HTML.FullTemplatePath = c.Path(c.HTML.TemplateDir.Value)
 	}
 
 	// ----------------------------------------------------------------------
-	// Verify actual template files are defined and exist on the file system
+	// Verify actual template files exist on the file system
 	// ----------------------------------------------------------------------
+	// Template files that are not defined use the default file names
+	setDefaultHTMLTemplateFile(&c.HTML.TemplateFiles.Discovery, templates.Discovery)
+	setDefaultHTMLTemplateFile(&c.HTML.TemplateFiles.APIRoot, templates.APIRoot)
+	setDefaultHTMLTemplateFile(&c.HTML.TemplateFiles.Collections, templates.Collections)
+	setDefaultHTMLTemplateFile(&c.HTML.TemplateFiles.Collection, templates.Collection)
+	setDefaultHTMLTemplateFile(&c.HTML.TemplateFiles.Objects, templates.Objects)
+	setDefaultHTMLTemplateFile(&c.HTML.TemplateFiles.Versions, templates.Versions)
+	setDefaultHTMLTemplateFile(&c.HTML.TemplateFiles.Manifest, templates.Manifest)
+	setDefaultHTMLTemplateFile(&c.HTML.TemplateFiles.Error, templates.Error)
+
 	problemsFound += c.verifyGlobalHTMLTemplateFile("html.templatefiles.discovery", c.HTML.FullTemplatePath, c.HTML.TemplateFiles.Discovery)
 	problemsFound += c.verifyGlobalHTMLTemplateFile("html.templatefiles.apiroot", c.HTML.FullTemplatePath, c.HTML.TemplateFiles.APIRoot)
 	problemsFound += c.verifyGlobalHTMLTemplateFile("html.templatefiles.collections", c.HTML.FullTemplatePath, c.HTML.TemplateFiles.Collections)
@@ -45,6 +56,7 @@ func (c *ServerConfig) verifyGlobalHTMLConfig() int {
 	problemsFound += c.verifyGlobalHTMLTemplateFile("html.templatefiles.objects", c.HTML.FullTemplatePath, c.HTML.TemplateFiles.Objects)
 	problemsFound += c.verifyGlobalHTMLTemplateFile("html.templatefiles.versions", c.HTML.FullTemplatePath, c.HTML.TemplateFiles.Versions)
 	problemsFound += c.verifyGlobalHTMLTemplateFile("html.templatefiles.manifest", c.HTML.FullTemplatePath, c.HTML.TemplateFiles.Manifest)
+	problemsFound += c.verifyGlobalHTMLTemplateFile("html.templatefiles.error", c.HTML.FullTemplatePath, c.HTML.TemplateFiles.Error)
 
 	// ----------------------------------------------------------------------
 	// Return number of errors if there are any
@@ -67,7 +79,7 @@ func (c *ServerConfig) verifyHTMLTemplateDir(configPath string, templateDir JSON
 		problemsFound++
 	}
 
-	filepath := c.Global.Prefix + templateDir.Value
+	filepath := c.Path(templateDir.Value)
 	if !c.exists(filepath) {
 		c.Logger.Println("CONFIG: The HTML template path", filepath, "can not be opened")
 		problemsFound++
@@ -100,7 +112,8 @@ func (c *ServerConfig) verifyGlobalHTMLTemplateFile(configPath, templatePath str
 
 /*
 verifyHTMLTemplateFile - This method will verify that HTML template files are
-found on the file system.
+found on the file system, or are built in to the server when the template path
+is the one for the built in templates.
 */
 func (c *ServerConfig) verifyHTMLTemplateFile(configPath, templatePath string, template JSONstring) int {
 	var problemsFound = 0
@@ -111,6 +124,14 @@ func (c *ServerConfig) verifyHTMLTemplateFile(configPath, templatePath string, t
 		return problemsFound
 	}
 
+	if templatePath == templates.BuiltIn {
+		if !templates.Exists(template.Value) {
+			c.Logger.Println("CONFIG: The HTML template", template.Value, "defined at", configPath, "is not built in to the server, a template directory must be defined to use it")
+			problemsFound++
+		}
+		return problemsFound
+	}
+
 	filepath := templatePath + template.Value
 	if !c.exists(filepath) {
 		c.Logger.Println("CONFIG: The HTML template path", filepath, "defined at", configPath, " can not be opened")
@@ -161,7 +182,7 @@ func (c *ServerConfig) verifyDiscoveryHTMLConfig() int {
 			text := "discoveryserver.services[" + indexString + "].html.templatedir"
 			problemsFound += c.verifyHTMLTemplateDir(text, s.HTML.TemplateDir)
 			c.DiscoveryServer.Services[i].HTML.FullTemplatePath = c.HTML.FullTemplatePath
-			c.DiscoveryServer.Services[i].HTML.FullTemplatePath = c.Global.Prefix + s.HTML.TemplateDir.Value
+			c.DiscoveryServer.Services[i].HTML.FullTemplatePath = c.Path(s.HTML.TemplateDir.Value)
 		}
 
 		if s.HTML.TemplateFiles.Discovery.Set == false || s.HTML.TemplateFiles.Discovery.Valid == false {
@@ -169,7 +190,15 @@ func (c *ServerConfig) verifyDiscoveryHTMLConfig() int {
 		} else {
 			// If it was redefined we need to verify that it is found on the file system.
 			text := "discoveryserver.services[" + indexString + "].html.templatefiles.discovery"
-			problemsFound += c.verifyHTMLTemplateFile(text, s.HTML.FullTemplatePath, s.HTML.TemplateFiles.Discovery)
+			problemsFound += c.verifyHTMLTemplateFile(text, c.DiscoveryServer.Services[i].HTML.FullTemplatePath, s.HTML.TemplateFiles.Discovery)
+		}
+
+		if s.HTML.TemplateFiles.Error.Set == false || s.HTML.TemplateFiles.Error.Valid == false {
+			c.DiscoveryServer.Services[i].HTML.TemplateFiles.Error = c.HTML.TemplateFiles.Error
+		} else {
+			// If it was redefined we need to verify that it is found on the file system.
+			text := "discoveryserver.services[" + indexString + "].html.templatefiles.error"
+			problemsFound += c.verifyHTMLTemplateFile(text, c.DiscoveryServer.Services[i].HTML.FullTemplatePath, s.HTML.TemplateFiles.Error)
 		}
 	} // End for loop
 
@@ -223,7 +252,7 @@ func (c *ServerConfig) verifyAPIRootHTMLConfig() int {
 			text := "apirootserver.services[" + indexString + "].html.templatedir"
 			problemsFound += c.verifyHTMLTemplateDir(text, s.HTML.TemplateDir)
 			c.APIRootServer.Services[i].HTML.FullTemplatePath = c.HTML.FullTemplatePath
-			c.APIRootServer.Services[i].HTML.FullTemplatePath = c.Global.Prefix + s.HTML.TemplateDir.Value
+			c.APIRootServer.Services[i].HTML.FullTemplatePath = c.Path(s.HTML.TemplateDir.Value)
 		}
 
 		if s.HTML.TemplateFiles.APIRoot.Set == false || s.HTML.TemplateFiles.APIRoot.Valid == false {
@@ -231,7 +260,7 @@ func (c *ServerConfig) verifyAPIRootHTMLConfig() int {
 		} else {
 			// If it was redefined we need to verify that it is found on the file system.
 			text := "apirootserver.services[" + indexString + "].html.templatefiles.apiroot"
-			problemsFound += c.verifyHTMLTemplateFile(text, s.HTML.FullTemplatePath, s.HTML.TemplateFiles.APIRoot)
+			problemsFound += c.verifyHTMLTemplateFile(text, c.APIRootServer.Services[i].HTML.FullTemplatePath, s.HTML.TemplateFiles.APIRoot)
 		}
 
 		if s.HTML.TemplateFiles.Collections.Set == false || s.HTML.TemplateFiles.Collections.Valid == false {
@@ -239,7 +268,7 @@ func (c *ServerConfig) verifyAPIRootHTMLConfig() int {
 		} else {
 			// If it was redefined we need to verify that it is found on the file system.
 			text := "apirootserver.services[" + indexString + "].html.templatefiles.collections"
-			problemsFound += c.verifyHTMLTemplateFile(text, s.HTML.FullTemplatePath, s.HTML.TemplateFiles.Collections)
+			problemsFound += c.verifyHTMLTemplateFile(text, c.APIRootServer.Services[i].HTML.FullTemplatePath, s.HTML.TemplateFiles.Collections)
 		}
 
 		if s.HTML.TemplateFiles.Collection.Set == false || s.HTML.TemplateFiles.Collection.Valid == false {
@@ -247,7 +276,7 @@ func (c *ServerConfig) verifyAPIRootHTMLConfig() int {
 		} else {
 			// If it was redefined we need to verify that it is found on the file system.
 			text := "apirootserver.services[" + indexString + "].html.templatefiles.collection"
-			problemsFound += c.verifyHTMLTemplateFile(text, s.HTML.FullTemplatePath, s.HTML.TemplateFiles.Collection)
+			problemsFound += c.verifyHTMLTemplateFile(text, c.APIRootServer.Services[i].HTML.FullTemplatePath, s.HTML.TemplateFiles.Collection)
 		}
 
 		if s.HTML.TemplateFiles.Objects.Set == false || s.HTML.TemplateFiles.Objects.Valid == false {
@@ -255,7 +284,7 @@ func (c *ServerConfig) verifyAPIRootHTMLConfig() int {
 		} else {
 			// If it was redefined we need to verify that it is found on the file system.
 			text := "apirootserver.services[" + indexString + "].html.templatefiles.objects"
-			problemsFound += c.verifyHTMLTemplateFile(text, s.HTML.FullTemplatePath, s.HTML.TemplateFiles.Objects)
+			problemsFound += c.verifyHTMLTemplateFile(text, c.APIRootServer.Services[i].HTML.FullTemplatePath, s.HTML.TemplateFiles.Objects)
 		}
 
 		if s.HTML.TemplateFiles.Versions.Set == false || s.HTML.TemplateFiles.Versions.Valid == false {
@@ -263,7 +292,7 @@ func (c *ServerConfig) verifyAPIRootHTMLConfig() int {
 		} else {
 			// If it was redefined we need to verify that it is found on the file system.
 			text := "apirootserver.services[" + indexString + "].html.templatefiles.versions"
-			problemsFound += c.verifyHTMLTemplateFile(text, s.HTML.FullTemplatePath, s.HTML.TemplateFiles.Versions)
+			problemsFound += c.verifyHTMLTemplateFile(text, c.APIRootServer.Services[i].HTML.FullTemplatePath, s.HTML.TemplateFiles.Versions)
 		}
 
 		if s.HTML.TemplateFiles.Manifest.Set == false || s.HTML.TemplateFiles.Manifest.Valid == false {
@@ -271,7 +300,15 @@ func (c *ServerConfig) verifyAPIRootHTMLConfig() int {
 		} else {
 			// If it was redefined we need to verify that it is found on the file system.
 			text := "apirootserver.services[" + indexString + "].html.templatefiles.manifest"
-			problemsFound += c.verifyHTMLTemplateFile(text, s.HTML.FullTemplatePath, s.HTML.TemplateFiles.Manifest)
+			problemsFound += c.verifyHTMLTemplateFile(text, c.APIRootServer.Services[i].HTML.FullTemplatePath, s.HTML.TemplateFiles.Manifest)
+		}
+
+		if s.HTML.TemplateFiles.Error.Set == false || s.HTML.TemplateFiles.Error.Valid == false {
+			c.APIRootServer.Services[i].HTML.TemplateFiles.Error = c.HTML.TemplateFiles.Error
+		} else {
+			// If it was redefined we need to verify that it is found on the file system.
+			text := "apirootserver.services[" + indexString + "].html.templatefiles.error"
+			problemsFound += c.verifyHTMLTemplateFile(text, c.APIRootServer.Services[i].HTML.FullTemplatePath, s.HTML.TemplateFiles.Error)
 		}
 	} // End for loop
 
@@ -283,3 +320,18 @@ func (c *ServerConfig) verifyAPIRootHTMLConfig() int {
 	}
 	return problemsFound
 }
+
+// ----------------------------------------
+// Private Functions
+// ----------------------------------------
+
+/*
+setDefaultHTMLTemplateFile - This function will set a template file that is not
+defined in the configuration file to its default file name.
+*/
+func setDefaultHTMLTemplateFile(template *JSONstring, name string) {
+	if template.Value == "" || template.Valid == false {
+		template.Value = name
+		template.Valid = true
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+verifyIngestConfig - This method will verify all of the configuration
+directives for the directory ingest service and will return the number of
+errors found.
+*/
+func (c *ServerConfig) verifyIngestConfig() int {
+	var problemsFound = 0
+
+	// This variable will track if any of the actual ingest services are
+	// enabled. If the outer service says yes, but no actual services are
+	// enabled, throw an error.
+	var isServiceEnabled = false
+
+	if c.IngestServer.Interval == "" {
+		c.Logger.Println("CONFIG: The ingest_server.interval directive is missing from the configuration file")
+		problemsFound++
+	} else {
+		d, err := time.ParseDuration(c.IngestServer.Interval)
+		if err != nil || d <= 0 {
+			c.Logger.Println("CONFIG: The ingest_server.interval directive", c.IngestServer.Interval, "is not a valid duration, example: 30s")
+			problemsFound++
+		}
+		c.IngestServer.IntervalDuration = d
+	}
+
+	for i, value := range c.IngestServer.Services {
+		indexString := strconv.Itoa(i)
+
+		// Check to see if this service instance is enabled.
+		if value.Enabled == true {
+			isServiceEnabled = true
+		}
+
+		// Verify the directory is defined and found on the file system
+		if value.Directory == "" {
+			c.Logger.Println("CONFIG: The ingest_server.services[" + indexString + "] is missing the 'directory' directive in the configuration file")
+			problemsFound++
+		} else {
+			if !strings.HasSuffix(value.Directory, "/") {
+				c.Logger.Println("CONFIG: The ingest_server.services[" + indexString + "].directory directive is missing the ending slash '/'")
+				problemsFound++
+			}
+
+			filepath := c.Path(value.Directory)
+			if !c.exists(filepath) {
+				c.Logger.Println("CONFIG: The ingest directory", filepath, "can not be opened")
+				problemsFound++
+			}
+		}
+
+		// Verify the Collection Resource that is referenced actually exists
+		if _, ok := c.CollectionResources[value.ResourceID]; !ok {
+			c.Logger.Println("CONFIG: The ingest_server.services[" + indexString + "] is using a collection of " + value.ResourceID + " that is missing from the configuration file")
+			problemsFound++
+		}
+	}
+
+	// Log an error if there are no ingest services actually enabled.
+	if isServiceEnabled == false {
+		c.Logger.Println("CONFIG: While the Ingest Server is enabled, there are no Ingest Services that are enabled")
+		problemsFound++
+	}
+
+	// Return errors if there were any
+	if problemsFound > 0 {
+		c.Logger.Println("ERROR: The Ingest configuration has", problemsFound, "error(s)")
+	}
+	return problemsFound
+}
@@ -0,0 +1,89 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package config
+
+import (
+	"github.com/freetaxii/server/internal/markings"
+)
+
+/*
+verifyMarkingsConfig - This method will verify the marking policy of each
+collection resource and will return the number of errors found. The TLP names
+in each policy are changed to their marking-definition ids.
+*/
+func (c *ServerConfig) verifyMarkingsConfig() int {
+	var problemsFound = 0
+
+	for key, value := range c.CollectionResources {
+		if value.Markings.Enabled == false {
+			continue
+		}
+		text := "collection_resources." + key + ".markings"
+
+		allowed, problems := c.verifyMarkingList(text+".allowed", value.Markings.Allowed)
+		problemsFound += problems
+		value.Markings.Allowed = allowed
+
+		defaults, problems := c.verifyMarkingList(text+".default", value.Markings.Default)
+		problemsFound += problems
+		value.Markings.Default = defaults
+
+		// Objects that get the default markings must still be allowed in the
+		// collection, otherwise every unmarked object would be rejected
+		if len(allowed) > 0 {
+			for _, v := range defaults {
+				if !inList(allowed, v) {
+					c.Logger.Println("CONFIG: The " + text + ".default marking " + v + " is not in the " + text + ".allowed list")
+					problemsFound++
+				}
+			}
+		}
+
+		// Map values can not be updated in place so write the copy back
+		c.CollectionResources[key] = value
+	}
+
+	// ----------------------------------------------------------------------
+	// Return number of errors if there are any
+	// ----------------------------------------------------------------------
+	if problemsFound > 0 {
+		c.Logger.Println("ERROR: The Markings configuration has", problemsFound, "error(s)")
+	}
+	return problemsFound
+}
+
+/*
+verifyMarkingList - This method will check that each entry of a list of
+markings is a TLP name or a marking-definition id and return the list of ids
+along with the number of errors found.
+*/
+func (c *ServerConfig) verifyMarkingList(text string, list []string) ([]string, int) {
+	var problemsFound = 0
+	var ids []string
+
+	for _, v := range list {
+		id, ok := markings.ID(v)
+		if !ok {
+			c.Logger.Println("CONFIG: The " + text + " marking " + v + " is not a TLP name or a marking-definition id")
+			problemsFound++
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, problemsFound
+}
+
+/*
+inList - This function will return true if the value is in the list.
+*/
+func inList(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package config
+
+import (
+	"time"
+)
+
+/*
+verifyRetentionConfig - This method will verify the retention job interval and
+the retention policy of each collection resource and will return the number of
+errors found. It will also populate the parsed durations.
+*/
+func (c *ServerConfig) verifyRetentionConfig() int {
+	var problemsFound = 0
+
+	if c.Retention.Interval == "" {
+		c.Logger.Println("CONFIG: The retention.interval directive is missing from the configuration file")
+		problemsFound++
+	} else {
+		d, err := time.ParseDuration(c.Retention.Interval)
+		if err != nil || d <= 0 {
+			c.Logger.Println("CONFIG: The retention.interval directive", c.Retention.Interval, "is not a valid duration, example: 24h")
+			problemsFound++
+		}
+		c.Retention.IntervalDuration = d
+	}
+
+	for key, value := range c.CollectionResources {
+		if value.Retention.Enabled == false {
+			continue
+		}
+
+		if value.Retention.MaxAge != "" {
+			d, err := time.ParseDuration(value.Retention.MaxAge)
+			if err != nil || d <= 0 {
+				c.Logger.Println("CONFIG: The collection_resources." + key + ".retention.maxage directive " + value.Retention.MaxAge + " is not a valid duration, example: 2160h")
+				problemsFound++
+			}
+			value.Retention.MaxAgeDuration = d
+		}
+
+		if value.Retention.MaxVersions < 0 {
+			c.Logger.Println("CONFIG: The collection_resources." + key + ".retention.maxversions directive can not be negative")
+			problemsFound++
+		}
+
+		if value.Retention.MaxAge == "" && value.Retention.DropExpiredIndicators == false && value.Retention.MaxVersions == 0 {
+			c.Logger.Println("CONFIG: The retention policy for collection_resources." + key + " is enabled but does not define maxage, dropexpiredindicators, or maxversions")
+			problemsFound++
+		}
+
+		// Map values can not be updated in place so write the copy back
+		c.CollectionResources[key] = value
+	}
+
+	// ----------------------------------------------------------------------
+	// Return number of errors if there are any
+	// ----------------------------------------------------------------------
+	if problemsFound > 0 {
+		c.Logger.Println("ERROR: The Retention configuration has", problemsFound, "error(s)")
+	}
+	return problemsFound
+}
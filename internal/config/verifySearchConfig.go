@@ -0,0 +1,28 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package config
+
+/*
+verifySearchConfig - This method will verify that the datastore can keep a
+search index and will return the number of errors found.
+*/
+func (c *ServerConfig) verifySearchConfig() int {
+	var problemsFound = 0
+
+	// The search index is only implemented for the sqlite3 datastore
+	if c.Global.DbType != "sqlite3" {
+		c.Logger.Println("CONFIG: The search directive is only supported with the sqlite3 dbtype")
+		problemsFound++
+	}
+
+	// ----------------------------------------------------------------------
+	// Return number of errors if there are any
+	// ----------------------------------------------------------------------
+	if problemsFound > 0 {
+		c.Logger.Println("ERROR: The Search configuration has", problemsFound, "error(s)")
+	}
+	return problemsFound
+}
@@ -0,0 +1,97 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package config
+
+import (
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+)
+
+// These are the values that are used when the webhooks section of the
+// configuration file does not define them.
+const (
+	DefaultWebhookMaxAttempts = 5
+	DefaultWebhookBackoff     = "10s"
+)
+
+/*
+verifyWebhooksConfig - This method will verify the webhooks of each collection
+resource along with the global webhook delivery settings and will return the
+number of errors found. Delivery settings that are not defined are set to their
+defaults.
+*/
+func (c *ServerConfig) verifyWebhooksConfig() int {
+	var problemsFound = 0
+
+	if c.Webhooks.MaxAttempts == 0 {
+		c.Webhooks.MaxAttempts = DefaultWebhookMaxAttempts
+	} else if c.Webhooks.MaxAttempts < 0 {
+		c.Logger.Println("CONFIG: The webhooks.maxattempts directive can not be negative")
+		problemsFound++
+	}
+
+	if c.Webhooks.Backoff == "" {
+		c.Webhooks.Backoff = DefaultWebhookBackoff
+	}
+	d, err := time.ParseDuration(c.Webhooks.Backoff)
+	if err != nil || d <= 0 {
+		c.Logger.Println("CONFIG: The webhooks.backoff directive", c.Webhooks.Backoff, "is not a valid duration, example: 10s")
+		problemsFound++
+	}
+	c.Webhooks.BackoffDuration = d
+
+	if c.Webhooks.DeadLetterFile != "" {
+		dir := path.Dir(c.Path(c.Webhooks.DeadLetterFile))
+		if !c.exists(dir) {
+			c.Logger.Println("CONFIG: The directory", dir, "for the webhooks.deadletterfile directive can not be opened")
+			problemsFound++
+		}
+	}
+
+	for key, value := range c.CollectionResources {
+		for i, hook := range value.Webhooks {
+			if hook.Enabled == false {
+				continue
+			}
+			text := "collection_resources." + key + ".webhooks[" + strconv.Itoa(i) + "]"
+
+			u, err := url.Parse(hook.URL)
+			if hook.URL == "" || err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				c.Logger.Println("CONFIG: The " + text + ".url directive must be an http or https URL")
+				problemsFound++
+			}
+
+			if hook.Secret == "" {
+				c.Logger.Println("CONFIG: The " + text + " does not define a secret, notifications will not be signed")
+			}
+		}
+	}
+
+	// ----------------------------------------------------------------------
+	// Return number of errors if there are any
+	// ----------------------------------------------------------------------
+	if problemsFound > 0 {
+		c.Logger.Println("ERROR: The Webhooks configuration has", problemsFound, "error(s)")
+	}
+	return problemsFound
+}
+
+/*
+WebhooksEnabled - This method will return true if any collection resource has
+a webhook that is enabled.
+*/
+func (c *ServerConfig) WebhooksEnabled() bool {
+	for _, value := range c.CollectionResources {
+		for _, hook := range value.Webhooks {
+			if hook.Enabled == true {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package envelopes
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/freetaxii/libstix2/resources/collections"
+)
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Boundary - This type moves the added_after value of a query from one page of
+records to the next. The added_after URL parameter only finds records that
+were added after the time given, so the records that share the date_added of
+the last record of a page, but did not fit on it, would never be read if the
+next page started after that date_added. The next page starts just before it
+instead, and the records that were already read are skipped.
+
+DateAdded - The date_added of the last record that was read
+*/
+type Boundary struct {
+	DateAdded string
+	seen      map[string]bool
+	page      map[string]bool
+	fresh     int
+	extra     int
+}
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+Before - This function will return the timestamp that comes right before the
+one provided, in the same precision, so that an added_after of the result
+finds the records that were added at the time provided. The timestamp is
+returned as it is if it can not be parsed.
+*/
+func Before(timestamp string) string {
+	t, err := time.Parse(time.RFC3339Nano, timestamp)
+	if err != nil || !strings.HasSuffix(timestamp, "Z") {
+		return timestamp
+	}
+
+	digits := 0
+	if i := strings.Index(timestamp, "."); i >= 0 {
+		digits = len(timestamp) - i - 2
+	}
+
+	unit := time.Second
+	layout := "2006-01-02T15:04:05"
+	if digits > 0 {
+		layout += "." + strings.Repeat("0", digits)
+		for i := 0; i < digits; i++ {
+			unit /= 10
+		}
+	}
+	return t.Add(-unit).UTC().Format(layout + "Z")
+}
+
+/*
+Key - This function will return the id and the version of an object from the
+datastore, joined with a "|", which identifies it in a collection. The version
+is the modified timestamp, or the created timestamp for objects that are not
+versioned.
+*/
+func Key(o interface{}) string {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	}
+
+	var v struct {
+		ID       string `json:"id"`
+		Created  string `json:"created"`
+		Modified string `json:"modified"`
+	}
+	json.Unmarshal(data, &v)
+
+	if v.Modified != "" {
+		return v.ID + "|" + v.Modified
+	}
+	return v.ID + "|" + v.Created
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Boundary
+// ----------------------------------------------------------------------
+
+/*
+Limit - This method will return the number of records to ask for so that the
+next page has the size provided after the records that were already read are
+skipped. It is only larger than the size when more than a page of records
+share the same date_added. It is never so large that more than size records
+that were not read yet are returned.
+*/
+func (b *Boundary) Limit(size int) int {
+	return size + b.extra
+}
+
+/*
+Add - This method will record that a record of the current page was read and
+return false if it was already read on an earlier page, so it should be
+skipped.
+*/
+func (b *Boundary) Add(key string) bool {
+	if b.page == nil {
+		b.page = make(map[string]bool)
+	}
+	b.page[key] = true
+
+	if b.seen[key] == true {
+		return false
+	}
+	b.fresh++
+	return true
+}
+
+/*
+Advance - This method will move the query to the page after the current one,
+whose last record has the date_added provided. Every record of the current page
+must have been given to Add.
+*/
+func (b *Boundary) Advance(q *collections.CollectionQuery, dateAddedLast string) {
+	page, fresh := b.page, b.fresh
+	b.page, b.fresh = nil, 0
+
+	if dateAddedLast == "" {
+		return
+	}
+
+	if dateAddedLast != b.DateAdded {
+		b.DateAdded = dateAddedLast
+		b.seen = page
+		b.extra = 0
+		q.AddedAfter = []string{Before(dateAddedLast)}
+		return
+	}
+
+	// The page ended at the same date_added as the one before it. If a larger
+	// page did not get past the records that were already read, the datastore
+	// will not return more at a time, so move on after the date_added.
+	if fresh == 0 && b.extra > 0 {
+		b.seen = nil
+		b.extra = 0
+		q.AddedAfter = []string{dateAddedLast}
+		return
+	}
+
+	// Every record of the page shares the date_added, so they are all read
+	// again by the next page, which must be larger by that many
+	if b.seen == nil {
+		b.seen = make(map[string]bool)
+	}
+	for k := range page {
+		b.seen[k] = true
+	}
+	b.extra = len(page)
+	q.AddedAfter = []string{Before(dateAddedLast)}
+}
@@ -0,0 +1,20 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package envelopes sends the objects of a collection to a client without
+holding more than one page in memory. A Pager reads the objects from the
+datastore a small page at a time, until the limit of the response, and a Writer
+encodes each page in to the TAXII envelope, or TAXII 2.0 bundle, as soon as it
+is read. The more and next properties are written after the objects, once they
+are known. The next property, from NextPage, lets the client continue at the
+last date_added without losing or repeating the objects that share it. Manifest
+and Versions read manifest records and object versions the same way, with a
+filter applied to each page, until a response has as many as the client asked
+for. EachVersion reads the content behind manifest records. A Boundary moves a
+query from one page to the next without losing the records that share the
+date_added of the last record of a page.
+*/
+package envelopes
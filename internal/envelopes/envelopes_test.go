@@ -0,0 +1,307 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package envelopes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/libstix2/resources/manifest"
+	"github.com/freetaxii/server/internal/storetest"
+)
+
+// numbered - This function returns a datastore with a number of objects that
+// were each added one second after the other.
+func numbered(total int) *storetest.Store {
+	ds := storetest.New()
+	for i := 0; i < total; i++ {
+		ds.Add("1234", fmt.Sprintf("2018-01-01T00:00:%02d.000000Z", i), fmt.Sprintf(`{"id": "indicator--%d", "n": %d}`, i, i))
+	}
+	return ds
+}
+
+// ----------------------------------------------------------------------
+func Test_Pager(t *testing.T) {
+	ds := numbered(25)
+	q := collections.NewCollectionQuery("1234", 0)
+	q.Limit = []string{"12"}
+
+	p := New(ds, *q, 20)
+	p.PageSize = 5
+
+	// Remove the odd objects so that more pages are needed to reach the limit
+	p.Filter = func(objects []interface{}) []interface{} {
+		var result []interface{}
+		for _, o := range objects {
+			var v struct{ N int }
+			json.Unmarshal(o.(json.RawMessage), &v)
+			if v.N%2 == 0 {
+				result = append(result, o)
+			}
+		}
+		return result
+	}
+
+	var count int
+	for {
+		page, err := p.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page == nil {
+			break
+		}
+		count += len(page)
+	}
+
+	if count != 12 || p.More != true {
+		t.Errorf("got %d objects and more %v want 12 and true", count, p.More)
+	}
+	if p.DateAddedFirst != "2018-01-01T00:00:00.000000Z" || p.DateAddedLast != "2018-01-01T00:00:22.000000Z" {
+		t.Errorf("wrong date_added range %s to %s", p.DateAddedFirst, p.DateAddedLast)
+	}
+
+	if _, err := New(storetest.New(), *q, 20).Next(); err == nil {
+		t.Error("an empty query should return the error of the datastore")
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Before(t *testing.T) {
+	tests := []struct {
+		timestamp string
+		want      string
+	}{
+		{"2018-01-01T00:00:00.000000Z", "2017-12-31T23:59:59.999999Z"},
+		{"2018-01-01T00:00:01.500Z", "2018-01-01T00:00:01.499Z"},
+		{"2018-01-01T00:00:01Z", "2018-01-01T00:00:00Z"},
+		{"not a timestamp", "not a timestamp"},
+	}
+
+	for _, tt := range tests {
+		if got := Before(tt.timestamp); got != tt.want {
+			t.Errorf("%s: got %s want %s", tt.timestamp, got, tt.want)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Boundary(t *testing.T) {
+	// Seven objects share a date_added, which is more than fit on a page, and
+	// the datastore will not return more than four at a time
+	ds := numbered(3)
+	for i := 3; i < 10; i++ {
+		ds.Add("1234", "2018-01-01T00:00:03.000000Z", fmt.Sprintf(`{"id": "indicator--%d"}`, i))
+	}
+	ds.Add("1234", "2018-01-01T00:00:04.000000Z", `{"id": "indicator--10"}`)
+
+	for _, max := range []int{0, 4} {
+		q := collections.NewCollectionQuery("1234", max)
+		var b Boundary
+		var got []string
+		for {
+			q.Limit = []string{strconv.Itoa(b.Limit(3))}
+			results, err := ds.GetObjects(*q)
+			if err != nil {
+				break
+			}
+			fresh := 0
+			for _, o := range results.ObjectData.Objects {
+				if key := Key(o); b.Add(key) {
+					got = append(got, key)
+					fresh++
+				}
+			}
+			if fresh > 3 {
+				t.Errorf("datastore limit %d: a page has %d new objects, more than 3", max, fresh)
+			}
+			if results.ObjectData.More == false {
+				break
+			}
+			b.Advance(q, results.DateAddedLast)
+		}
+
+		// With the limit of the datastore the rest of the objects that share
+		// the date_added are skipped, but nothing is read twice
+		want := 11
+		if max > 0 {
+			want = 8
+		}
+		if len(got) != want {
+			t.Errorf("datastore limit %d: got %d objects want %d: %v", max, len(got), want, got)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_ParseNext(t *testing.T) {
+	tests := []struct {
+		next       string
+		addedAfter string
+		skip       int
+		ok         bool
+	}{
+		{"2018-01-01T00:00:03.000000Z", "2018-01-01T00:00:03.000000Z", 0, true},
+		{"2018-01-01T00:00:03.000000Z~2", "2018-01-01T00:00:02.999999Z", 2, true},
+		{"2018-01-01T00:00:03.000000Z~", "", 0, false},
+		{"2018-01-01T00:00:03.000000Z~-1", "", 0, false},
+		{"yesterday~2", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		addedAfter, skip, ok := ParseNext(tt.next)
+		if addedAfter != tt.addedAfter || skip != tt.skip || ok != tt.ok {
+			t.Errorf("%s: got %s %d %v want %s %d %v", tt.next, addedAfter, skip, ok, tt.addedAfter, tt.skip, tt.ok)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_PagerNextPage(t *testing.T) {
+	// Seven objects share a date_added, so every response ends in the middle
+	// of them until they are all sent
+	ds := numbered(3)
+	for i := 3; i < 10; i++ {
+		ds.Add("1234", "2018-01-01T00:00:03.000000Z", fmt.Sprintf(`{"id": "indicator--%d"}`, i))
+	}
+	ds.Add("1234", "2018-01-01T00:00:04.000000Z", `{"id": "indicator--10"}`)
+
+	got := make(map[string]int)
+	next := ""
+	for responses := 0; responses < 10; responses++ {
+		q := collections.NewCollectionQuery("1234", 0)
+		addedAfter, skip, _ := ParseNext(next)
+		if addedAfter != "" {
+			q.AddedAfter = []string{addedAfter}
+		}
+
+		p := New(ds, *q, 4)
+		p.PageSize = 2
+		p.Skip = skip
+
+		for page, _ := p.Next(); page != nil; page, _ = p.Next() {
+			for _, o := range page {
+				got[Key(o)]++
+			}
+		}
+		if next = p.NextPage(); next == "" {
+			break
+		}
+	}
+
+	if len(got) != 11 {
+		t.Errorf("got %d objects want 11: %v", len(got), got)
+	}
+	for k, n := range got {
+		if n != 1 {
+			t.Errorf("%s was sent %d times", k, n)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Writer(t *testing.T) {
+	objects := []interface{}{
+		map[string]interface{}{"type": "indicator", "id": "indicator--1", "labels": []interface{}{"a", "b"}},
+		map[string]interface{}{"type": "malware", "id": "malware--1"},
+	}
+
+	tests := []struct {
+		objects []interface{}
+		more    bool
+		next    string
+		want    map[string]interface{}
+	}{
+		{nil, false, "", map[string]interface{}{}},
+		{objects, false, "", map[string]interface{}{"objects": objects}},
+		{objects, true, "2018", map[string]interface{}{"objects": objects, "more": true, "next": "2018"}},
+		{nil, true, "", map[string]interface{}{"more": true}},
+	}
+
+	for i, tt := range tests {
+		for _, indent := range []string{"", "    "} {
+			var b bytes.Buffer
+			e := NewWriter(&b, indent)
+			for _, o := range tt.objects {
+				e.WriteObject(o)
+			}
+			if err := e.Close(tt.more, tt.next); err != nil {
+				t.Fatal(err)
+			}
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+				t.Errorf("test %d indent %q: invalid JSON %v: %s", i, indent, err, b.String())
+				continue
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("test %d indent %q: got %v want %v", i, indent, got, tt.want)
+			}
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_BundleWriter(t *testing.T) {
+	var b bytes.Buffer
+	e := NewBundleWriter(&b, "bundle--1", "")
+	e.WriteObject(map[string]string{"id": "indicator--1"})
+	e.Close(true, "ignored")
+
+	want := `{"type":"bundle","id":"bundle--1","spec_version":"2.0","objects":[{"id":"indicator--1"}]}` + "\n"
+	if b.String() != want {
+		t.Errorf("got %s want %s", b.String(), want)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Manifest(t *testing.T) {
+	ds := numbered(10)
+	q := collections.NewCollectionQuery("1234", 0)
+	q.Limit = []string{"1"}
+
+	// Remove the odd objects, the limit is the number of records that are
+	// left and not the number that is read
+	even := func(records []manifest.ManifestRecord) []manifest.ManifestRecord {
+		var result []manifest.ManifestRecord
+		for _, r := range records {
+			var n int
+			fmt.Sscanf(r.ID, "indicator--%d", &n)
+			if n%2 == 0 {
+				result = append(result, r)
+			}
+		}
+		return result
+	}
+
+	results, err := Manifest(ds, *q, 3, even)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := results.ManifestData.Objects
+	if len(records) != 3 || records[2].ID != "indicator--4" || results.ManifestData.More != true {
+		t.Fatalf("wrong first page: %+v", results.ManifestData)
+	}
+	if results.DateAddedLast != "2018-01-01T00:00:04.000000Z" {
+		t.Errorf("wrong date_added of the last record: %s", results.DateAddedLast)
+	}
+
+	// The next page starts at the date_added of the last record
+	q.AddedAfter = []string{Before(results.DateAddedLast)}
+	results, err = Manifest(ds, *q, 10, even)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records = results.ManifestData.Objects
+	if len(records) != 3 || records[0].ID != "indicator--4" || records[2].ID != "indicator--8" || results.ManifestData.More != false {
+		t.Errorf("wrong second page: %+v", results.ManifestData)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package envelopes
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/freetaxii/libstix2/datastore"
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/libstix2/timestamp"
+)
+
+// DefaultPageSize - The number of objects that are read from the datastore at
+// a time.
+const DefaultPageSize = 100
+
+// DefaultResponseLimit - The most objects that are sent in one response when
+// neither the server nor the client set a limit.
+const DefaultResponseLimit = 1000
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Pager - This type reads the objects that a collection query finds from the
+datastore one page at a time. A Boundary moves the query from one page to the
+next, so the objects that share the date_added of the last object of a page
+are not lost, and only one page is held in memory.
+
+Query          - The query of the client, added_after moves forward as pages are read
+Limit          - The most objects that are returned in total
+PageSize       - The most objects that are read from the datastore at a time
+Skip           - The number of records at the start of the first page that were already sent
+Filter         - If defined, removes objects from each page before they are counted
+DateAddedFirst - The date_added of the first object that was read
+DateAddedLast  - The date_added of the last object that was read
+More           - Are there more objects after the last one that was returned
+*/
+type Pager struct {
+	DS             datastore.Datastorer
+	Query          collections.CollectionQuery
+	Limit          int
+	PageSize       int
+	Skip           int
+	Filter         func(objects []interface{}) []interface{}
+	DateAddedFirst string
+	DateAddedLast  string
+	More           bool
+	count          int
+	done           bool
+	boundary       Boundary
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+New - This function will create a new Pager for the query provided. The limit
+of the query is used if it is smaller than the limit provided, which is the
+record limit of the server.
+*/
+func New(ds datastore.Datastorer, q collections.CollectionQuery, limit int) *Pager {
+	var p Pager
+	p.DS = ds
+	p.Query = q
+	p.Limit = RecordLimit(q, limit)
+	p.PageSize = DefaultPageSize
+	return &p
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Pager
+// ----------------------------------------------------------------------
+
+/*
+Next - This method will return the next page of objects, or nil when there are
+no more. The error of the datastore is returned for any page, for the first
+page it can mean that the query does not find anything. After an error there
+are no more pages, but More and DateAddedLast are left as they were for the
+last page that was returned, so NextPage still continues after it. Pages that
+are empty after the filter are skipped.
+*/
+func (p *Pager) Next() ([]interface{}, error) {
+	for p.done == false {
+		size := p.PageSize
+		if p.Limit > 0 && p.Limit-p.count < size {
+			size = p.Limit - p.count
+		}
+		p.Query.Limit = []string{strconv.Itoa(p.boundary.Limit(size) + p.Skip)}
+
+		results, err := p.DS.GetObjects(p.Query)
+		if err != nil {
+			p.done = true
+			return nil, err
+		}
+		if results == nil {
+			p.done = true
+			p.More = false
+			return nil, nil
+		}
+
+		if p.DateAddedFirst == "" {
+			p.DateAddedFirst = results.DateAddedFirst
+		}
+		if results.DateAddedLast != "" {
+			p.DateAddedLast = results.DateAddedLast
+		}
+
+		// The records that the client already has, either from the last
+		// response or from the last page, are skipped
+		var objects []interface{}
+		for _, o := range results.ObjectData.Objects {
+			fresh := p.boundary.Add(Key(o))
+			if p.Skip > 0 {
+				p.Skip--
+				continue
+			}
+			if fresh == true {
+				objects = append(objects, o)
+			}
+		}
+		p.boundary.Advance(&p.Query, results.DateAddedLast)
+
+		p.More = results.ObjectData.More
+		if p.More == false || results.DateAddedLast == "" {
+			p.done = true
+		}
+
+		if p.Filter != nil {
+			objects = p.Filter(objects)
+		}
+		p.count += len(objects)
+		if p.Limit > 0 && p.count >= p.Limit {
+			p.done = true
+		}
+
+		if len(objects) > 0 {
+			return objects, nil
+		}
+	}
+	return nil, nil
+}
+
+/*
+NextPage - This method will return the value of the next URL parameter that
+continues after the objects that were returned, or an empty string when there
+are no more. It is the date_added of the last object and the number of records
+with that date_added that were already read, see ParseNext. The number is found
+with one more query, since the objects themselves do not have a date_added.
+*/
+func (p *Pager) NextPage() string {
+	if p.More == false || p.DateAddedLast == "" {
+		return ""
+	}
+
+	// The query already moved on after the date_added, since the datastore
+	// would not return more records that share it at a time
+	if p.boundary.seen == nil {
+		return p.DateAddedLast
+	}
+
+	q := p.Query
+	q.AddedAfter = []string{Before(p.DateAddedLast)}
+	q.Limit = []string{strconv.Itoa(len(p.boundary.seen))}
+
+	read := 0
+	results, err := p.DS.GetObjects(q)
+	if err == nil && results != nil {
+		for _, o := range results.ObjectData.Objects {
+			if p.boundary.seen[Key(o)] == false {
+				break
+			}
+			read++
+		}
+	}
+	return p.DateAddedLast + "~" + strconv.Itoa(read)
+}
+
+/*
+Done - This method will return true once Next has no more objects to return.
+When it is true after the first page, that page is the whole response.
+*/
+func (p *Pager) Done() bool {
+	return p.done
+}
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+ParseNext - This function will return the added_after value of the query and
+the number of records to skip for the value of a next URL parameter. A
+timestamp on its own continues after that date_added. A timestamp followed by
+a "~" and a number, as sent by NextPage, continues at that date_added and skips
+that many records, which the client already has. ok is false if the value is
+not valid.
+*/
+func ParseNext(next string) (addedAfter string, skip int, ok bool) {
+	i := strings.Index(next, "~")
+	if i < 0 {
+		if timestamp.Valid(next) == false {
+			return "", 0, false
+		}
+		return next, 0, true
+	}
+
+	dateAdded := next[:i]
+	if timestamp.Valid(dateAdded) == false {
+		return "", 0, false
+	}
+	skip, err := strconv.Atoi(next[i+1:])
+	if err != nil || skip < 0 {
+		return "", 0, false
+	}
+	return Before(dateAdded), skip, true
+}
@@ -0,0 +1,154 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package envelopes
+
+import (
+	"strconv"
+
+	"github.com/freetaxii/libstix2/datastore"
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/libstix2/resources/manifest"
+)
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+RecordLimit - This function will return the most records that a query may
+return, the limit URL parameter of the query if it is smaller than the limit
+provided, which is the record limit of the server. 0 is no limit.
+*/
+func RecordLimit(q collections.CollectionQuery, limit int) int {
+	if len(q.Limit) > 0 {
+		if l, err := strconv.Atoi(q.Limit[0]); err == nil && l > 0 && (limit <= 0 || l < limit) {
+			limit = l
+		}
+	}
+	return limit
+}
+
+/*
+Manifest - This function will read the manifest records that a query finds, a
+page at a time, until there are limit records left after the filter, or there
+are no more. The filter is applied to each page as it is read, so the more
+property and the date_added of the last record that was read are correct for
+the records that are returned, and the next page starts right after them. A
+limit of 0 reads every record. The error of the datastore is returned for any
+page, for the first page it can mean that the query does not find anything.
+*/
+func Manifest(ds datastore.Datastorer, q collections.CollectionQuery, limit int, filter func(records []manifest.ManifestRecord) []manifest.ManifestRecord) (*collections.CollectionQueryResult, error) {
+	var result collections.CollectionQueryResult
+	var boundary Boundary
+	q.Limit = nil
+
+	for {
+		count := len(result.ManifestData.Objects)
+		q.ServerRecordLimit = boundary.Limit(pageSize(limit, count))
+
+		results, err := ds.GetManifestData(q)
+		if err != nil {
+			return nil, err
+		}
+		if results == nil {
+			result.ManifestData.More = false
+			break
+		}
+
+		if result.DateAddedFirst == "" {
+			result.DateAddedFirst = results.DateAddedFirst
+		}
+		if results.DateAddedLast != "" {
+			result.DateAddedLast = results.DateAddedLast
+		}
+
+		var page []manifest.ManifestRecord
+		for _, r := range results.ManifestData.Objects {
+			if boundary.Add(r.ID+"|"+r.Version) == true {
+				page = append(page, r)
+			}
+		}
+		if filter != nil {
+			page = filter(page)
+		}
+		result.ManifestData.Objects = append(result.ManifestData.Objects, page...)
+		result.ManifestData.More = results.ManifestData.More
+
+		if results.ManifestData.More == false || results.DateAddedLast == "" || (limit > 0 && len(result.ManifestData.Objects) >= limit) {
+			break
+		}
+		boundary.Advance(&q, results.DateAddedLast)
+	}
+
+	result.Size = len(result.ManifestData.Objects)
+	return &result, nil
+}
+
+/*
+Versions - This function will read the versions of the object that a query
+finds the same way that Manifest reads manifest records.
+*/
+func Versions(ds datastore.Datastorer, q collections.CollectionQuery, limit int, filter func(versions []string) []string) (*collections.CollectionQueryResult, error) {
+	var result collections.CollectionQueryResult
+	var boundary Boundary
+	q.Limit = nil
+
+	for {
+		count := len(result.VersionsData.Versions)
+		q.ServerRecordLimit = boundary.Limit(pageSize(limit, count))
+
+		results, err := ds.GetVersions(q)
+		if err != nil {
+			return nil, err
+		}
+		if results == nil {
+			result.VersionsData.More = false
+			break
+		}
+
+		if result.DateAddedFirst == "" {
+			result.DateAddedFirst = results.DateAddedFirst
+		}
+		if results.DateAddedLast != "" {
+			result.DateAddedLast = results.DateAddedLast
+		}
+
+		var page []string
+		for _, v := range results.VersionsData.Versions {
+			if boundary.Add(v) == true {
+				page = append(page, v)
+			}
+		}
+		if filter != nil {
+			page = filter(page)
+		}
+		result.VersionsData.Versions = append(result.VersionsData.Versions, page...)
+		result.VersionsData.More = results.VersionsData.More
+
+		if results.VersionsData.More == false || results.DateAddedLast == "" || (limit > 0 && len(result.VersionsData.Versions) >= limit) {
+			break
+		}
+		boundary.Advance(&q, results.DateAddedLast)
+	}
+
+	result.Size = len(result.VersionsData.Versions)
+	return &result, nil
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+pageSize - This function will return the number of records to read for the
+next page, when count of the limit records were already read.
+*/
+func pageSize(limit, count int) int {
+	if limit > 0 && limit-count < DefaultPageSize {
+		return limit - count
+	}
+	return DefaultPageSize
+}
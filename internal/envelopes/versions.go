@@ -0,0 +1,79 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package envelopes
+
+import (
+	"github.com/freetaxii/libstix2/datastore"
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/libstix2/resources/manifest"
+)
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+EachVersion - This function will read the versions provided of the objects with
+the ids provided from a collection, a page at a time, and call fn with the key
+of each one, as returned by Key, and the object. Every version is read if no
+versions are provided. Manifest records and the versions of an object do not
+carry the content of the object, so this is used to look at it. The records do
+not have to be from a single page of a query, the versions are read no matter
+when they were added.
+*/
+func EachVersion(ds datastore.Datastorer, collectionID string, ids, versions []string, fn func(key string, o interface{})) {
+	if len(ids) == 0 {
+		return
+	}
+
+	q := collections.NewCollectionQuery(collectionID, 0)
+	q.STIXID = ids
+	q.STIXVersion = versions
+	if len(versions) == 0 {
+		q.STIXVersion = []string{"all"}
+	}
+
+	var boundary Boundary
+	for {
+		q.ServerRecordLimit = boundary.Limit(DefaultPageSize)
+		results, err := ds.GetObjects(*q)
+		if err != nil || results == nil {
+			return
+		}
+
+		for _, o := range results.ObjectData.Objects {
+			if key := Key(o); boundary.Add(key) == true {
+				fn(key, o)
+			}
+		}
+
+		if results.ObjectData.More == false || results.DateAddedLast == "" {
+			return
+		}
+		boundary.Advance(q, results.DateAddedLast)
+	}
+}
+
+/*
+RecordKeys - This function will return the ids and the versions of a list of
+manifest records, each one once, so that EachVersion only reads the versions
+that are in the list.
+*/
+func RecordKeys(records []manifest.ManifestRecord) ([]string, []string) {
+	var ids, versions []string
+	found := make(map[string]bool)
+	for _, r := range records {
+		if found["id|"+r.ID] == false {
+			found["id|"+r.ID] = true
+			ids = append(ids, r.ID)
+		}
+		if found["version|"+r.Version] == false {
+			found["version|"+r.Version] = true
+			versions = append(versions, r.Version)
+		}
+	}
+	return ids, versions
+}
@@ -0,0 +1,190 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package envelopes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Writer - This type writes a TAXII envelope, or a TAXII 2.0 bundle, one object
+at a time. The output decodes to the same resource as encoding the whole
+resource at once, but the objects come before the more and next properties.
+Only a small buffer is kept, everything else is written as it is added.
+*/
+type Writer struct {
+	w       *bufio.Writer
+	indent  string
+	fields  int // The number of properties written so far
+	objects int // The number of objects written so far
+	bundle  bool
+	err     error
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+NewWriter - This function will create a new Writer for a TAXII 2.1 envelope.
+An empty indent writes compact JSON.
+*/
+func NewWriter(w io.Writer, indent string) *Writer {
+	var e Writer
+	e.w = bufio.NewWriter(w)
+	e.indent = indent
+	e.w.WriteString("{")
+	return &e
+}
+
+/*
+NewBundleWriter - This function will create a new Writer for a STIX 2.0 bundle
+with the bundle identifier provided.
+*/
+func NewBundleWriter(w io.Writer, id, indent string) *Writer {
+	e := NewWriter(w, indent)
+	e.bundle = true
+	e.field("type", "bundle")
+	e.field("id", id)
+	e.field("spec_version", "2.0")
+	return e
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Writer
+// ----------------------------------------------------------------------
+
+/*
+WriteObject - This method will add an object to the objects list and write it
+out. The first error is kept and returned by every call after it.
+*/
+func (e *Writer) WriteObject(o interface{}) error {
+	if e.err != nil {
+		return e.err
+	}
+
+	data, err := json.Marshal(o)
+	if err != nil {
+		e.err = err
+		return err
+	}
+
+	if e.objects == 0 {
+		e.key("objects")
+		e.w.WriteString("[")
+	} else {
+		e.w.WriteString(",")
+	}
+	e.objects++
+
+	if e.indent != "" {
+		e.w.WriteString("\n" + strings.Repeat(e.indent, 2))
+		data = indent(data, strings.Repeat(e.indent, 2), e.indent)
+	}
+	e.write(data)
+	return e.err
+}
+
+/*
+Close - This method will end the objects list, write the more and next
+properties of an envelope, and flush everything to the underlying writer. The
+more and next properties are left out when they are false or empty, and are
+never written for a bundle.
+*/
+func (e *Writer) Close(more bool, next string) error {
+	if e.objects > 0 {
+		if e.indent != "" {
+			e.w.WriteString("\n" + e.indent)
+		}
+		e.w.WriteString("]")
+		e.fields++
+	}
+
+	if e.bundle == false {
+		if more == true {
+			e.key("more")
+			e.w.WriteString("true")
+			e.fields++
+		}
+		if next != "" {
+			e.field("next", next)
+		}
+	}
+
+	if e.indent != "" && e.fields > 0 {
+		e.w.WriteString("\n")
+	}
+	e.w.WriteString("}\n")
+
+	if err := e.w.Flush(); err != nil && e.err == nil {
+		e.err = err
+	}
+	return e.err
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - Writer
+// ----------------------------------------------------------------------
+
+/*
+key - This method will write the name of the next property, along with the
+comma that separates it from the previous one.
+*/
+func (e *Writer) key(name string) {
+	if e.fields > 0 {
+		e.w.WriteString(",")
+	}
+	if e.indent != "" {
+		e.w.WriteString("\n" + e.indent)
+	}
+	e.w.WriteString(`"` + name + `":`)
+	if e.indent != "" {
+		e.w.WriteString(" ")
+	}
+}
+
+/*
+field - This method will write a property with a string value.
+*/
+func (e *Writer) field(name, value string) {
+	data, _ := json.Marshal(value)
+	e.key(name)
+	e.write(data)
+	e.fields++
+}
+
+/*
+write - This method will write data and keep the first error.
+*/
+func (e *Writer) write(data []byte) {
+	if _, err := e.w.Write(data); err != nil && e.err == nil {
+		e.err = err
+	}
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+indent - This function will indent JSON the same way json.Encoder does, with
+every line after the first one starting with the prefix.
+*/
+func indent(data []byte, prefix, indent string) []byte {
+	var b bytes.Buffer
+	if err := json.Indent(&b, data, prefix, indent); err != nil {
+		return data
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,12 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package export walks the contents of a collection in the datastore and writes
+them out as STIX bundles. Every version of every object is exported and the
+date_added value that the server recorded for each of them is carried along in
+the bundle so that a collection can be restored exactly.
+*/
+package export
@@ -0,0 +1,220 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/freetaxii/libstix2/datastore"
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/server/internal/envelopes"
+	"github.com/freetaxii/server/internal/uuid"
+	"github.com/gologme/log"
+)
+
+// DefaultPageSize - The number of records that are requested from the
+// datastore at a time if the caller does not define a page size.
+const DefaultPageSize = 100
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Bundle - This type defines a STIX bundle as it is written by an export. In
+addition to the objects, the bundle carries a manifest record for each object
+so that the date_added value is preserved.
+
+Type      - Always "bundle"
+ID        - A new bundle identifier for each bundle that is written
+Objects   - The raw JSON of each object version in this bundle
+Manifest  - The id, version, and date_added for each object in this bundle
+*/
+type Bundle struct {
+	Type     string            `json:"type"`
+	ID       string            `json:"id"`
+	Objects  []json.RawMessage `json:"objects,omitempty"`
+	Manifest []Record          `json:"x_freetaxii_manifest,omitempty"`
+}
+
+/*
+Record - This type records the collection metadata for a single object
+version in an exported bundle.
+*/
+type Record struct {
+	ID        string `json:"id"`
+	Version   string `json:"version"`
+	DateAdded string `json:"date_added"`
+	MediaType string `json:"media_type,omitempty"`
+}
+
+/*
+Exporter - This type holds the settings for exporting collections from a
+datastore.
+
+PageSize    - The number of records that are requested from the datastore at a time
+BundleSize  - The maximum number of objects in a bundle, 0 means one bundle per collection
+*/
+type Exporter struct {
+	Logger     *log.Logger
+	DS         datastore.Datastorer
+	PageSize   int
+	BundleSize int
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+New - This function will create a new Exporter that reads from the provided
+datastore.
+*/
+func New(logger *log.Logger, ds datastore.Datastorer) *Exporter {
+	var x Exporter
+
+	if logger == nil {
+		x.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	} else {
+		x.Logger = logger
+	}
+
+	x.DS = ds
+	x.PageSize = DefaultPageSize
+	return &x
+}
+
+/*
+NewBundle - This function will create a new empty bundle with a new bundle
+identifier.
+*/
+func NewBundle() *Bundle {
+	var b Bundle
+	b.Type = "bundle"
+	b.ID = "bundle--" + uuid.New()
+	return &b
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Exporter
+// ----------------------------------------------------------------------
+
+/*
+Export - This method will walk every version of every object in the collection
+and hand each finished bundle to the write function. It returns the number of
+objects that were exported.
+*/
+func (x *Exporter) Export(collectionID string, write func(b *Bundle) error) (int, error) {
+	if x.DS == nil {
+		return 0, errors.New("no datastore defined for export")
+	}
+
+	pageSize := x.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	q := collections.NewCollectionQuery(collectionID, pageSize)
+	q.STIXVersion = []string{"all"}
+
+	total := 0
+	b := NewBundle()
+
+	// Each page starts at the date_added of the last one, so that versions
+	// that share it are not lost, and the versions already read are skipped
+	var boundary envelopes.Boundary
+
+	for {
+		q.ServerRecordLimit = boundary.Limit(pageSize)
+
+		// The manifest gives us the date_added for each object version in this
+		// page, the objects themselves come from a query with the same filters.
+		manifestResults, err := x.DS.GetManifestData(*q)
+		if err != nil {
+			return total, fmt.Errorf("unable to read manifest of collection %s: %v", collectionID, err)
+		}
+
+		objectResults, err := x.DS.GetObjects(*q)
+		if err != nil {
+			return total, fmt.Errorf("unable to read objects of collection %s: %v", collectionID, err)
+		}
+
+		dateAdded := make(map[string]Record)
+		for _, m := range manifestResults.ManifestData.Objects {
+			dateAdded[m.ID+"|"+m.Version] = Record{ID: m.ID, Version: m.Version, DateAdded: m.DateAdded, MediaType: m.MediaType}
+		}
+
+		for _, o := range objectResults.ObjectData.Objects {
+			data, err := json.Marshal(o)
+			if err != nil {
+				return total, fmt.Errorf("unable to encode object from collection %s: %v", collectionID, err)
+			}
+
+			id, version := objectVersion(data)
+			if !boundary.Add(id + "|" + version) {
+				continue
+			}
+
+			r, found := dateAdded[id+"|"+version]
+			if !found {
+				x.Logger.Warnln("WARN: No manifest record found for", id, "version", version, "in collection", collectionID)
+				r = Record{ID: id, Version: version}
+			}
+
+			b.Objects = append(b.Objects, data)
+			b.Manifest = append(b.Manifest, r)
+			total++
+
+			if x.BundleSize > 0 && len(b.Objects) >= x.BundleSize {
+				if err := write(b); err != nil {
+					return total, err
+				}
+				b = NewBundle()
+			}
+		}
+
+		x.Logger.Debugln("DEBUG: Exported", total, "objects so far from collection", collectionID)
+
+		// Move the window forward until the datastore says there is nothing left
+		if objectResults.ObjectData.More == false || objectResults.DateAddedLast == "" {
+			break
+		}
+		boundary.Advance(q, objectResults.DateAddedLast)
+	}
+
+	if len(b.Objects) > 0 {
+		if err := write(b); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+objectVersion - This function will return the id and the version of an object
+from its JSON. The version is the modified timestamp, or the created timestamp
+for objects that are not versioned.
+*/
+func objectVersion(data []byte) (string, string) {
+	var o struct {
+		ID       string `json:"id"`
+		Created  string `json:"created"`
+		Modified string `json:"modified"`
+	}
+	json.Unmarshal(data, &o)
+
+	if o.Modified != "" {
+		return o.ID, o.Modified
+	}
+	return o.ID, o.Created
+}
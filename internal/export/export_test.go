@@ -0,0 +1,92 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package export
+
+import (
+	"testing"
+
+	"github.com/freetaxii/server/internal/storetest"
+)
+
+// versions - This function returns a datastore with two versions of an
+// indicator and a malware, each added a day after the other.
+func versions() *storetest.Store {
+	ds := storetest.New()
+	ds.Add("1234", "2018-02-01T00:00:00.000000Z", `{"type": "indicator", "id": "indicator--1", "created": "2018-01-01T00:00:00.000Z", "modified": "2018-01-01T00:00:00.000Z"}`)
+	ds.Add("1234", "2018-02-02T00:00:00.000000Z", `{"type": "indicator", "id": "indicator--1", "created": "2018-01-01T00:00:00.000Z", "modified": "2018-01-02T00:00:00.000Z"}`)
+	ds.Add("1234", "2018-02-03T00:00:00.000000Z", `{"type": "malware", "id": "malware--1", "created": "2018-01-03T00:00:00.000Z", "modified": "2018-01-03T00:00:00.000Z"}`)
+	return ds
+}
+
+// ----------------------------------------------------------------------
+func Test_Export(t *testing.T) {
+	x := New(storetest.Logger(), versions())
+	x.BundleSize = 2
+
+	var bundles []*Bundle
+	total, err := x.Export("1234", func(b *Bundle) error {
+		bundles = append(bundles, b)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if total != 3 {
+		t.Errorf("wrong number of objects exported: got %d want 3", total)
+	}
+
+	if len(bundles) != 2 {
+		t.Fatalf("wrong number of bundles: got %d want 2", len(bundles))
+	}
+
+	if len(bundles[0].Objects) != 2 || len(bundles[1].Objects) != 1 {
+		t.Errorf("objects were not split across bundles correctly")
+	}
+
+	if bundles[0].ID == bundles[1].ID {
+		t.Errorf("bundles share the same id %s", bundles[0].ID)
+	}
+
+	if v := bundles[0].Manifest[1].DateAdded; v != "2018-02-02T00:00:00.000000Z" {
+		t.Errorf("wrong date_added for second version: got %s", v)
+	}
+
+	if v := bundles[1].Manifest[0].ID; v != "malware--1" {
+		t.Errorf("wrong manifest record in second bundle: got %s", v)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_ExportSharedDateAdded(t *testing.T) {
+	// More versions share a date_added than fit on a page
+	ds := versions()
+	for _, day := range []string{"04", "05", "06", "07"} {
+		ds.Add("1234", "2018-02-03T00:00:00.000000Z", `{"type": "malware", "id": "malware--1", "created": "2018-01-03T00:00:00.000Z", "modified": "2018-01-`+day+`T00:00:00.000Z"}`)
+	}
+
+	x := New(storetest.Logger(), ds)
+	x.PageSize = 2
+
+	seen := make(map[string]bool)
+	total, err := x.Export("1234", func(b *Bundle) error {
+		for _, r := range b.Manifest {
+			if seen[r.ID+r.Version] {
+				t.Errorf("%s version %s was exported twice", r.ID, r.Version)
+			}
+			seen[r.ID+r.Version] = true
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 7 || len(seen) != 7 {
+		t.Errorf("wrong number of versions exported: got %d want 7", total)
+	}
+}
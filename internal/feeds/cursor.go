@@ -0,0 +1,72 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package feeds
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+CursorStore - This interface defines how the last date_added that was seen for
+each feed is loaded and saved. An empty cursor means the feed has never been
+polled.
+*/
+type CursorStore interface {
+	Load(name string) (string, error)
+	Save(name, cursor string) error
+}
+
+/*
+FileCursorStore - This type implements the CursorStore interface by keeping
+the cursor of each feed in its own file in a directory.
+*/
+type FileCursorStore struct {
+	Directory string
+}
+
+/*
+NewFileCursorStore - This function will create a new CursorStore that keeps
+its files in the directory provided.
+*/
+func NewFileCursorStore(directory string) *FileCursorStore {
+	return &FileCursorStore{Directory: directory}
+}
+
+/*
+Load - This method will return the saved cursor for a feed.
+*/
+func (s *FileCursorStore) Load(name string) (string, error) {
+	data, err := ioutil.ReadFile(s.filename(name))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+/*
+Save - This method will save the cursor for a feed. The cursor is written to a
+temporary file first so that a crash can not leave a partial cursor behind.
+*/
+func (s *FileCursorStore) Save(name, cursor string) error {
+	tmp := s.filename("." + name)
+	if err := ioutil.WriteFile(tmp, []byte(cursor+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.filename(name))
+}
+
+/*
+filename - This method will return the full path of the cursor file for a feed.
+*/
+func (s *FileCursorStore) filename(name string) string {
+	return filepath.Join(s.Directory, name+".cursor")
+}
@@ -0,0 +1,12 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package feeds mirrors collections from upstream TAXII 2.1 servers in to local
+collections. Each feed is polled with the added_after and next URL parameters
+and the last date_added that was seen is saved so that polling resumes where it
+left off.
+*/
+package feeds
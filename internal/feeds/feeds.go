@@ -0,0 +1,249 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package feeds
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/freetaxii/libstix2/defs"
+	"github.com/freetaxii/libstix2/resources/envelope"
+	"github.com/freetaxii/libstix2/resources/status"
+	"github.com/freetaxii/server/internal/config"
+	"github.com/freetaxii/server/internal/envelopes"
+	"github.com/freetaxii/server/internal/ingest"
+	"github.com/gologme/log"
+)
+
+// maxPages - A safety limit on the number of pages that are requested from an
+// upstream server in a single poll, in case it keeps returning the same page.
+const maxPages = 10000
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Feed - This type holds everything that is needed to mirror a single upstream
+collection in to a local collection.
+
+Name        - The unique name of this feed
+ObjectsURL  - The full URL of the objects endpoint of the upstream collection
+Interval    - How often the upstream collection is polled
+*/
+type Feed struct {
+	Logger     *log.Logger
+	Name       string
+	ObjectsURL string
+	Username   string
+	Password   string
+	Interval   time.Duration
+	Client     *http.Client
+	Cursor     CursorStore
+	Ingester   *ingest.Ingester
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+New - This function will create a new Feed from the feed configuration that
+adds the objects it pulls using the Ingester provided.
+*/
+func New(logger *log.Logger, f config.FeedService, cursor CursorStore, in *ingest.Ingester) *Feed {
+	var feed Feed
+
+	if logger == nil {
+		feed.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	} else {
+		feed.Logger = logger
+	}
+
+	feed.Name = f.Name
+	feed.ObjectsURL = f.APIRoot + "collections/" + f.CollectionID + "/objects/"
+	feed.Username = f.Username
+	feed.Password = f.Password
+	feed.Interval = f.IntervalDuration
+	feed.Client = &http.Client{Timeout: 5 * time.Minute}
+	feed.Cursor = cursor
+	feed.Ingester = in
+	return &feed
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Feed
+// ----------------------------------------------------------------------
+
+/*
+Run - This method will poll the upstream collection right away and then again
+at every interval until the stop channel is closed.
+*/
+func (f *Feed) Run(stop <-chan struct{}) {
+	f.Logger.Infoln("INFO: Starting feed", f.Name, "from", f.ObjectsURL, "every", f.Interval)
+
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+
+	for {
+		total, err := f.Poll()
+		if err != nil {
+			f.Logger.Errorln("ERROR: Polling feed", f.Name, "failed after", total, "objects:", err)
+		} else {
+			f.Logger.Infoln("INFO: Feed", f.Name, "added", total, "objects to collection", f.Ingester.CollectionID)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			f.Logger.Infoln("INFO: Stopping feed", f.Name)
+			return
+		}
+	}
+}
+
+/*
+Poll - This method will request every object that was added to the upstream
+collection since the saved cursor, following the next parameter until the
+upstream server says there is nothing more. The cursor is saved after every
+page, until a page has objects that could not be added because of a datastore
+error. The cursor is not moved past that page, so those objects are requested
+again by the next poll. The objects of the pages after it are still added, and
+the ones that are requested again are found to be already present. Objects that
+are rejected, like objects that are not valid, conflict with a version that is
+already present, or have markings that are not allowed, would be rejected again
+by every poll, so they are logged and the cursor moves past them. It returns
+the number of objects that were added.
+*/
+func (f *Feed) Poll() (int, error) {
+	cursor, err := f.Cursor.Load(f.Name)
+	if err != nil {
+		return 0, fmt.Errorf("unable to load cursor: %v", err)
+	}
+
+	total := 0
+	next := ""
+	hold := false
+	for page := 0; page < maxPages; page++ {
+		e, dateAddedLast, err := f.request(cursor, next)
+		if err != nil {
+			return total, err
+		}
+
+		statusMessage := status.New()
+		statusMessage.SetNewID()
+		statusMessage.SetStatusCompleted()
+		statusMessage.SetRequestTimestampToCurrentTime()
+
+		c := f.Ingester.Ingest(e.Objects, statusMessage)
+		total += c.Success
+		if c.Transient > 0 {
+			f.Logger.Warnln("WARN: Feed", f.Name, "had", c.Transient, "of", c.Total, "objects that could not be added, they will be requested again by the next poll")
+			hold = true
+		}
+		if rejected := c.Failure - c.Transient; rejected > 0 {
+			f.Logger.Warnln("WARN: Feed", f.Name, "had", rejected, "of", c.Total, "objects that were rejected by collection", f.Ingester.CollectionID, "and are skipped")
+		}
+
+		if hold == false && later(dateAddedLast, cursor) {
+			if err := f.Cursor.Save(f.Name, dateAddedLast); err != nil {
+				return total, fmt.Errorf("unable to save cursor: %v", err)
+			}
+		}
+
+		if e.More == false || e.Next == "" {
+			return total, nil
+		}
+		next = e.Next
+	}
+	return total, fmt.Errorf("stopped after %d pages", maxPages)
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - Feed
+// ----------------------------------------------------------------------
+
+/*
+request - This method will request a single page of objects from the upstream
+collection and return the envelope and the X-TAXII-Date-Added-Last header.
+*/
+func (f *Feed) request(addedAfter, next string) (*envelope.EnvelopeRawDecode, string, error) {
+	u, err := url.Parse(f.ObjectsURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The upstream server only returns objects that were added after the
+	// time given, so the request starts right before the cursor. Objects that
+	// share the date_added of the cursor are not lost if a poll stopped part
+	// way through them, and the ones that were already added are found to be
+	// already present.
+	q := u.Query()
+	if addedAfter != "" && next == "" {
+		q.Set("added_after", envelopes.Before(addedAfter))
+	}
+	if next != "" {
+		q.Set("next", next)
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", defs.MEDIA_TYPE_TAXII21)
+	if f.Username != "" {
+		req.SetBasicAuth(f.Username, f.Password)
+	}
+
+	f.Logger.Debugln("DEBUG: Feed", f.Name, "requesting", u.String())
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil, "", fmt.Errorf("upstream server returned %s", resp.Status)
+	}
+
+	e, err := envelope.DecodeRaw(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to decode envelope: %v", err)
+	}
+	return e, resp.Header.Get("X-TAXII-Date-Added-Last"), nil
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+later - This function will return true if timestamp a is later than timestamp
+b. Timestamps from different servers can have different precision so they are
+compared as times when possible.
+*/
+func later(a, b string) bool {
+	if a == "" {
+		return false
+	}
+	if b == "" {
+		return true
+	}
+
+	ta, errA := time.Parse(time.RFC3339Nano, a)
+	tb, errB := time.Parse(time.RFC3339Nano, b)
+	if errA != nil || errB != nil {
+		return a > b
+	}
+	return ta.After(tb)
+}
@@ -0,0 +1,166 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package feeds
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freetaxii/server/internal/config"
+	"github.com/freetaxii/server/internal/ingest"
+	"github.com/freetaxii/server/internal/storetest"
+)
+
+// taxiiStandIn - This function returns a TAXII objects endpoint that serves
+// two pages of objects and records the query of each request. If broken is
+// true the object on the first page is not valid.
+func taxiiStandIn(t *testing.T, queries *[]string, broken bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*queries = append(*queries, r.URL.RawQuery)
+
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Path != "/api1/collections/1234/objects/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/taxii+json;version=2.1")
+		obj := `{"type": "malware", "spec_version": "2.1", "id": "malware--00000000-0000-4000-8000-00000000000%d", "created": "2018-01-01T00:00:00.000Z", "modified": "2018-01-01T00:00:00.000Z", "name": "m%d", "is_family": false}`
+
+		switch r.URL.Query().Get("next") {
+		case "":
+			first := obj
+			if broken {
+				first = strings.Replace(obj, `"created"`, `"not_created"`, 1)
+			}
+			w.Header().Set("X-TAXII-Date-Added-Last", "2018-02-01T00:00:00.000000Z")
+			fmt.Fprintf(w, `{"more": true, "next": "page2", "objects": [`+first+`]}`, 1, 1)
+		case "page2":
+			w.Header().Set("X-TAXII-Date-Added-Last", "2018-02-02T00:00:00.000000Z")
+			fmt.Fprintf(w, `{"more": false, "objects": [`+obj+`]}`, 2, 2)
+		}
+	}))
+}
+
+// ----------------------------------------------------------------------
+func Test_Poll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freetaxii-feeds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var queries []string
+	ts := taxiiStandIn(t, &queries, false)
+	defer ts.Close()
+
+	db := storetest.New()
+	cursor := NewFileCursorStore(dir)
+	fc := config.FeedService{
+		Name:             "upstream",
+		APIRoot:          ts.URL + "/api1/",
+		CollectionID:     "1234",
+		Username:         "user",
+		Password:         "secret",
+		IntervalDuration: time.Minute,
+	}
+	f := New(storetest.Logger(), fc, cursor, ingest.New(storetest.Logger(), db, "local"))
+
+	total, err := f.Poll()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if total != 2 || db.Count("local") != 2 {
+		t.Errorf("wrong number of objects added: got %d (%d in the collection) want 2", total, db.Count("local"))
+	}
+
+	if len(queries) != 2 || queries[0] != "" || queries[1] != "next=page2" {
+		t.Errorf("wrong requests sent for the first poll: %v", queries)
+	}
+
+	if c, _ := cursor.Load("upstream"); c != "2018-02-02T00:00:00.000000Z" {
+		t.Errorf("wrong cursor saved: got %s", c)
+	}
+
+	// The second poll must pick up from the saved cursor, including objects
+	// that share its date_added, and the objects it gets again are not added
+	// twice
+	queries = nil
+	if _, err := f.Poll(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(queries) != 2 || queries[0] != "added_after=2018-02-01T23%3A59%3A59.999999Z" || queries[1] != "next=page2" {
+		t.Errorf("second poll did not use the saved cursor: %v", queries)
+	}
+	if db.Count("local") != 2 {
+		t.Errorf("objects were added again: %d in the collection", db.Count("local"))
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_PollFailure(t *testing.T) {
+	var queries []string
+	ts := taxiiStandIn(t, &queries, true)
+	defer ts.Close()
+
+	fc := config.FeedService{
+		Name:             "upstream",
+		APIRoot:          ts.URL + "/api1/",
+		CollectionID:     "1234",
+		Username:         "user",
+		Password:         "secret",
+		IntervalDuration: time.Minute,
+	}
+
+	// The object that is not valid would be rejected by every poll, so the
+	// cursor moves past it
+	cursor := NewFileCursorStore(t.TempDir())
+	cursor.Save("upstream", "2018-01-01T00:00:00.000000Z")
+	f := New(storetest.Logger(), fc, cursor, ingest.New(storetest.Logger(), storetest.New(), "local"))
+
+	total, err := f.Poll()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 1 {
+		t.Errorf("the objects after the failure were not added: got %d want 1", total)
+	}
+	if c, _ := cursor.Load("upstream"); c != "2018-02-02T00:00:00.000000Z" {
+		t.Errorf("the cursor did not move past an object that was rejected: %s", c)
+	}
+
+	// Objects that could not be written because of a datastore error must be
+	// requested again by the next poll
+	valid := taxiiStandIn(t, &queries, false)
+	defer valid.Close()
+	fc.APIRoot = valid.URL + "/api1/"
+
+	db := storetest.New()
+	db.Err = errors.New("database is locked")
+	cursor = NewFileCursorStore(t.TempDir())
+	cursor.Save("upstream", "2018-01-01T00:00:00.000000Z")
+	f = New(storetest.Logger(), fc, cursor, ingest.New(storetest.Logger(), db, "local"))
+
+	if _, err := f.Poll(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c, _ := cursor.Load("upstream"); c != "2018-01-01T00:00:00.000000Z" {
+		t.Errorf("the cursor moved past objects that could not be added: %s", c)
+	}
+}
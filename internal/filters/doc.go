@@ -0,0 +1,22 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package filters implements the match filters of the TAXII 2.1
+Interoperability specification that go beyond the filters of the collection
+query: match[relationship_type], match[confidence], match[labels],
+match[external_id], match[valid_until], and match filters on custom properties
+like match[x_mitre_platforms]. A filter with a list of values matches an object
+when any of the values match, and all filters must match. The filters are
+applied to the objects that the datastore returns for the collection query.
+
+The filters are not pushed down into the datastore. The collection query of
+libstix2 only has fields for the id, type, version, spec_version and
+added_after filters, and the sqlite3 datastore does not store custom
+properties, so doing this needs a change to libstix2. Until then a page can
+have fewer objects than the limit, and the manifest and versions endpoints read
+the versions that are listed on the page to look at their properties.
+*/
+package filters
@@ -0,0 +1,318 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package filters
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/freetaxii/libstix2/datastore"
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/libstix2/resources/manifest"
+	"github.com/freetaxii/server/internal/envelopes"
+)
+
+// queryFilters - The match filters that are part of the collection query and
+// are handled by the datastore.
+var queryFilters = map[string]bool{
+	"id":           true,
+	"type":         true,
+	"version":      true,
+	"spec_version": true,
+}
+
+// customProperty - The format of the name of a custom property.
+var customProperty = regexp.MustCompile(`^x_[a-z0-9_]{1,248}$`)
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Filter - This type defines a single match filter. The object matches if the
+property matches any of the values.
+*/
+type Filter struct {
+	Property string
+	Values   []string
+}
+
+/*
+Filters - This type is the list of match filters of a request. An object must
+match every filter. An empty list matches every object.
+*/
+type Filters []Filter
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+Parse - This function will return the interoperability match filters found in
+the URL parameters of a request. The match filters that are part of the
+collection query are skipped. A description of each filter that is not
+supported or that has an invalid value is returned so that it can be reported
+to the client.
+*/
+func Parse(values map[string][]string) (Filters, []string) {
+	var f Filters
+	var problems []string
+
+	// Sort the keys so the filters and problems are always in the same order
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "match[") || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		property := key[len("match[") : len(key)-1]
+		if queryFilters[property] == true {
+			continue
+		}
+
+		// A filter without a value, like match[labels]=, is ignored
+		list := List(values[key])
+		if len(list) == 0 {
+			continue
+		}
+
+		switch {
+		case property == "relationship_type" || property == "labels" || property == "external_id":
+		case property == "confidence":
+			for _, v := range list {
+				if c, err := strconv.Atoi(v); err != nil || c < 0 || c > 100 {
+					problems = append(problems, key+" value "+v+" is not an integer from 0 to 100")
+				}
+			}
+		case property == "valid_until":
+			if _, err := time.Parse(time.RFC3339Nano, list[0]); len(list) != 1 || err != nil {
+				problems = append(problems, key+" must be a single timestamp")
+			}
+		case customProperty.MatchString(property):
+		default:
+			problems = append(problems, key+" is not a supported filter")
+			continue
+		}
+
+		f = append(f, Filter{Property: property, Values: list})
+	}
+
+	return f, problems
+}
+
+/*
+List - This function will return the values of a URL parameter as one list.
+A parameter may be given more than once and each value may be a comma
+separated list, so match[type]=indicator&match[type]=malware is the same as
+match[type]=indicator,malware. Empty values are left out.
+*/
+func List(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Filters
+// ----------------------------------------------------------------------
+
+/*
+Matches - This method will return true if the raw JSON of an object matches
+every filter.
+*/
+func (f Filters) Matches(data []byte) bool {
+	if len(f) == 0 {
+		return true
+	}
+
+	var o map[string]interface{}
+	if err := json.Unmarshal(data, &o); err != nil {
+		return false
+	}
+
+	for _, filter := range f {
+		if !filter.matches(o) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Filter - This method will return only the objects from the datastore that
+match every filter.
+*/
+func (f Filters) Filter(objects []interface{}) []interface{} {
+	if len(f) == 0 {
+		return objects
+	}
+
+	result := make([]interface{}, 0, len(objects))
+	for _, o := range objects {
+		data, err := json.Marshal(o)
+		if err == nil && f.Matches(data) {
+			result = append(result, o)
+		}
+	}
+	return result
+}
+
+/*
+FilterManifest - This method will return only the manifest records whose
+object versions match every filter. Manifest records do not carry the
+properties of the object, so the versions of the records are read from the
+collection of the query.
+*/
+func (f Filters) FilterManifest(ds datastore.Datastorer, q collections.CollectionQuery, records []manifest.ManifestRecord) []manifest.ManifestRecord {
+	if len(f) == 0 || len(records) == 0 {
+		return records
+	}
+
+	ids, versions := envelopes.RecordKeys(records)
+	matched := f.matchingVersions(ds, q.CollectionID, ids, versions)
+
+	result := make([]manifest.ManifestRecord, 0, len(records))
+	for _, r := range records {
+		if matched[r.ID+"|"+r.Version] == true {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+/*
+FilterVersions - This method will return only the versions of an object that
+match every filter. The query must be for the single object.
+*/
+func (f Filters) FilterVersions(ds datastore.Datastorer, q collections.CollectionQuery, versions []string) []string {
+	if len(f) == 0 || len(versions) == 0 || len(q.STIXID) == 0 {
+		return versions
+	}
+
+	matched := f.matchingVersions(ds, q.CollectionID, q.STIXID[:1], versions)
+
+	result := make([]string, 0, len(versions))
+	for _, v := range versions {
+		if matched[q.STIXID[0]+"|"+v] == true {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - Filters
+// ----------------------------------------------------------------------
+
+/*
+matchingVersions - This method will read the versions provided of the objects
+with the ids provided from a collection and return the id and version, joined
+with a "|", of each one that matches.
+*/
+func (f Filters) matchingVersions(ds datastore.Datastorer, collectionID string, ids, versions []string) map[string]bool {
+	matched := make(map[string]bool)
+	envelopes.EachVersion(ds, collectionID, ids, versions, func(key string, o interface{}) {
+		data, err := json.Marshal(o)
+		if err == nil && f.Matches(data) {
+			matched[key] = true
+		}
+	})
+	return matched
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - Filter
+// ----------------------------------------------------------------------
+
+/*
+matches - This method will return true if the decoded object matches the
+filter.
+*/
+func (filter Filter) matches(o map[string]interface{}) bool {
+	switch filter.Property {
+	case "external_id":
+		refs, _ := o["external_references"].([]interface{})
+		for _, r := range refs {
+			ref, _ := r.(map[string]interface{})
+			if containsValue(filter.Values, ref["external_id"]) {
+				return true
+			}
+		}
+		return false
+
+	case "valid_until":
+		// Only objects that are still valid after the time given match
+		s, _ := o["valid_until"].(string)
+		until, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return false
+		}
+		after, _ := time.Parse(time.RFC3339Nano, filter.Values[0])
+		return until.After(after)
+
+	case "confidence":
+		c, ok := o["confidence"].(float64)
+		if !ok {
+			return false
+		}
+		return containsValue(filter.Values, strconv.Itoa(int(c)))
+	}
+
+	// Every other filter compares the property, or any value of the property
+	// if it is a list, with the values of the filter
+	if list, ok := o[filter.Property].([]interface{}); ok {
+		for _, v := range list {
+			if containsValue(filter.Values, v) {
+				return true
+			}
+		}
+		return false
+	}
+	return containsValue(filter.Values, o[filter.Property])
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+containsValue - This function will return true if a property value, written as
+a string, is one of the values of a filter.
+*/
+func containsValue(values []string, v interface{}) bool {
+	var s string
+	switch value := v.(type) {
+	case string:
+		s = value
+	case float64:
+		s = strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		s = strconv.FormatBool(value)
+	default:
+		return false
+	}
+
+	for _, filterValue := range values {
+		if filterValue == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package filters
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var attackPattern = []byte(`{
+	"type": "attack-pattern",
+	"id": "attack-pattern--7e150503-88e7-4861-866b-ff1ac82c4475",
+	"created": "2018-01-01T00:00:00.000Z",
+	"modified": "2018-01-01T00:00:00.000Z",
+	"name": "Spearphishing Attachment",
+	"labels": ["phishing", "initial-access"],
+	"confidence": 80,
+	"external_references": [{"source_name": "mitre-attack", "external_id": "T1193"}],
+	"x_mitre_platforms": ["Windows", "macOS"]
+}`)
+
+var indicator = []byte(`{
+	"type": "indicator",
+	"id": "indicator--8e2e2d2b-17d4-4cbf-938f-98ee46b3cd3f",
+	"created": "2018-01-01T00:00:00.000Z",
+	"modified": "2018-01-01T00:00:00.000Z",
+	"valid_until": "2019-01-01T00:00:00Z"
+}`)
+
+// ----------------------------------------------------------------------
+func Test_Matches(t *testing.T) {
+	tests := []struct {
+		query string
+		data  []byte
+		want  bool
+	}{
+		{"", attackPattern, true},
+		{"match[type]=indicator", attackPattern, true},
+		{"match[labels]=phishing", attackPattern, true},
+		{"match[labels]=malware,initial-access", attackPattern, true},
+		{"match[labels]=malware", attackPattern, false},
+		{"match[confidence]=80", attackPattern, true},
+		{"match[confidence]=50,60", attackPattern, false},
+		{"match[external_id]=T1193", attackPattern, true},
+		{"match[external_id]=T1566", attackPattern, false},
+		{"match[x_mitre_platforms]=Windows", attackPattern, true},
+		{"match[x_mitre_platforms]=Linux", attackPattern, false},
+		{"match[labels]=phishing&match[confidence]=10", attackPattern, false},
+		{"match[labels]=malware&match[labels]=phishing", attackPattern, true},
+		{"match[confidence]=50&match[confidence]=60,70", attackPattern, false},
+		{"match[relationship_type]=uses", attackPattern, false},
+		{"match[valid_until]=2018-06-01T00:00:00Z", indicator, true},
+		{"match[valid_until]=2019-06-01T00:00:00Z", indicator, false},
+		{"match[valid_until]=2018-06-01T00:00:00Z", attackPattern, false},
+	}
+
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		f, problems := Parse(values)
+		if len(problems) > 0 {
+			t.Errorf("%s: unexpected problems: %v", tt.query, problems)
+			continue
+		}
+		if got := f.Matches(tt.data); got != tt.want {
+			t.Errorf("%s: got %v want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_ParseProblems(t *testing.T) {
+	values, _ := url.ParseQuery("match[color]=red&match[confidence]=high&match[valid_until]=tomorrow&match[id]=x&limit=10")
+	_, problems := Parse(values)
+
+	want := []string{
+		"match[color] is not a supported filter",
+		"match[confidence] value high is not an integer",
+		"match[valid_until] must be a single timestamp",
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("wrong problems: %v", problems)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(problems[i], w) {
+			t.Errorf("problem %d: got %q want %q", i, problems[i], w)
+		}
+	}
+}
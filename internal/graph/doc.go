@@ -0,0 +1,21 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package graph finds the objects that are connected to an object of a
+collection, out to a given depth. Objects are connected by their *_ref and
+*_refs properties and by the relationships and sightings that refer to them. The
+relationships and sightings are treated as the edges of the graph, so following
+one to the object at its other end is a single step. The neighborhood is sent
+as a STIX bundle. This is not part of TAXII, so it is served under the
+x-freetaxii/graph/ path of each collection.
+
+The references are looked up in the collection of the object first and then in
+the other collections the client can read. The relationships and sightings that
+refer to an object are found with an Index, which the Indexer keeps up to date
+as objects are added and Rebuild fills from the objects already in the
+datastore, so a request only reads the edges of the objects it visits.
+*/
+package graph
@@ -0,0 +1,340 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/freetaxii/libstix2/datastore"
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/server/internal/uuid"
+)
+
+// Path - The URL path of the graph endpoint, relative to the collection. The
+// object ID follows it. The x-freetaxii prefix keeps it apart from the TAXII
+// endpoints.
+const Path = "x-freetaxii/graph/"
+
+// DefaultDepth - The number of steps that are followed from the object when
+// the client does not ask for a depth.
+const DefaultDepth = 1
+
+// MaxDepth - The most steps that a client may ask to follow.
+const MaxDepth = 5
+
+// DefaultMaxObjects - The most objects that are sent in a bundle.
+const DefaultMaxObjects = 1000
+
+// ErrNotFound - The error that is returned when the object is not in the
+// collection or the client may not read it.
+var ErrNotFound = errors.New("the object was not found in the collection")
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Graph - This type holds everything that is needed to walk the objects of a
+collection, and of the other collections that the client can read.
+
+Index        - Finds the relationships and sightings that refer to an object, if nil they are not followed
+CollectionID - The collection that is walked, the object the walk starts at must be in it
+Collections  - The other collections that the client can read, whose objects are followed too
+MaxObjects   - The most objects that are returned, the walk stops once it has found this many
+Allow        - If defined, objects of a collection that it returns false for are skipped and are not followed
+*/
+type Graph struct {
+	DS           datastore.Datastorer
+	Index        Index
+	CollectionID string
+	Collections  []string
+	MaxObjects   int
+	Allow        func(collectionID string, data []byte) bool
+}
+
+/*
+Bundle - This type defines the STIX 2.1 bundle that the neighborhood of an
+object is sent in.
+*/
+type Bundle struct {
+	Type    string            `json:"type"`
+	ID      string            `json:"id"`
+	Objects []json.RawMessage `json:"objects"`
+}
+
+/*
+node - This type holds an object that was read from the datastore and the IDs
+of the objects that it refers to.
+*/
+type node struct {
+	id   string
+	data json.RawMessage
+	refs []string
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+New - This function will create a new Graph for the collection provided.
+*/
+func New(ds datastore.Datastorer, collectionID string) *Graph {
+	var g Graph
+	g.DS = ds
+	g.CollectionID = collectionID
+	g.MaxObjects = DefaultMaxObjects
+	return &g
+}
+
+/*
+NewBundle - This function will create a new STIX bundle with a new bundle
+identifier.
+*/
+func NewBundle() *Bundle {
+	var b Bundle
+	b.Type = "bundle"
+	b.ID = "bundle--" + uuid.New()
+	b.Objects = make([]json.RawMessage, 0)
+	return &b
+}
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+References - This function will return the ID of an object and the IDs of the
+objects it refers to with its *_ref and *_refs properties, in the order of the
+property names. Data markings are not part of the graph, so object_marking_refs
+is not followed.
+*/
+func References(data []byte) (string, []string) {
+	var o map[string]interface{}
+	if err := json.Unmarshal(data, &o); err != nil {
+		return "", nil
+	}
+
+	var names []string
+	for k := range o {
+		if k != "object_marking_refs" && (strings.HasSuffix(k, "_ref") || strings.HasSuffix(k, "_refs")) {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	var refs []string
+	for _, k := range names {
+		switch v := o[k].(type) {
+		case string:
+			refs = append(refs, v)
+		case []interface{}:
+			for _, ref := range v {
+				if s, ok := ref.(string); ok {
+					refs = append(refs, s)
+				}
+			}
+		}
+	}
+
+	id, _ := o["id"].(string)
+	return id, refs
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Graph
+// ----------------------------------------------------------------------
+
+/*
+Neighborhood - This method will return a bundle with the latest version of the
+object and of every object that can be reached from it in no more than depth
+steps. The object is always the first one in the bundle.
+*/
+func (g *Graph) Neighborhood(id string, depth int) (*Bundle, error) {
+	start := g.objectIn(g.CollectionID, id)
+	if start == nil {
+		return nil, ErrNotFound
+	}
+
+	bundle := NewBundle()
+	bundle.Objects = append(bundle.Objects, start.data)
+	found := map[string]bool{id: true}
+	full := func() bool {
+		return g.MaxObjects > 0 && len(bundle.Objects) >= g.MaxObjects
+	}
+
+	frontier := []*node{start}
+	for d := 0; d < depth && len(frontier) > 0 && full() == false; d++ {
+		var next []*node
+		for _, n := range frontier {
+			// The relationships and sightings that refer to this object are
+			// sent, and the objects at their other end are one step away.
+			edges, err := g.edges(n.id, found)
+			if err != nil {
+				return nil, err
+			}
+
+			refs := n.refs
+			for _, e := range edges {
+				if found[e.id] == true || full() == true {
+					continue
+				}
+				found[e.id] = true
+				bundle.Objects = append(bundle.Objects, e.data)
+				refs = append(refs, e.refs...)
+			}
+
+			for _, ref := range refs {
+				if found[ref] == true || full() == true {
+					continue
+				}
+				found[ref] = true
+
+				// Objects that are not in a collection the client can read,
+				// or that the client may not read, are left out
+				o := g.object(ref)
+				if o == nil {
+					continue
+				}
+				bundle.Objects = append(bundle.Objects, o.data)
+				next = append(next, o)
+			}
+		}
+		frontier = next
+	}
+	return bundle, nil
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - Graph
+// ----------------------------------------------------------------------
+
+/*
+collections - This method will return the IDs of the collections that are
+walked, the collection of the graph first.
+*/
+func (g *Graph) collections() []string {
+	ids := []string{g.CollectionID}
+	for _, id := range g.Collections {
+		if id != g.CollectionID {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+/*
+object - This method will return the latest version of an object from the
+first collection that has it and whose version the client may read, or nil.
+*/
+func (g *Graph) object(id string) *node {
+	for _, collectionID := range g.collections() {
+		if n := g.objectIn(collectionID, id); n != nil {
+			return n
+		}
+	}
+	return nil
+}
+
+/*
+objectIn - This method will return the latest version of an object in the
+collection provided, or nil if it is not in the collection or may not be read.
+*/
+func (g *Graph) objectIn(collectionID, id string) *node {
+	q := collections.NewCollectionQuery(collectionID, 1)
+	q.STIXID = []string{id}
+
+	results, err := g.DS.GetObjects(*q)
+	if err != nil || results == nil || len(results.ObjectData.Objects) == 0 {
+		return nil
+	}
+
+	n, err := newNode(results.ObjectData.Objects[len(results.ObjectData.Objects)-1])
+	if err != nil || n.id != id || g.allowed(collectionID, n) == false {
+		return nil
+	}
+	return n
+}
+
+/*
+edges - This method will return the latest version of the relationships and
+sightings that refer to an object, from the index, leaving out the ones that
+were already found. An edge whose latest version no longer refers to the object
+is left out as well.
+*/
+func (g *Graph) edges(id string, found map[string]bool) ([]*node, error) {
+	if g.Index == nil {
+		return nil, nil
+	}
+
+	indexed, err := g.Index.Edges(g.collections(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	var edges []*node
+	read := make(map[string]bool)
+	for _, e := range indexed {
+		if found[e.ID] == true || read[e.ID] == true {
+			continue
+		}
+
+		n := g.objectIn(e.CollectionID, e.ID)
+		if n == nil || n.refersTo(id) == false {
+			continue
+		}
+		read[e.ID] = true
+		edges = append(edges, n)
+	}
+	return edges, nil
+}
+
+/*
+allowed - This method will return true if the client may read the object in
+the collection provided.
+*/
+func (g *Graph) allowed(collectionID string, n *node) bool {
+	return g.Allow == nil || g.Allow(collectionID, n.data)
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - node
+// ----------------------------------------------------------------------
+
+/*
+refersTo - This method will return true if the object refers to the ID
+provided.
+*/
+func (n *node) refersTo(id string) bool {
+	for _, ref := range n.refs {
+		if ref == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+newNode - This function will create a node for an object from the datastore.
+*/
+func newNode(o interface{}) (*node, error) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+
+	var n node
+	n.data = data
+	n.id, n.refs = References(data)
+	return &n, nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package graph
+
+import (
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/freetaxii/server/internal/storetest"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// memoryIndex - This type is an Index that keeps the edges in memory.
+type memoryIndex struct {
+	edges []Edge
+}
+
+func (i *memoryIndex) Add(edges []Edge) error {
+	i.edges = append(i.edges, edges...)
+	return nil
+}
+
+func (i *memoryIndex) Edges(collectionIDs []string, id string) ([]Edge, error) {
+	var result []Edge
+	for _, e := range i.edges {
+		for _, c := range collectionIDs {
+			if e.Ref == id && e.CollectionID == c {
+				result = append(result, e)
+			}
+		}
+	}
+	return result, nil
+}
+
+func relationship(id, source, target string) string {
+	return `{"type": "relationship", "id": "` + id + `", "source_ref": "` + source + `", "target_ref": "` + target + `"}`
+}
+
+// indicator--1 indicates malware--1, which uses tool--1. malware--1 was seen in
+// sighting--1, which was created by identity--1. tool--1 is marked TLP:RED.
+var db = storetest.New()
+
+// index - The edges of db, collection 5678 has a relationship from malware--1
+// to attack-pattern--1, which is only in that collection.
+var index memoryIndex
+
+func init() {
+	db.Add("1234", "2018-01-01T00:00:00.000000Z",
+		`{"type": "malware", "id": "malware--1", "name": "Poison Ivy"}`,
+		`{"type": "indicator", "id": "indicator--1", "created_by_ref": "identity--1", "object_marking_refs": ["marking-definition--1"]}`,
+		`{"type": "tool", "id": "tool--1", "object_marking_refs": ["marking-definition--red"]}`,
+		`{"type": "identity", "id": "identity--1"}`,
+		`{"type": "sighting", "id": "sighting--1", "sighting_of_ref": "malware--1", "where_sighted_refs": ["identity--1", "identity--2"]}`,
+		relationship("relationship--1", "indicator--1", "malware--1"),
+		relationship("relationship--2", "malware--1", "tool--1"),
+	)
+	db.Add("5678", "2018-01-01T00:00:00.000000Z",
+		`{"type": "attack-pattern", "id": "attack-pattern--1"}`,
+		relationship("relationship--3", "malware--1", "attack-pattern--1"),
+	)
+	Rebuild(storetest.Logger(), &index, db, []string{"1234", "5678"})
+}
+
+// walk - This function returns a Graph of collection 1234 that uses the index
+// of db.
+func walk() *Graph {
+	g := New(db, "1234")
+	g.Index = &index
+	return g
+}
+
+func ids(b *Bundle) string {
+	var result []string
+	for _, v := range b.Objects {
+		id, _ := References(v)
+		result = append(result, id)
+	}
+	return strings.Join(result, " ")
+}
+
+// ----------------------------------------------------------------------
+func Test_Neighborhood(t *testing.T) {
+	tests := []struct {
+		id    string
+		depth int
+		want  string
+	}{
+		{"malware--1", 0, "malware--1"},
+		{"malware--1", 1, "malware--1 sighting--1 relationship--1 relationship--2 identity--1 indicator--1 tool--1"},
+		{"tool--1", 1, "tool--1 relationship--2 malware--1"},
+		{"tool--1", 2, "tool--1 relationship--2 malware--1 sighting--1 relationship--1 identity--1 indicator--1"},
+		{"relationship--1", 1, "relationship--1 indicator--1 malware--1"},
+	}
+
+	for _, tt := range tests {
+		b, err := walk().Neighborhood(tt.id, tt.depth)
+		if err != nil {
+			t.Errorf("%s: %v", tt.id, err)
+			continue
+		}
+		if got := ids(b); got != tt.want {
+			t.Errorf("%s depth %d: got %s want %s", tt.id, tt.depth, got, tt.want)
+		}
+	}
+
+	if _, err := walk().Neighborhood("malware--2", 1); err != ErrNotFound {
+		t.Errorf("missing object returned %v", err)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_NeighborhoodAllow(t *testing.T) {
+	g := walk()
+	g.Allow = func(collectionID string, data []byte) bool {
+		return !strings.Contains(string(data), "marking-definition--red")
+	}
+
+	b, _ := g.Neighborhood("malware--1", 2)
+	if got, want := ids(b), "malware--1 sighting--1 relationship--1 relationship--2 identity--1 indicator--1"; got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+
+	if _, err := g.Neighborhood("tool--1", 1); err != ErrNotFound {
+		t.Errorf("an object that may not be read returned %v", err)
+	}
+
+	g = walk()
+	g.MaxObjects = 3
+	b, _ = g.Neighborhood("malware--1", 5)
+	if len(b.Objects) != 3 || b.Type != "bundle" || !strings.HasPrefix(b.ID, "bundle--") {
+		t.Errorf("wrong bundle %s %s", b.ID, ids(b))
+	}
+	if _, err := json.Marshal(b); err != nil {
+		t.Error(err)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_NeighborhoodCollections(t *testing.T) {
+	// The relationship and the object it refers to in collection 5678 are
+	// only followed when the client can read that collection
+	g := walk()
+	g.Collections = []string{"5678"}
+	b, _ := g.Neighborhood("tool--1", 2)
+	if got, want := ids(b), "tool--1 relationship--2 malware--1 sighting--1 relationship--1 relationship--3 identity--1 indicator--1 attack-pattern--1"; got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+
+	g.Allow = func(collectionID string, data []byte) bool {
+		return collectionID != "5678" || !strings.Contains(string(data), "attack-pattern--1")
+	}
+	b, _ = g.Neighborhood("malware--1", 1)
+	if got := ids(b); strings.Contains(got, "attack-pattern--1") || strings.Contains(got, "relationship--3") {
+		t.Errorf("objects that may not be read in collection 5678 were sent: %s", got)
+	}
+
+	// Without an index only the references of the objects are followed
+	b, _ = New(db, "1234").Neighborhood("malware--1", 1)
+	if got := ids(b); got != "malware--1" {
+		t.Errorf("got %s without an index", got)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_SQLiteIndex(t *testing.T) {
+	sqlDB, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "graph.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+
+	sqliteIndex, err := NewSQLiteIndex(sqlDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The table of the datastore that lists the objects in each collection
+	sqlDB.Exec(`CREATE TABLE t_collection_data (collection_id TEXT, stix_id TEXT)`)
+	sqlDB.Exec(`INSERT INTO t_collection_data VALUES ("1234", "relationship--1"), ("1234", "relationship--2")`)
+
+	edges := NewEdges("1234", []byte(relationship("relationship--1", "indicator--1", "malware--1")))
+	edges = append(edges, NewEdges("1234", []byte(relationship("relationship--2", "malware--1", "tool--1")))...)
+	edges = append(edges, NewEdges("5678", []byte(relationship("relationship--3", "malware--1", "tool--1")))...)
+	if len(NewEdges("1234", []byte(`{"type": "malware", "id": "malware--1", "created_by_ref": "identity--1"}`))) != 0 {
+		t.Error("an object that is not a relationship or sighting has edges")
+	}
+
+	// Adding the same edges again keeps one of each
+	for i := 0; i < 2; i++ {
+		if err := sqliteIndex.Add(edges); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := sqliteIndex.Edges([]string{"1234", "5678"}, "malware--1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// relationship--3 is not in its collection
+	if len(found) != 2 || found[0].ID != "relationship--1" || found[1].ID != "relationship--2" {
+		t.Errorf("wrong edges: %+v", found)
+	}
+	if found, _ := sqliteIndex.Edges(nil, "malware--1"); len(found) != 0 {
+		t.Errorf("edges were found without a collection: %+v", found)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package graph
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/freetaxii/libstix2/datastore"
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/server/internal/envelopes"
+	"github.com/freetaxii/server/internal/ingest"
+	"github.com/gologme/log"
+)
+
+// EdgeTypes - The types of the objects that are the edges of the graph.
+var EdgeTypes = []string{"relationship", "sighting"}
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Index - This interface is used to find the relationships and sightings that
+refer to an object, without reading every one of them in a collection. An edge
+is kept for every version that was added, so the latest version of an edge may
+no longer refer to the object.
+*/
+type Index interface {
+	Add(edges []Edge) error
+	Edges(collectionIDs []string, id string) ([]Edge, error)
+}
+
+/*
+Indexer - This type adds the relationships and sightings that are added to a
+collection to the edge index. It implements the ingest.Notifier interface.
+*/
+type Indexer struct {
+	Logger *log.Logger
+	Index  Index
+}
+
+/*
+Edge - This type records that a relationship or sighting in a collection refers
+to an object.
+
+CollectionID - The collection the relationship or sighting was added to
+ID           - The ID of the relationship or sighting
+Ref          - The ID of the object that it refers to
+*/
+type Edge struct {
+	CollectionID string
+	ID           string
+	Ref          string
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+NewIndexer - This function will create a new Indexer that adds edges to the
+index provided.
+*/
+func NewIndexer(logger *log.Logger, index Index) *Indexer {
+	var i Indexer
+
+	if logger == nil {
+		i.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	} else {
+		i.Logger = logger
+	}
+
+	i.Index = index
+	return &i
+}
+
+/*
+NewEdges - This function will return an Edge for every object that a
+relationship or sighting added to the collection provided refers to. Other
+objects are not edges, so nothing is returned for them.
+*/
+func NewEdges(collectionID string, data []byte) []Edge {
+	var o struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &o); err != nil || isEdge(o.Type) == false {
+		return nil
+	}
+
+	id, refs := References(data)
+	edges := make([]Edge, 0, len(refs))
+	for _, ref := range refs {
+		edges = append(edges, Edge{CollectionID: collectionID, ID: id, Ref: ref})
+	}
+	return edges
+}
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+Rebuild - This function will add the latest version of every relationship and
+sighting in the collections provided to the index, so that the edges that were
+added before the index was created are found. The objects are read a page at a
+time and edges that are already in the index are kept, so the index can be
+rebuilt at any time. The number of edges that were added is returned.
+*/
+func Rebuild(logger *log.Logger, index Index, ds datastore.Datastorer, collectionIDs []string) int {
+	total := 0
+	for _, collectionID := range collectionIDs {
+		q := collections.NewCollectionQuery(collectionID, 0)
+		q.STIXType = EdgeTypes
+		pager := envelopes.New(ds, *q, 0)
+
+		for {
+			// The datastore returns an error when the query does not find
+			// anything, which only means there are no edges.
+			page, _ := pager.Next()
+			if page == nil {
+				break
+			}
+
+			var edges []Edge
+			for _, o := range page {
+				data, err := json.Marshal(o)
+				if err != nil {
+					logger.Errorln("ERROR: Unable to index an edge in collection", collectionID, err)
+					continue
+				}
+				edges = append(edges, NewEdges(collectionID, data)...)
+			}
+
+			if err := index.Add(edges); err != nil {
+				logger.Errorln("ERROR: Unable to add", len(edges), "edges in collection", collectionID, "to the graph index", err)
+				break
+			}
+			total += len(edges)
+		}
+	}
+	return total
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Indexer
+// ----------------------------------------------------------------------
+
+/*
+Notify - This method will add the relationships and sightings that were just
+added to a collection to the index. Objects that can not be indexed are logged
+and skipped, they are still in the collection.
+*/
+func (i *Indexer) Notify(collectionID string, added []ingest.Added) {
+	var edges []Edge
+	for _, v := range added {
+		edges = append(edges, NewEdges(collectionID, v.Object)...)
+	}
+	if len(edges) == 0 {
+		return
+	}
+
+	if err := i.Index.Add(edges); err != nil {
+		i.Logger.Errorln("ERROR: Unable to add", len(edges), "edges in collection", collectionID, "to the graph index", err)
+	}
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+isEdge - This function will return true if objects of the type provided are
+edges of the graph.
+*/
+func isEdge(objectType string) bool {
+	for _, v := range EdgeTypes {
+		if v == objectType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package graph
+
+import (
+	"database/sql"
+	"strings"
+)
+
+/*
+SQLiteIndex - This type implements the Index interface for the sqlite3
+datastore. The edges are kept in their own table, in the same database as the
+objects.
+*/
+type SQLiteIndex struct {
+	DB *sql.DB
+}
+
+/*
+NewSQLiteIndex - This function will create a new Index in the sqlite3
+datastore that uses the provided database connection. The table is created if
+it does not already exist.
+*/
+func NewSQLiteIndex(db *sql.DB) (*SQLiteIndex, error) {
+	tables := []string{
+		`CREATE TABLE IF NOT EXISTS t_graph_edge (
+			id INTEGER PRIMARY KEY,
+			collection_id TEXT NOT NULL,
+			stix_id TEXT NOT NULL,
+			ref TEXT NOT NULL,
+			UNIQUE (collection_id, stix_id, ref)
+		)`,
+		`CREATE INDEX IF NOT EXISTS i_graph_edge_ref ON t_graph_edge (ref)`,
+	}
+
+	for _, stmt := range tables {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return &SQLiteIndex{DB: db}, nil
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - SQLiteIndex
+// ----------------------------------------------------------------------
+
+/*
+Add - This method will add the edges to the index. Edges that are already in
+the index are kept as they are.
+*/
+func (i *SQLiteIndex) Add(edges []Edge) error {
+	tx, err := i.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range edges {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO t_graph_edge (collection_id, stix_id, ref) VALUES (?, ?, ?)`,
+			e.CollectionID, e.ID, e.Ref); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+/*
+Edges - This method will return the edges in the collections provided that
+refer to the object, in the order they were added. Edges whose relationship or
+sighting is no longer in its collection are left out.
+*/
+func (i *SQLiteIndex) Edges(collectionIDs []string, id string) ([]Edge, error) {
+	edges := make([]Edge, 0)
+	if len(collectionIDs) == 0 {
+		return edges, nil
+	}
+
+	args := []interface{}{id}
+	for _, v := range collectionIDs {
+		args = append(args, v)
+	}
+
+	stmt := `SELECT e.collection_id, e.stix_id, e.ref FROM t_graph_edge AS e
+		WHERE e.ref = ?
+		AND e.collection_id IN (?` + strings.Repeat(", ?", len(collectionIDs)-1) + `)
+		AND EXISTS (SELECT 1 FROM t_collection_data AS c WHERE c.collection_id = e.collection_id AND c.stix_id = e.stix_id)
+		ORDER BY e.id`
+
+	rows, err := i.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e Edge
+		if err := rows.Scan(&e.CollectionID, &e.ID, &e.Ref); err != nil {
+			return nil, err
+		}
+		edges = append(edges, e)
+	}
+	return edges, rows.Err()
+}
@@ -6,18 +6,24 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
-	"html/template"
+	"io"
 	"net/http"
 	"path"
 
 	"github.com/freetaxii/libstix2/defs"
-	"github.com/freetaxii/libstix2/objects"
 	"github.com/freetaxii/libstix2/resources/collections"
 	"github.com/freetaxii/libstix2/resources/envelope"
+	"github.com/freetaxii/libstix2/resources/manifest"
 	"github.com/freetaxii/libstix2/resources/status"
 	"github.com/freetaxii/libstix2/stixid"
+	"github.com/freetaxii/server/internal/browse"
+	"github.com/freetaxii/server/internal/compress"
+	"github.com/freetaxii/server/internal/envelopes"
+	"github.com/freetaxii/server/internal/filters"
 	"github.com/freetaxii/server/internal/headers"
+	"github.com/freetaxii/server/internal/ingest"
 	"github.com/gorilla/mux"
 )
 
@@ -26,7 +32,8 @@ STIXContentServerHandler - This method will handle all of the requests for STIX
 objects from the TAXII server.
 */
 func (s *ServerHandler) STIXContentServerHandler(w http.ResponseWriter, r *http.Request) {
-	var addedFirst, addedLast string
+	var addedFirst, addedLast, next string
+	var resource interface{}
 
 	s.Logger.Infoln("INFO: Found GET Request from", r.RemoteAddr, "for collection:", s.CollectionID)
 
@@ -48,18 +55,21 @@ func (s *ServerHandler) STIXContentServerHandler(w http.ResponseWriter, r *http.
 			w.Header().Set("WWW-Authenticate", `Basic realm="Authentication Required"`)
 			if success := s.authenticate(r.BasicAuth()); success != true {
 				s.Logger.Debugln("DEBUG: Authentication failed for", r.RemoteAddr, "at", r.RequestURI)
-				s.sendUnauthenticatedError(w)
+				s.sendUnauthenticatedError(w, r)
 				return
 			}
 		} else {
 			// If authentication is enabled, but basic is not, then fail since
 			// no other authentication is currently enabled.
 			s.Logger.Debugln("DEBUG: Authentication method from", r.RemoteAddr, "at", r.RequestURI, "not supported")
-			s.sendUnauthenticatedError(w)
+			s.sendUnauthenticatedError(w, r)
 			return
 		}
 	} // End Authentication Check
 
+	// The data markings this client may read
+	policy := s.Markings
+
 	// ----------------------------------------------------------------------
 	// Handle URL Parameters and Path Variables
 	// ----------------------------------------------------------------------
@@ -70,26 +80,72 @@ func (s *ServerHandler) STIXContentServerHandler(w http.ResponseWriter, r *http.
 	urlParameters := r.URL.Query()
 	s.Logger.Debugln("DEBUG: Client", r.RemoteAddr, "sent the following (", len(urlParameters), ") url parameters:", urlParameters)
 
-	errURLParameters := s.processURLParameters(q, urlParameters)
-	if errURLParameters != nil {
-		s.Logger.Warnln("WARN: invalid URL parameters from client", r.RemoteAddr, "with URL parameters", urlParameters, errURLParameters)
+	// Invalid URL parameters are reported to the client along with the
+	// interoperability match filters that are not supported
+	problems := s.processURLParameters(q, urlParameters)
+	matchFilters, filterProblems := filters.Parse(urlParameters)
+	problems = append(problems, filterProblems...)
+	if len(problems) > 0 {
+		s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to invalid URL parameters", problems)
+		s.sendURLParametersError(w, r, problems)
+		return
 	}
 
 	urlvars := mux.Vars(r)
 
+	// ----------------------------------------------------------------------
+	// Choose the media type of the response from the Accept header
+	// ----------------------------------------------------------------------
+	// TAXII 2.0 sends objects as STIX bundles, so the objects endpoints offer
+	// the STIX 2.0 media type and the manifest offers the TAXII 2.0 media type.
+	// There is no versions endpoint in TAXII 2.0.
+	taxii20MediaType := headers.MediaTypeSTIX20
+	if path.Base(r.URL.Path) == "manifest" {
+		taxii20MediaType = headers.MediaTypeTAXII20
+	} else if path.Base(r.URL.Path) == "versions" {
+		taxii20MediaType = ""
+	}
+	mediaType := s.negotiateMediaType(r, taxii20MediaType)
+
+	// A TAXII 2.0 client only understands STIX 2.0 objects
+	if mediaType != "" && mediaType == taxii20MediaType && len(q.SpecVersion) == 0 {
+		q.SpecVersion = []string{"2.0"}
+	}
+
+	// Only objects that match the media types of the collection are returned
+	if s.restrictSpecVersions(q) == false {
+		s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to a spec_version filter that does not match the media types of collection", s.CollectionID)
+		s.sendGetObjectsError(w, r)
+		return
+	}
+
 	// ----------------------------------------------------------------------
 	// Handle Requests for Manifest data
 	// ----------------------------------------------------------------------
 	if path.Base(r.URL.Path) == "manifest" {
 		s.Logger.Debugln("DEBUG: Found a GET Request for manifests")
-		results, err := s.DS.GetManifestData(*q)
+
+		// The records the client may not see, or that do not match its
+		// filters, are removed from each page as it is read, so that the
+		// response still has limit records when there are more
+		filter := func(records []manifest.ManifestRecord) []manifest.ManifestRecord {
+			return matchFilters.FilterManifest(s.DS, *q, policy.FilterManifest(s.DS, *q, records))
+		}
+
+		// TAXII 2.0 pages the manifest with the Range header
+		if mediaType != "" && mediaType == taxii20MediaType {
+			s.sendManifest20(w, r, *q, mediaType, filter)
+			return
+		}
+
+		results, err := envelopes.Manifest(s.DS, *q, envelopes.RecordLimit(*q, s.ServerRecordLimit), filter)
 
 		if err != nil {
 			s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to:", err.Error())
-			s.sendGetObjectsError(w)
+			s.sendGetObjectsError(w, r)
 			return
 		}
-		s.Resource = results.ManifestData
+		resource = results.ManifestData
 		addedFirst = results.DateAddedFirst
 		addedLast = results.DateAddedLast
 		s.Logger.Infoln("INFO: Sending response to", r.RemoteAddr)
@@ -101,16 +157,69 @@ func (s *ServerHandler) STIXContentServerHandler(w http.ResponseWriter, r *http.
 	// ----------------------------------------------------------------------
 	if path.Base(r.URL.Path) == "objects" {
 		s.Logger.Debugln("DEBUG: Found a GET Request for all objects")
-		results, err := s.DS.GetObjects(*q)
 
+		// The objects are read from the datastore a page at a time, so only the
+		// objects of the response are held in memory.
+		pager := envelopes.New(s.DS, *q, s.ServerRecordLimit)
+		pager.Filter = func(objects []interface{}) []interface{} {
+			return matchFilters.Filter(policy.Filter(objects))
+		}
+
+		// TAXII 2.0 pages the objects with the Range header
+		if mediaType != "" && mediaType == taxii20MediaType {
+			s.sendObjects20(w, r, pager, mediaType)
+			return
+		}
+
+		// A response without a limit ends after the default number of
+		// objects. The next parameter was already checked with the other URL
+		// parameters, it is only parsed again for the records to skip.
+		if pager.Limit == 0 {
+			pager.Limit = envelopes.DefaultResponseLimit
+		}
+		if mediaType == defs.MEDIA_TYPE_HTML {
+			pager.PageSize = pager.Limit
+		}
+		if values := withValues(urlParameters)["next"]; len(values) > 0 {
+			_, skip, ok := envelopes.ParseNext(values[0])
+			if ok == false {
+				s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to an invalid next URL parameter", values[0])
+				s.sendURLParametersError(w, r, []string{"next value " + values[0] + " is not valid"})
+				return
+			}
+			pager.Skip = skip
+		}
+
+		page, err := pager.Next()
 		if err != nil {
 			s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to:", err.Error())
-			s.sendGetObjectsError(w)
+			s.sendGetObjectsError(w, r)
 			return
 		}
-		s.Resource = results.ObjectData
-		addedFirst = results.DateAddedFirst
-		addedLast = results.DateAddedLast
+
+		if mediaType == defs.MEDIA_TYPE_TAXII21 || mediaType == defs.MEDIA_TYPE_JSON {
+			s.Logger.Infoln("INFO: Sending response to", r.RemoteAddr)
+			s.sendObjects(w, r, pager, page, mediaType)
+			return
+		}
+
+		// The HTML output shows one page at a time, with a link to the next
+		// page when there are more objects
+		var e envelope.Envelope
+		for page != nil {
+			e.Objects = append(e.Objects, page...)
+			if page, err = pager.Next(); err != nil {
+				s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to:", err.Error())
+				s.sendGetObjectsError(w, r)
+				return
+			}
+		}
+		next = pager.NextPage()
+		e.More = pager.More
+		e.Next = next
+		resource = e
+		addedFirst = pager.DateAddedFirst
+		addedLast = pager.DateAddedLast
 		s.Logger.Infoln("INFO: Sending response to", r.RemoteAddr)
 
 	}
@@ -141,7 +250,7 @@ func (s *ServerHandler) STIXContentServerHandler(w http.ResponseWriter, r *http.
 			q.STIXID = append(q.STIXID, urlObjectID)
 		} else {
 			s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to invalid STIX ID in object by ID path")
-			s.sendGetObjectsError(w)
+			s.sendGetObjectsError(w, r)
 			return
 		}
 
@@ -156,14 +265,16 @@ func (s *ServerHandler) STIXContentServerHandler(w http.ResponseWriter, r *http.
 				q.STIXVersion = nil
 			}
 
-			results, err := s.DS.GetVersions(*q)
+			results, err := envelopes.Versions(s.DS, *q, envelopes.RecordLimit(*q, s.ServerRecordLimit), func(versions []string) []string {
+				return matchFilters.FilterVersions(s.DS, *q, policy.FilterVersions(s.DS, *q, versions))
+			})
 
 			if err != nil {
 				s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to:", err.Error())
-				s.sendGetObjectsError(w)
+				s.sendGetObjectsError(w, r)
 				return
 			}
-			s.Resource = results.VersionsData
+			resource = results.VersionsData
 			addedFirst = results.DateAddedFirst
 			addedLast = results.DateAddedLast
 			s.Logger.Infoln("INFO: Sending response to", r.RemoteAddr)
@@ -175,10 +286,12 @@ func (s *ServerHandler) STIXContentServerHandler(w http.ResponseWriter, r *http.
 
 			if err != nil {
 				s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to:", err.Error())
-				s.sendGetObjectsError(w)
+				s.sendGetObjectsError(w, r)
 				return
 			}
-			s.Resource = results.ObjectData
+			results.ObjectData.Objects = policy.Filter(results.ObjectData.Objects)
+			results.ObjectData.Objects = matchFilters.Filter(results.ObjectData.Objects)
+			resource = results.ObjectData
 			addedFirst = results.DateAddedFirst
 			addedLast = results.DateAddedLast
 			s.Logger.Infoln("INFO: Sending response to", r.RemoteAddr)
@@ -190,10 +303,6 @@ func (s *ServerHandler) STIXContentServerHandler(w http.ResponseWriter, r *http.
 	// Encode outgoing response message
 	// --------------------------------------------------
 
-	// Get Accept Header
-	var acceptHeader headers.MediaType
-	acceptHeader.ParseTAXII(r.Header.Get("Accept"))
-
 	// Set header for TLS
 	w.Header().Add("Strict-Transport-Security", "max-age=86400; includeSubDomains")
 	w.Header().Add("X-TAXII-Date-Added-First", addedFirst)
@@ -203,49 +312,139 @@ func (s *ServerHandler) STIXContentServerHandler(w http.ResponseWriter, r *http.
 	// do a check to see if there is data coming back from the query
 	var objectNotFound = false
 	if objectNotFound == true {
-		s.sendStatusNotFound(w)
+		s.sendStatusNotFound(w, r)
 		return
 	}
 
-	if acceptHeader.TAXII21 == true {
+	// The response is encoded before it is sent so that it can be given an
+	// ETag, and the date_added of the last object is its Last-Modified time
+	var body bytes.Buffer
+
+	if mediaType == defs.MEDIA_TYPE_TAXII21 {
 		// Setup JSON stream encoder
-		j := json.NewEncoder(w)
-		w.Header().Set("Content-Type", defs.MEDIA_TYPE_TAXII21)
-		w.WriteHeader(http.StatusOK)
-		j.Encode(s.Resource)
+		j := json.NewEncoder(&body)
+		j.Encode(resource)
 
-	} else if acceptHeader.JSON == true {
+	} else if mediaType != "" && mediaType == taxii20MediaType {
 		// Setup JSON stream encoder
-		j := json.NewEncoder(w)
-		w.Header().Set("Content-Type", defs.MEDIA_TYPE_JSON)
-		w.WriteHeader(http.StatusOK)
+		j := json.NewEncoder(&body)
+		j.Encode(taxii20Resource(resource))
+
+	} else if mediaType == defs.MEDIA_TYPE_JSON {
+		// Setup JSON stream encoder
+		j := json.NewEncoder(&body)
 		j.SetIndent("", "    ")
-		j.Encode(s.Resource)
+		j.Encode(resource)
+
+	} else if mediaType == defs.MEDIA_TYPE_HTML {
+		// The HTML pages show the objects, manifest records, or versions in a
+		// table, with links between the pages of the collection and a form
+		// for the match filters.
+		// The page is rendered from a copy of the handler, since it is shared
+		// by every request.
+		page := *s
+		page.Page = browse.New(s.collectionURL(), r.URL, urlvars["objectid"], resource)
+		if next == "" {
+			next = addedLast
+		}
+		page.Page.SetNext(r.URL, next)
 
-	} else if s.HTMLEnabled == true && acceptHeader.HTML == true {
-		w.Header().Set("Content-Type", defs.MEDIA_TYPE_HTML)
-		w.WriteHeader(http.StatusOK)
 		// I needed to convert this to actual JSON since if I just used
 		// s.Resource like in other handlers I would get the string output of
-		// a Golang struct which is not the same. The reason it works else where
-		// is I am not printing the whole object, but rather, referencing the
-		// parts as I need them.
-		jsondata, err := json.MarshalIndent(s.Resource, "", "    ")
+		// a Golang struct which is not the same.
+		jsondata, err := json.MarshalIndent(resource, "", "    ")
 		if err != nil {
-			s.Logger.Fatal("Unable to create JSON Message")
+			s.Logger.Errorln("ERROR: Unable to create JSON Message", err)
+			s.sendGetObjectsError(w, r)
+			return
 		}
-		s.Resource = string(jsondata)
+		page.Resource = string(jsondata)
 
 		// ----------------------------------------------------------------------
 		// Setup HTML Template
 		// ----------------------------------------------------------------------
-		htmlTemplateResource := template.Must(template.ParseFiles(s.HTMLTemplate))
-		htmlTemplateResource.Execute(w, s)
+		if err := s.Templates.Execute(&body, s.HTMLTemplate, page); err != nil {
+			s.Logger.Errorln("ERROR: Unable to render the HTML template", s.HTMLTemplate, err)
+			s.sendHTMLTemplateError(w, r)
+			return
+		}
 
 	} else {
-		s.sendNotAcceptableError(w)
+		s.sendNotAcceptableError(w, r)
+		return
+	}
+
+	s.sendResource(w, r, mediaType, body.Bytes(), addedLast)
+}
+
+/*
+sendObjects - This method will send the objects of a Pager in a TAXII envelope,
+starting with the page that was already read, along with the value of the next
+URL parameter that continues after them, which the client can send back to get
+the following page. When that page is the whole response it is encoded first
+and sent like any other resource, with an ETag and a Last-Modified header.
+Otherwise each page is written to the client as soon as it is read, so only one
+page is held in memory. The date_added of the last object is then only known at
+the end, so it is sent as a trailer and the response has no validators for a
+conditional GET. A datastore error after the first page ends the envelope
+early, with more set and a next that continues after the last object that was
+sent, so the client does not lose any objects.
+*/
+func (s *ServerHandler) sendObjects(w http.ResponseWriter, r *http.Request, pager *envelopes.Pager, page []interface{}, mediaType string) {
+	w.Header().Add("Strict-Transport-Security", "max-age=86400; includeSubDomains")
+	w.Header().Add("X-TAXII-Date-Added-First", pager.DateAddedFirst)
+
+	if pager.Done() == true {
+		var body bytes.Buffer
+		e := newObjectsWriter(&body, mediaType)
+		for _, o := range page {
+			e.WriteObject(o)
+		}
+		if err := e.Close(pager.More, pager.NextPage()); err != nil {
+			s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to:", err.Error())
+			s.sendGetObjectsError(w, r)
+			return
+		}
+
+		w.Header().Add("X-TAXII-Date-Added-Last", pager.DateAddedLast)
+		s.sendResource(w, r, mediaType, body.Bytes(), pager.DateAddedLast)
+		return
+	}
+
+	w.Header().Set("Trailer", "X-TAXII-Date-Added-Last")
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(http.StatusOK)
+
+	var err error
+	e := newObjectsWriter(w, mediaType)
+	for page != nil {
+		for _, o := range page {
+			if err := e.WriteObject(o); err != nil {
+				s.Logger.Infoln("INFO: Unable to send objects to", r.RemoteAddr, "due to:", err.Error())
+				return
+			}
+		}
+		if page, err = pager.Next(); err != nil {
+			s.Logger.Errorln("ERROR: Ending the response to", r.RemoteAddr, "early, unable to read the objects of collection", s.CollectionID, "due to:", err.Error())
+		}
+	}
+
+	if err := e.Close(pager.More, pager.NextPage()); err != nil {
+		s.Logger.Infoln("INFO: Unable to send objects to", r.RemoteAddr, "due to:", err.Error())
 		return
 	}
+	w.Header().Set("X-TAXII-Date-Added-Last", pager.DateAddedLast)
+}
+
+/*
+newObjectsWriter - This function will create the envelope writer for the media
+type of the response, the JSON media type is indented.
+*/
+func newObjectsWriter(w io.Writer, mediaType string) *envelopes.Writer {
+	if mediaType == defs.MEDIA_TYPE_JSON {
+		return envelopes.NewWriter(w, "    ")
+	}
+	return envelopes.NewWriter(w, "")
 }
 
 /*
@@ -274,14 +473,14 @@ func (s *ServerHandler) ObjectsServerWriteHandler(w http.ResponseWriter, r *http
 			w.Header().Set("WWW-Authenticate", `Basic realm="Authentication Required"`)
 			if success := s.authenticate(r.BasicAuth()); success != true {
 				s.Logger.Debugln("DEBUG: Authentication failed for", r.RemoteAddr, "at", r.RequestURI)
-				s.sendUnauthenticatedError(w)
+				s.sendUnauthenticatedError(w, r)
 				return
 			}
 		} else {
 			// If authentication is enabled, but basic is not, then fail since
 			// no other authentication is currently enabled.
 			s.Logger.Debugln("DEBUG: Authentication method from", r.RemoteAddr, "at", r.RequestURI, "not supported")
-			s.sendUnauthenticatedError(w)
+			s.sendUnauthenticatedError(w, r)
 			return
 		}
 	} // End Authentication Check
@@ -290,10 +489,10 @@ func (s *ServerHandler) ObjectsServerWriteHandler(w http.ResponseWriter, r *http
 	// Check content-type header first
 	// ----------------------------------------------------------------------
 	var contentHeader headers.MediaType
-	contentHeader.ParseTAXII(r.Header.Get("Content-type"))
+	contentHeader.ParseContentType(r.Header.Get("Content-type"))
 
 	if contentHeader.TAXII21 != true {
-		s.sendUnsupportedMediaTypeError(w)
+		s.sendUnsupportedMediaTypeError(w, r)
 		return
 	}
 
@@ -306,71 +505,45 @@ func (s *ServerHandler) ObjectsServerWriteHandler(w http.ResponseWriter, r *http
 	// Decode the envelope object itself, but leave the objects array as an
 	// array of raw JSON object objects, we will decode each one later.
 	// ----------------------------------------------------------------------
-	e, err := envelope.DecodeRaw(r.Body)
-	if err != nil {
+	// The body may be compressed. The max_content_length of the API root is
+	// applied to the decompressed size so that a small compressed body can not
+	// expand in to more data than the server accepts.
+	requestBody, err := compress.Body(r, s.MaxContentLength)
+	if err == compress.ErrUnsupportedEncoding {
+		s.Logger.Infoln("INFO: Client", r.RemoteAddr, "sent an unsupported Content-Encoding of", r.Header.Get("Content-Encoding"))
+		s.sendUnsupportedEncodingError(w, r)
+		return
+	} else if err != nil {
+		s.Logger.Infoln("INFO: Could not decompress the body from", r.RemoteAddr, err)
+		s.sendParseObjectsError(w, r)
+		return
+	}
+	defer requestBody.Close()
+
+	e, err := envelope.DecodeRaw(requestBody)
+	if err == compress.ErrTooLarge {
+		s.Logger.Infoln("INFO: Client", r.RemoteAddr, "sent a body larger than the max_content_length of", s.MaxContentLength)
+		s.sendRequestTooLargeError(w, r)
+		return
+	} else if err != nil {
 		s.Logger.Errorln("ERROR: Could not decode provided envelope")
 
-		s.sendParseObjectsError(w)
+		s.sendParseObjectsError(w, r)
 		return
 	}
 
 	// ----------------------------------------------------------------------
 	// Decode each object in the envelope one at a time. If the object is valid
-	// write it off to the datastore.
-	// Lets keep a count of the number of objects that are successful and the
-	// number that are not successful in addition to a total count
+	// write it off to the datastore. The ingester keeps a count of the number
+	// of objects that are successful and the number that are not successful
+	// in addition to a total count and records them in the status resource.
 	// ----------------------------------------------------------------------
-	totalCount := 0
-	successCount := 0
-	failureCount := 0
-	for _, v := range e.Objects {
-		totalCount++
-		s.Logger.Debugln("DEBUG: Processing envelope object number", totalCount)
-
-		// First, decode the first object from the envelope if it succeeds try to
-		// add it to the datastore
-		o, err := objects.Decode(v)
-		id := o.GetID()
-		if err != nil {
-			// TODO Track something to send error back to client in status resource
-			s.Logger.Errorln("ERROR: Error decoding object in envelope", err)
-			failureCount++
-			statusMessage.CreateFailureDetails(id, "", "Object failed")
-			// If there is an error, lets just skip and move on to the next object
-			continue
-		}
-
-		// Add the object to the datastore, if the decode was successful
-		s.Logger.Debugln("DEBUG: Adding object", id, "to the datastore")
-		err = s.DS.AddObject(o)
-		if err != nil {
-			s.Logger.Errorln("ERROR: Error adding object", id, "to datastore", err)
-			failureCount++
-			statusMessage.CreateFailureDetails(id, "", "Object failed")
-			// If there was an error, lets just skip and move on to the next object
-			continue
-		}
-		successCount++
-		statusMessage.CreateSuccessDetails(id, "", "Object added")
-
-		// If the add was successful then lets add an entry in to the collection
-		// record table.
-		s.Logger.Debugln("DEBUG: Adding Collection Entry of", s.CollectionID, id)
-		err = s.DS.AddToCollection(s.CollectionID, id)
-		if err != nil {
-			s.Logger.Debugln(err)
-		}
-	}
-
-	statusMessage.SetTotalCount(totalCount)
-	statusMessage.SetSuccessCount(successCount)
-	statusMessage.SetFailureCount(failureCount)
-
-	s.Resource = statusMessage
-
-	s.Logger.Debugln("DEBUG: Total number of objects in Envelope", totalCount)
-	s.Logger.Debugln("DEBUG: Total objects successfully added to datastore", successCount)
-	s.Logger.Debugln("DEBUG: Total objects that failed to be added to the datastore", failureCount)
+	in := ingest.New(s.Logger, s.DS, s.CollectionID)
+	in.Notifier = s.Notifier
+	in.SpecVersions = s.SpecVersions
+	in.Versions = s.Versions
+	in.Markings = s.Markings
+	in.Ingest(e.Objects, statusMessage)
 
 	s.Logger.Infoln("INFO: Sending response to", r.RemoteAddr)
 
@@ -378,51 +551,60 @@ func (s *ServerHandler) ObjectsServerWriteHandler(w http.ResponseWriter, r *http
 	// Encode outgoing response message
 	// --------------------------------------------------
 
-	// Get Accept Header
-	var acceptHeader headers.MediaType
-	acceptHeader.ParseTAXII(r.Header.Get("Accept"))
+	// Choose the media type of the response from the Accept header
+	mediaType := s.negotiateMediaType(r, "")
 
 	// Set header for TLS
 	w.Header().Add("Strict-Transport-Security", "max-age=86400; includeSubDomains")
 
-	if acceptHeader.TAXII21 == true {
+	if mediaType == defs.MEDIA_TYPE_TAXII21 {
 		// Setup JSON stream encoder for response
 		j := json.NewEncoder(w)
 		w.Header().Set("Content-Type", defs.MEDIA_TYPE_TAXII21)
 		w.WriteHeader(http.StatusAccepted)
-		j.Encode(s.Resource)
+		j.Encode(statusMessage)
 
-	} else if acceptHeader.JSON == true {
+	} else if mediaType == defs.MEDIA_TYPE_JSON {
 		// Setup JSON stream encoder for response
 		j := json.NewEncoder(w)
 		w.Header().Set("Content-Type", defs.MEDIA_TYPE_JSON)
 		w.WriteHeader(http.StatusAccepted)
 		j.SetIndent("", "    ")
-		j.Encode(s.Resource)
-
-	} else if s.HTMLEnabled == true && acceptHeader.HTML == true {
-		w.Header().Set("Content-Type", defs.MEDIA_TYPE_HTML)
-		w.WriteHeader(http.StatusAccepted)
+		j.Encode(statusMessage)
 
+	} else if mediaType == defs.MEDIA_TYPE_HTML {
 		// I needed to convert this to actual JSON since if I just used
 		// s.Resource like in other handlers I would get the string output of
 		// a Golang struct which is not the same. The reason it works else where
 		// is I am not printing the whole object, but rather, referencing the
 		// parts as I need them.
-		jsondata, err := json.MarshalIndent(s.Resource, "", "    ")
+		jsondata, err := json.MarshalIndent(statusMessage, "", "    ")
 		if err != nil {
 			s.Logger.Fatal("Unable to create JSON Message")
 		}
-		s.Resource = string(jsondata)
+
+		// The page is rendered from a copy of the handler, since it is shared
+		// by every request.
+		page := *s
+		page.Resource = string(jsondata)
 
 		// ----------------------------------------------------------------------
 		// Setup HTML Template
 		// ----------------------------------------------------------------------
-		htmlTemplateResource := template.Must(template.ParseFiles(s.HTMLTemplate))
-		htmlTemplateResource.Execute(w, s)
+		// The page is rendered before the status is sent, so that a template
+		// that fails can still be reported as an error
+		var body bytes.Buffer
+		if err := s.Templates.Execute(&body, s.HTMLTemplate, page); err != nil {
+			s.Logger.Errorln("ERROR: Unable to render the HTML template", s.HTMLTemplate, err)
+			s.sendHTMLTemplateError(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", defs.MEDIA_TYPE_HTML)
+		w.WriteHeader(http.StatusAccepted)
+		body.WriteTo(w)
 
 	} else {
-		s.sendNotAcceptableError(w)
+		s.sendNotAcceptableError(w, r)
 		return
 	}
 }
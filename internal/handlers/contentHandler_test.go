@@ -0,0 +1,295 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/freetaxii/libstix2/defs"
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/server/internal/storetest"
+	"github.com/freetaxii/server/internal/templates"
+)
+
+// labelled - This function returns a datastore with six indicators, the even
+// ones have the label even, and a malware.
+func labelled() *storetest.Store {
+	ds := storetest.New()
+	for i := 0; i < 6; i++ {
+		label := "odd"
+		if i%2 == 0 {
+			label = "even"
+		}
+		ds.Add("1234", fmt.Sprintf("2018-01-01T00:00:%02d.000000Z", i),
+			fmt.Sprintf(`{"type": "indicator", "id": "indicator--%d", "modified": "2018-01-01T00:00:00.000Z", "labels": ["%s"]}`, i, label))
+	}
+	ds.Add("1234", "2018-01-01T00:00:10.000000Z", `{"type": "malware", "id": "malware--1", "modified": "2018-01-01T00:00:00.000Z"}`)
+	return ds
+}
+
+// ----------------------------------------------------------------------
+func Test_ManifestMatchFilter(t *testing.T) {
+	s := objectsHandler(labelled())
+
+	// The filter is applied as the records are read, so the page still has
+	// the number of records the client asked for
+	rr := get(s.STIXContentServerHandler, "/api1/collections/1234/manifest/?match[labels]=even&limit=2", defs.MEDIA_TYPE_TAXII21)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("wrong status: %d %s", rr.Code, rr.Body.String())
+	}
+
+	var m struct {
+		More    bool
+		Objects []struct{ ID string }
+	}
+	json.Unmarshal(rr.Body.Bytes(), &m)
+	if len(m.Objects) != 2 || m.Objects[0].ID != "indicator--0" || m.Objects[1].ID != "indicator--2" || m.More != true {
+		t.Errorf("wrong manifest: %s", rr.Body.String())
+	}
+	if rr.Header().Get("X-TAXII-Date-Added-Last") != "2018-01-01T00:00:02.000000Z" {
+		t.Errorf("wrong X-TAXII-Date-Added-Last: %s", rr.Header().Get("X-TAXII-Date-Added-Last"))
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_RepeatedMatchFilter(t *testing.T) {
+	s := objectsHandler(labelled())
+
+	// The values of a match filter that is given more than once are merged
+	rr := get(s.STIXContentServerHandler, "/api1/collections/1234/objects/?match[type]=malware&match[type]=indicator&match[labels]=even&match[labels]=odd", defs.MEDIA_TYPE_TAXII21)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("wrong status: %d %s", rr.Code, rr.Body.String())
+	}
+
+	var e struct{ Objects []interface{} }
+	json.Unmarshal(rr.Body.Bytes(), &e)
+	if len(e.Objects) != 6 {
+		t.Errorf("expected the six indicators, got %d: %s", len(e.Objects), rr.Body.String())
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_EmptyParameters(t *testing.T) {
+	s := objectsHandler(labelled())
+
+	// Parameters without a value are ignored instead of being an error
+	for _, query := range []string{
+		"match[type]=",
+		"match[labels]=&match[id]=",
+		"added_after=&limit=&next=",
+		"match[type]=&match[type]=malware",
+	} {
+		rr := get(s.STIXContentServerHandler, "/api1/collections/1234/objects/?"+query, defs.MEDIA_TYPE_TAXII21)
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: wrong status %d: %s", query, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_MalformedParameters(t *testing.T) {
+	s := objectsHandler(labelled())
+
+	for _, query := range []string{
+		"limit=abc",
+		"limit=0",
+		"limit=1&limit=2",
+		"added_after=yesterday",
+		"added_after=2018-01-01T00:00:00Z&next=2018-01-01T00:00:00Z",
+		"next=yesterday",
+		"next=2018-01-01T00:00:00Z~two",
+		"match[type]=Indicator",
+		"match[id]=indicator",
+		"match[version]=newest",
+		"match[spec_version]=1.0",
+		"match[color]=red",
+	} {
+		rr := get(s.STIXContentServerHandler, "/api1/collections/1234/objects/?"+query, defs.MEDIA_TYPE_TAXII21)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: wrong status %d: %s", query, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_ObjectsNext(t *testing.T) {
+	// Four indicators share a date_added, which is more than fit on a page
+	ds := labelled()
+	for i := 6; i < 10; i++ {
+		ds.Add("1234", "2018-01-01T00:00:05.000000Z", fmt.Sprintf(`{"type": "indicator", "id": "indicator--%d", "modified": "2018-01-01T00:00:00.000Z"}`, i))
+	}
+	s := objectsHandler(ds)
+
+	got := make(map[string]bool)
+	url := "/api1/collections/1234/objects/?limit=3"
+	for pages := 0; pages < 10 && url != ""; pages++ {
+		rr := get(s.STIXContentServerHandler, url, defs.MEDIA_TYPE_TAXII21)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("wrong status: %d %s", rr.Code, rr.Body.String())
+		}
+		if rr.Header().Get("Trailer") != "" || rr.Header().Get("X-TAXII-Date-Added-Last") == "" {
+			t.Errorf("X-TAXII-Date-Added-Last is not sent as a header: %v", rr.Header())
+		}
+
+		var e struct {
+			More    bool
+			Next    string
+			Objects []struct{ ID string }
+		}
+		json.Unmarshal(rr.Body.Bytes(), &e)
+		for _, o := range e.Objects {
+			if got[o.ID] == true {
+				t.Errorf("%s was sent twice", o.ID)
+			}
+			got[o.ID] = true
+		}
+
+		url = ""
+		if e.More == true {
+			url = "/api1/collections/1234/objects/?limit=3&next=" + e.Next
+		}
+	}
+
+	if len(got) != 11 {
+		t.Errorf("got %d objects want 11: %v", len(got), got)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_ConditionalGet(t *testing.T) {
+	s := objectsHandler(labelled())
+
+	for _, endpoint := range []string{"objects", "manifest"} {
+		url := "/api1/collections/1234/" + endpoint + "/"
+		rr := get(s.STIXContentServerHandler, url, defs.MEDIA_TYPE_TAXII21)
+		if rr.Header().Get("Last-Modified") != "Mon, 01 Jan 2018 00:00:10 GMT" || rr.Header().Get("ETag") == "" {
+			t.Errorf("%s: wrong validators: %v", endpoint, rr.Header())
+		}
+		etag := rr.Header().Get("ETag")
+
+		tests := []struct {
+			name   string
+			header []string
+			status int
+		}{
+			{"same date", []string{"If-Modified-Since", "Mon, 01 Jan 2018 00:00:10 GMT"}, http.StatusNotModified},
+			{"earlier date", []string{"If-Modified-Since", "Mon, 01 Jan 2018 00:00:09 GMT"}, http.StatusOK},
+			{"etag", []string{"If-None-Match", etag}, http.StatusNotModified},
+			{"other etag wins over date", []string{"If-None-Match", `W/"abc"`, "If-Modified-Since", "Mon, 01 Jan 2018 00:00:10 GMT"}, http.StatusOK},
+		}
+		for _, tt := range tests {
+			if rr := get(s.STIXContentServerHandler, url, defs.MEDIA_TYPE_TAXII21, tt.header...); rr.Code != tt.status {
+				t.Errorf("%s %s: wrong status %d want %d", endpoint, tt.name, rr.Code, tt.status)
+			}
+		}
+	}
+}
+
+// failingStore - This type is a datastore that returns an error for the
+// objects of every query after the first few.
+type failingStore struct {
+	*storetest.Store
+	queries int
+}
+
+func (s *failingStore) GetObjects(q collections.CollectionQuery) (*collections.CollectionQueryResult, error) {
+	s.queries++
+	if s.queries == 2 {
+		return nil, errors.New("database is locked")
+	}
+	return s.Store.GetObjects(q)
+}
+
+// ----------------------------------------------------------------------
+func Test_ObjectsStream(t *testing.T) {
+	ds := storetest.New()
+	for i := 0; i < 150; i++ {
+		ds.Add("1234", fmt.Sprintf("2018-01-01T00:%02d:%02d.000000Z", i/60, i%60),
+			fmt.Sprintf(`{"type": "indicator", "id": "indicator--%d", "modified": "2018-01-01T00:00:00.000Z"}`, i))
+	}
+
+	type response struct {
+		More    bool
+		Next    string
+		Objects []struct{ ID string }
+	}
+
+	// More than one page is written as it is read, with the date_added of
+	// the last object in a trailer
+	s := objectsHandler(ds)
+	s.ServerRecordLimit = 0
+	rr := get(s.STIXContentServerHandler, "/api1/collections/1234/objects/", defs.MEDIA_TYPE_TAXII21)
+	var e response
+	if err := json.Unmarshal(rr.Body.Bytes(), &e); err != nil || len(e.Objects) != 150 || e.More == true {
+		t.Fatalf("wrong envelope: %v %d %v", err, len(e.Objects), e.More)
+	}
+	if last := rr.Result().Trailer.Get("X-TAXII-Date-Added-Last"); last != "2018-01-01T00:02:29.000000Z" {
+		t.Errorf("wrong X-TAXII-Date-Added-Last trailer: %q", last)
+	}
+	if rr.Header().Get("ETag") != "" {
+		t.Errorf("a streamed response has an ETag: %v", rr.Header())
+	}
+
+	// An error after the first page ends the envelope early, and the next
+	// property continues after the last object that was sent
+	s.DS = &failingStore{Store: ds}
+	rr = get(s.STIXContentServerHandler, "/api1/collections/1234/objects/", defs.MEDIA_TYPE_TAXII21)
+	e = response{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &e); err != nil || len(e.Objects) != 100 || e.More != true || e.Next == "" {
+		t.Fatalf("wrong envelope after an error: %v %d %v %q", err, len(e.Objects), e.More, e.Next)
+	}
+
+	rr = get(s.STIXContentServerHandler, "/api1/collections/1234/objects/?next="+e.Next, defs.MEDIA_TYPE_TAXII21)
+	var rest response
+	json.Unmarshal(rr.Body.Bytes(), &rest)
+	if len(rest.Objects) != 50 || rest.Objects[0].ID != "indicator--100" || rest.More == true {
+		t.Errorf("wrong objects after the error: %s", rr.Body.String())
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_HTMLPages(t *testing.T) {
+	s := objectsHandler(labelled())
+	s.HTMLEnabled = true
+	s.Templates = templates.New(storetest.Logger())
+
+	// A filter form that is sent without JavaScript has every field, so the
+	// empty ones must not be rejected
+	tests := []struct {
+		template string
+		url      string
+		want     string
+	}{
+		{templates.Objects, "/api1/collections/1234/objects/?match[type]=malware&match[id]=&match[version]=&added_after=&limit=", "malware--1"},
+		{templates.Manifest, "/api1/collections/1234/manifest/?match[labels]=even&match[type]=", "indicator--4"},
+	}
+
+	for _, tt := range tests {
+		s.HTMLTemplate = templates.BuiltIn + tt.template
+		rr := get(s.STIXContentServerHandler, tt.url, defs.MEDIA_TYPE_HTML)
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: wrong status: %d %s", tt.url, rr.Code, rr.Body.String())
+			continue
+		}
+
+		// The resource is shown as JSON as well as in the table
+		body := rr.Body.String()
+		if strings.Contains(body, tt.want) == false || strings.Contains(body, "<pre>{\n") == false {
+			t.Errorf("%s: the page does not show the resource: %s", tt.url, body)
+		}
+
+		// The handler is shared by every request, so the page is rendered
+		// from a copy of it
+		if s.Page != nil || s.Resource != nil {
+			t.Errorf("%s: the request changed the handler", tt.url)
+		}
+	}
+}
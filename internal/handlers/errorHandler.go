@@ -0,0 +1,65 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/freetaxii/server/internal/headers"
+)
+
+/*
+NotFoundHandler - This method will handle the requests for paths that are not
+served, with a TAXII error or, when a browser asks for HTML, an error page.
+*/
+func (s *ServerHandler) NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	s.Logger.Infoln("INFO: Found Request from", r.RemoteAddr, "for a path that is not served:", r.URL.Path)
+
+	// If trace is enabled in the logger, than decode the HTTP Request to the log
+	if s.Logger.GetLevel("trace") {
+		headers.DebugHttpRequest(r)
+	}
+
+	s.sendPathNotFoundError(w, r)
+}
+
+/*
+ForbiddenHandler - This method will handle the requests for a collection that
+the client does not have access to, like a GET request for the objects of a
+collection that can not be read.
+*/
+func (s *ServerHandler) ForbiddenHandler(w http.ResponseWriter, r *http.Request) {
+	s.Logger.Infoln("INFO: Found", r.Method, "Request from", r.RemoteAddr, "for collection:", s.CollectionID, "that is not allowed")
+
+	// If trace is enabled in the logger, than decode the HTTP Request to the log
+	if s.Logger.GetLevel("trace") {
+		headers.DebugHttpRequest(r)
+	}
+
+	// --------------------------------------------------
+	// 1st Check Authentication
+	// --------------------------------------------------
+	// A client that is not authenticated is asked for its credentials first,
+	// since it may have access once it is authenticated.
+	if s.Authenticated == true {
+		s.Logger.Debugln("DEBUG: Authentication Enabled")
+		if s.BasicAuth == true {
+			s.Logger.Debugln("DEBUG: Basic Authentication Enabled")
+			w.Header().Set("WWW-Authenticate", `Basic realm="Authentication Required"`)
+			if success := s.authenticate(r.BasicAuth()); success != true {
+				s.Logger.Debugln("DEBUG: Authentication failed for", r.RemoteAddr, "at", r.RequestURI)
+				s.sendUnauthenticatedError(w, r)
+				return
+			}
+		} else {
+			s.Logger.Debugln("DEBUG: Authentication method from", r.RemoteAddr, "at", r.RequestURI, "not supported")
+			s.sendUnauthenticatedError(w, r)
+			return
+		}
+	} // End Authentication Check
+
+	s.sendForbiddenError(w, r)
+}
@@ -0,0 +1,62 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/freetaxii/libstix2/defs"
+	"github.com/freetaxii/server/internal/storetest"
+	"github.com/freetaxii/server/internal/templates"
+)
+
+// errorHandler - This function returns a handler that renders its errors with
+// the built in HTML error template.
+func errorHandler() ServerHandler {
+	s, _ := New(storetest.Logger())
+	s.CollectionID = "1234"
+	s.HTMLEnabled = true
+	s.HTMLErrorTemplate = templates.BuiltIn + templates.Error
+	s.Templates = templates.New(storetest.Logger())
+	return s
+}
+
+// ----------------------------------------------------------------------
+func Test_ErrorHandlers(t *testing.T) {
+	s := errorHandler()
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		accept  string
+		status  int
+		want    string
+	}{
+		{"not found html", s.NotFoundHandler, "text/html", http.StatusNotFound, "<h2>Resource Not Found</h2>"},
+		{"not found taxii", s.NotFoundHandler, defs.MEDIA_TYPE_TAXII21, http.StatusNotFound, `"title": "Resource Not Found"`},
+		{"forbidden html", s.ForbiddenHandler, "text/html", http.StatusForbidden, "403 Forbidden"},
+		{"forbidden taxii", s.ForbiddenHandler, defs.MEDIA_TYPE_TAXII21, http.StatusForbidden, `"http_status": "403 Forbidden"`},
+	}
+
+	for _, tt := range tests {
+		rr := get(tt.handler, "/api1/collections/1234/objects/", tt.accept)
+		if rr.Code != tt.status {
+			t.Errorf("%s: got status %d want %d", tt.name, rr.Code, tt.status)
+		}
+		if strings.Contains(rr.Body.String(), tt.want) == false {
+			t.Errorf("%s: the body does not contain %s: %s", tt.name, tt.want, rr.Body.String())
+		}
+	}
+
+	// A client that is not authenticated is asked for its credentials first
+	s.Authenticated = true
+	s.BasicAuth = true
+	if rr := get(s.ForbiddenHandler, "/api1/collections/1234/objects/", defs.MEDIA_TYPE_TAXII21); rr.Code != http.StatusUnauthorized {
+		t.Errorf("got status %d for a client that is not authenticated, want 401", rr.Code)
+	}
+}
@@ -6,8 +6,10 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	"github.com/freetaxii/libstix2/defs"
 	"github.com/freetaxii/libstix2/resources/taxiierror"
@@ -17,22 +19,28 @@ import (
 sendUnauthenticatedError - This method will send the correct TAXII error message
 for a session that is unauthenticated.
 */
-func (s *ServerHandler) sendUnauthenticatedError(w http.ResponseWriter) {
-
-	// Setup JSON stream encoder
-	j := json.NewEncoder(w)
-
-	w.Header().Set("Content-Type", defs.MEDIA_TYPE_TAXII21)
-	w.WriteHeader(http.StatusUnauthorized)
-
+func (s *ServerHandler) sendUnauthenticatedError(w http.ResponseWriter, r *http.Request) {
 	e := taxiierror.New()
 	e.SetTitle("Authentication Required")
 	e.SetDescription("The requested resources requires authentication.")
 	e.SetErrorCode("401")
 	e.SetHTTPStatus("401 Unauthorized")
 
-	j.SetIndent("", "    ")
-	j.Encode(e)
+	s.sendError(w, r, http.StatusUnauthorized, e)
+}
+
+/*
+sendForbiddenError - This method will send the correct TAXII error message for
+a session that does not have access to the requested resource.
+*/
+func (s *ServerHandler) sendForbiddenError(w http.ResponseWriter, r *http.Request) {
+	e := taxiierror.New()
+	e.SetTitle("Forbidden")
+	e.SetDescription("The client does not have access to the requested resource.")
+	e.SetErrorCode("403")
+	e.SetHTTPStatus("403 Forbidden")
+
+	s.sendError(w, r, http.StatusForbidden, e)
 }
 
 /*
@@ -40,22 +48,14 @@ sendNotAcceptableError - This method will send the correct TAXII error
 message for a session that requests an unsupported media type in the accept
 header.
 */
-func (s *ServerHandler) sendNotAcceptableError(w http.ResponseWriter) {
-
-	// Setup JSON stream encoder
-	j := json.NewEncoder(w)
-
-	w.Header().Set("Content-Type", defs.MEDIA_TYPE_TAXII21)
-	w.WriteHeader(http.StatusNotAcceptable)
-
+func (s *ServerHandler) sendNotAcceptableError(w http.ResponseWriter, r *http.Request) {
 	e := taxiierror.New()
 	e.SetTitle("Wrong Media Type")
 	e.SetDescription("The requested media type in the accept header is not supported.")
 	e.SetErrorCode("406")
 	e.SetHTTPStatus("406 Not Acceptable")
 
-	j.SetIndent("", "    ")
-	j.Encode(e)
+	s.sendError(w, r, http.StatusNotAcceptable, e)
 }
 
 /*
@@ -63,86 +63,175 @@ sendUnsupportedMediaTypeError - This method will send the correct TAXII error
 message for a session that requests an unsupported media type in the content-type
 header.
 */
-func (s *ServerHandler) sendUnsupportedMediaTypeError(w http.ResponseWriter) {
-
-	// Setup JSON stream encoder
-	j := json.NewEncoder(w)
-
-	w.Header().Set("Content-Type", defs.MEDIA_TYPE_TAXII21)
-	w.WriteHeader(http.StatusUnsupportedMediaType)
-
+func (s *ServerHandler) sendUnsupportedMediaTypeError(w http.ResponseWriter, r *http.Request) {
 	e := taxiierror.New()
 	e.SetTitle("Wrong Media Type")
 	e.SetDescription("The requested media type in the content-type header is not supported.")
 	e.SetErrorCode("415")
 	e.SetHTTPStatus("415 Unsupported Media Type")
 
-	j.SetIndent("", "    ")
-	j.Encode(e)
+	s.sendError(w, r, http.StatusUnsupportedMediaType, e)
 }
 
 /*
 sendGetObjectsError - This method will send the correct TAXII error
 message for a session that requests some objects but an error is returned.
 */
-func (s *ServerHandler) sendGetObjectsError(w http.ResponseWriter) {
-
-	// Setup JSON stream encoder
-	j := json.NewEncoder(w)
-
-	w.Header().Set("Content-Type", defs.MEDIA_TYPE_TAXII21)
-	w.WriteHeader(http.StatusNotFound)
-
+func (s *ServerHandler) sendGetObjectsError(w http.ResponseWriter, r *http.Request) {
 	e := taxiierror.New()
 	e.SetTitle("Get Objects Error")
 	e.SetDescription("The request for objects caused an error.")
 	e.SetErrorCode("404")
 	e.SetHTTPStatus("404 Not Found")
 
-	j.SetIndent("", "    ")
-	j.Encode(e)
+	s.sendError(w, r, http.StatusNotFound, e)
 }
 
 /*
 sendParseObjectsError - This method will send the correct TAXII error
 message for a session that posts some objects but an error is returned.
 */
-func (s *ServerHandler) sendParseObjectsError(w http.ResponseWriter) {
-
-	// Setup JSON stream encoder
-	j := json.NewEncoder(w)
-
-	w.Header().Set("Content-Type", defs.MEDIA_TYPE_TAXII21)
-	w.WriteHeader(http.StatusBadRequest)
-
+func (s *ServerHandler) sendParseObjectsError(w http.ResponseWriter, r *http.Request) {
 	e := taxiierror.New()
 	e.SetTitle("Post Objects Error")
 	e.SetDescription("The request to post objects caused an error.")
 	e.SetErrorCode("400")
 	e.SetHTTPStatus("400 Bad Request")
 
-	j.SetIndent("", "    ")
-	j.Encode(e)
+	s.sendError(w, r, http.StatusBadRequest, e)
 }
 
 /*
 sendStatusNotFound - This method will send the correct TAXII error
 message for a session that requests some objects but no records were found.
 */
-func (s *ServerHandler) sendStatusNotFound(w http.ResponseWriter) {
-
-	// Setup JSON stream encoder
-	j := json.NewEncoder(w)
-
-	w.Header().Set("Content-Type", defs.MEDIA_TYPE_TAXII21)
-	w.WriteHeader(http.StatusNotFound)
-
+func (s *ServerHandler) sendStatusNotFound(w http.ResponseWriter, r *http.Request) {
 	e := taxiierror.New()
 	e.SetTitle("No Objects Found")
 	e.SetDescription("There were no objects returned matching the request.")
 	e.SetErrorCode("404")
 	e.SetHTTPStatus("404 Not Found")
 
+	s.sendError(w, r, http.StatusNotFound, e)
+}
+
+/*
+sendPathNotFoundError - This method will send the correct TAXII error message
+for a session that requests a path that the server does not serve.
+*/
+func (s *ServerHandler) sendPathNotFoundError(w http.ResponseWriter, r *http.Request) {
+	e := taxiierror.New()
+	e.SetTitle("Resource Not Found")
+	e.SetDescription("The requested resource does not exist on this server.")
+	e.SetErrorCode("404")
+	e.SetHTTPStatus("404 Not Found")
+
+	s.sendError(w, r, http.StatusNotFound, e)
+}
+
+/*
+sendURLParametersError - This method will send the correct TAXII error message
+for a session that sends URL parameters that are not valid or not supported.
+Each problem is listed in the description.
+*/
+func (s *ServerHandler) sendURLParametersError(w http.ResponseWriter, r *http.Request, problems []string) {
+	e := taxiierror.New()
+	e.SetTitle("Invalid URL Parameters")
+	e.SetDescription("The request has URL parameters that are not valid or not supported: " + strings.Join(problems, "; ") + ".")
+	e.SetErrorCode("400")
+	e.SetHTTPStatus("400 Bad Request")
+
+	s.sendError(w, r, http.StatusBadRequest, e)
+}
+
+/*
+sendUnsupportedEncodingError - This method will send the correct TAXII error
+message for a session that posts a body with a Content-Encoding that is not
+supported.
+*/
+func (s *ServerHandler) sendUnsupportedEncodingError(w http.ResponseWriter, r *http.Request) {
+	e := taxiierror.New()
+	e.SetTitle("Wrong Content Encoding")
+	e.SetDescription("The content encoding of the request body is not supported, use gzip, deflate, br, or identity.")
+	e.SetErrorCode("415")
+	e.SetHTTPStatus("415 Unsupported Media Type")
+
+	s.sendError(w, r, http.StatusUnsupportedMediaType, e)
+}
+
+/*
+sendRequestTooLargeError - This method will send the correct TAXII error
+message for a session that posts a body that is larger than the
+max_content_length of the API root.
+*/
+func (s *ServerHandler) sendRequestTooLargeError(w http.ResponseWriter, r *http.Request) {
+	e := taxiierror.New()
+	e.SetTitle("Request Too Large")
+	e.SetDescription("The request body, once it is decompressed, is larger than the max_content_length of the API root.")
+	e.SetErrorCode("413")
+	e.SetHTTPStatus("413 Request Entity Too Large")
+
+	s.sendError(w, r, http.StatusRequestEntityTooLarge, e)
+}
+
+/*
+sendRangeNotSatisfiableError - This method will send the correct TAXII error
+message for a TAXII 2.0 session that asks for a range of items that starts
+after the last item that its request finds.
+*/
+func (s *ServerHandler) sendRangeNotSatisfiableError(w http.ResponseWriter, r *http.Request) {
+	e := taxiierror.New()
+	e.SetTitle("Range Not Satisfiable")
+	e.SetDescription("The requested range of items starts after the last item that the request finds.")
+	e.SetErrorCode("416")
+	e.SetHTTPStatus("416 Requested Range Not Satisfiable")
+
+	s.sendError(w, r, http.StatusRequestedRangeNotSatisfiable, e)
+}
+
+/*
+sendHTMLTemplateError - This method will send the correct TAXII error message
+when the HTML template of a resource can not be parsed or rendered.
+*/
+func (s *ServerHandler) sendHTMLTemplateError(w http.ResponseWriter, r *http.Request) {
+	e := taxiierror.New()
+	e.SetTitle("HTML Template Error")
+	e.SetDescription("The HTML template for the requested resource could not be rendered.")
+	e.SetErrorCode("500")
+	e.SetHTTPStatus("500 Internal Server Error")
+
+	s.sendError(w, r, http.StatusInternalServerError, e)
+}
+
+/*
+sendError - This method will send a TAXII error message with the HTTP status
+provided. When HTML output is enabled for this handler and the client prefers
+it, the error is rendered with the HTML error template so that a browser shows
+an error page. Otherwise, or if the template can not be rendered, the error is
+sent as TAXII JSON.
+*/
+func (s *ServerHandler) sendError(w http.ResponseWriter, r *http.Request, status int, e *taxiierror.Error) {
+	if s.HTMLErrorTemplate != "" && s.negotiateMediaType(r, "") == defs.MEDIA_TYPE_HTML {
+		page := *s
+		page.Resource = e
+
+		var body bytes.Buffer
+		err := s.Templates.Execute(&body, s.HTMLErrorTemplate, page)
+		if err == nil {
+			w.Header().Set("Content-Type", defs.MEDIA_TYPE_HTML)
+			w.WriteHeader(status)
+			body.WriteTo(w)
+			return
+		}
+		s.Logger.Errorln("ERROR: Unable to render the HTML error template", s.HTMLErrorTemplate, err)
+	}
+
+	// Setup JSON stream encoder
+	j := json.NewEncoder(w)
+
+	w.Header().Set("Content-Type", defs.MEDIA_TYPE_TAXII21)
+	w.WriteHeader(status)
+
 	j.SetIndent("", "    ")
 	j.Encode(e)
 }
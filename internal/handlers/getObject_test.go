@@ -6,47 +6,46 @@
 package handlers
 
 import (
-	"github.com/freetaxii/libstix2/datastore"
-	"github.com/freetaxii/libstix2/objects"
-	//"github.com/freetaxii/libstix2/resources"
 	"net/http"
 	"net/http/httptest"
 	"testing"
-)
 
-type dummydb struct {
-	datastore.Datastorer
-}
+	"github.com/freetaxii/libstix2/datastore"
+	"github.com/freetaxii/server/internal/storetest"
+)
 
-func (db *dummydb) GetObject(stixid string) (interface{}, error) {
-	return objects.NewIndicator("2.0"), nil
-}
-func (db *dummydb) GetObjectsFromCollection(collectionid string) objects.BundleType {
-	b := objects.NewBundle()
-	b.SetID("bundle--1234")
-	return b
+// objectsHandler - This function returns a handler for the objects of
+// collection 1234 that also serves TAXII 2.0.
+func objectsHandler(ds datastore.Datastorer) ServerHandler {
+	s, _ := New(storetest.Logger())
+	s.CollectionID = "1234"
+	s.DS = ds
+	s.ServerRecordLimit = 100
+	s.TAXII20 = true
+	return s
 }
 
-func TestHealthCheckHandler(t *testing.T) {
-	// Create a request to pass to our handler. We don't have any query parameters for now, so we'll
-	// pass 'nil' as the third parameter.
-	req, err := http.NewRequest("GET", "", nil)
-	if err != nil {
-		t.Fatal(err)
+// get - This function sends a GET request with the Accept header provided to a
+// handler and returns the response.
+func get(handler http.HandlerFunc, url, accept string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", url, nil)
+	req.Header.Set("Accept", accept)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
 	}
-	req.Header.Set("Accept", "application/stix+json")
 
-	var objectsSrv ServerHandlerType
-	objectsSrv.CollectionID = "1234"
-	objectsSrv.DS = &dummydb{}
-
-	// We create a ResponseRecorder (which satisfies http.ResponseWriter) to record the response.
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(objectsSrv.ObjectsServerHandler)
-
-	// Our handlers satisfy http.Handler, so we can call their ServeHTTP method
-	// directly and pass in our Request and ResponseRecorder.
 	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// ----------------------------------------------------------------------
+func TestHealthCheckHandler(t *testing.T) {
+	ds := storetest.New()
+	ds.Add("1234", "2018-01-02T00:00:00.000000Z", `{"type": "indicator", "id": "indicator--1", "created": "2018-01-01T00:00:00.000Z", "modified": "2018-01-01T00:00:00.000Z"}`)
+
+	objectsSrv := objectsHandler(ds)
+	rr := get(objectsSrv.STIXContentServerHandler, "/api1/collections/1234/objects/", "application/vnd.oasis.stix+json; version=2.0")
 
 	// Check the status code is what we expect.
 	if status := rr.Code; status != http.StatusOK {
@@ -54,11 +53,10 @@ func TestHealthCheckHandler(t *testing.T) {
 			status, http.StatusOK)
 	}
 
-	// Check the response body is what we expect.
-	expected := `{"type":"bundle","id":"bundle--1234","spec_version":"2.0"}` + "\n"
-
-	if rr.Body.String() != expected {
-		t.Errorf("handler returned unexpected body: got %v want %v",
-			rr.Body.String(), expected)
+	// Check the response body is what we expect, a TAXII 2.0 client gets its
+	// objects in a STIX 2.0 bundle.
+	bundle := decodeBundle20(t, rr)
+	if bundle.Type != "bundle" || bundle.SpecVersion != "2.0" || len(bundle.Objects) != 1 {
+		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
 	}
 }
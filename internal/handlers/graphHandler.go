@@ -0,0 +1,143 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/freetaxii/libstix2/defs"
+	"github.com/freetaxii/server/internal/graph"
+	"github.com/freetaxii/server/internal/headers"
+	"github.com/freetaxii/server/internal/markings"
+	"github.com/gorilla/mux"
+)
+
+/*
+GraphHandler - This method will handle all requests for the neighborhood of an
+object in a collection. The depth URL parameter is the number of steps that are
+followed from the object. Only the objects with data markings the client may
+read are sent or followed.
+*/
+func (s *ServerHandler) GraphHandler(w http.ResponseWriter, r *http.Request) {
+
+	s.Logger.Infoln("INFO: Found Graph request from", r.RemoteAddr, "for collection:", s.CollectionID)
+
+	// If trace is enabled in the logger, than decode the HTTP Request to the log
+	if s.Logger.GetLevel("trace") {
+		headers.DebugHttpRequest(r)
+	}
+
+	// --------------------------------------------------
+	// 1st Check Authentication
+	// --------------------------------------------------
+	// If authentication is required and the client does not provide credentials
+	// or their credentials do not match, then send an error message.
+	// We need to return right here as to prevent further processing.
+	if s.Authenticated == true {
+		s.Logger.Debugln("DEBUG: Authentication Enabled")
+		if s.BasicAuth == true {
+			s.Logger.Debugln("DEBUG: Basic Authentication Enabled")
+			w.Header().Set("WWW-Authenticate", `Basic realm="Authentication Required"`)
+			if success := s.authenticate(r.BasicAuth()); success != true {
+				s.Logger.Debugln("DEBUG: Authentication failed for", r.RemoteAddr, "at", r.RequestURI)
+				s.sendUnauthenticatedError(w, r)
+				return
+			}
+		} else {
+			// If authentication is enabled, but basic is not, then fail since
+			// no other authentication is currently enabled.
+			s.Logger.Debugln("DEBUG: Authentication method from", r.RemoteAddr, "at", r.RequestURI, "not supported")
+			s.sendUnauthenticatedError(w, r)
+			return
+		}
+	} // End Authentication Check
+
+	// The data markings this client may read
+	policy := s.Markings
+
+	// --------------------------------------------------
+	// Check Accept Header Media Type
+	// --------------------------------------------------
+	// The neighborhood is sent as a STIX bundle
+	mediaType := headers.Negotiate(r.Header.Get("Accept"), []string{defs.MEDIA_TYPE_STIX21, defs.MEDIA_TYPE_JSON})
+	if mediaType == "" {
+		s.sendNotAcceptableError(w, r)
+		return
+	}
+
+	// ----------------------------------------------------------------------
+	// Handle URL Parameters
+	// ----------------------------------------------------------------------
+	depth := graph.DefaultDepth
+
+	urlParameters := r.URL.Query()
+	s.Logger.Debugln("DEBUG: Client", r.RemoteAddr, "sent the following (", len(urlParameters), ") url parameters:", urlParameters)
+
+	var problems []string
+	for key, value := range urlParameters {
+		if key != "depth" {
+			problems = append(problems, key+" is not supported")
+		} else if len(value) > 1 {
+			problems = append(problems, key+" may only be given once")
+		}
+	}
+	sort.Strings(problems)
+
+	if v := urlParameters.Get("depth"); v != "" {
+		if d, err := strconv.Atoi(v); err != nil || d < 0 || d > graph.MaxDepth {
+			problems = append(problems, "depth value "+v+" is not an integer from 0 to "+strconv.Itoa(graph.MaxDepth))
+		} else {
+			depth = d
+		}
+	}
+
+	if len(problems) > 0 {
+		s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to invalid URL parameters", problems)
+		s.sendURLParametersError(w, r, problems)
+		return
+	}
+
+	// ----------------------------------------------------------------------
+	// Walk the collection from the object
+	// ----------------------------------------------------------------------
+	// The objects in the other collections of the API root that the client
+	// can read are followed too, with the data markings of their collection
+	g := graph.New(s.DS, s.CollectionID)
+	g.Index = s.Edges
+	for id := range s.ReadCollections {
+		g.Collections = append(g.Collections, id)
+	}
+	sort.Strings(g.Collections)
+	g.Allow = func(collectionID string, data []byte) bool {
+		if collectionID == s.CollectionID {
+			return policy.Allows(markings.Refs(data))
+		}
+		return s.ReadCollections[collectionID].Allows(markings.Refs(data))
+	}
+
+	bundle, err := g.Neighborhood(mux.Vars(r)["objectid"], depth)
+	if err == graph.ErrNotFound {
+		s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to:", err.Error())
+		s.sendStatusNotFound(w, r)
+		return
+	} else if err != nil {
+		s.Logger.Errorln("ERROR: Unable to read the neighborhood of", mux.Vars(r)["objectid"], err)
+		s.sendGetObjectsError(w, r)
+		return
+	}
+
+	var body bytes.Buffer
+	j := json.NewEncoder(&body)
+	j.SetIndent("", "    ")
+	j.Encode(bundle)
+
+	s.Logger.Infoln("INFO: Sending", len(bundle.Objects), "objects to", r.RemoteAddr)
+	s.sendResource(w, r, mediaType, body.Bytes(), "")
+}
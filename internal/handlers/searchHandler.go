@@ -0,0 +1,142 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/freetaxii/libstix2/defs"
+	"github.com/freetaxii/server/internal/headers"
+	"github.com/freetaxii/server/internal/search"
+)
+
+/*
+SearchHandler - This method will handle all requests to search the collections
+of an API root. The q URL parameter is the text to look for in the name,
+description, pattern, and external references of the objects, and the limit URL
+parameter is the most results to return. Only the collections the API root can
+read are searched, and only the objects with data markings the client may read
+are returned.
+*/
+func (s *ServerHandler) SearchHandler(w http.ResponseWriter, r *http.Request) {
+
+	s.Logger.Infoln("INFO: Found Search request from", r.RemoteAddr, "at", r.URL.Path)
+
+	// If trace is enabled in the logger, than decode the HTTP Request to the log
+	if s.Logger.GetLevel("trace") {
+		headers.DebugHttpRequest(r)
+	}
+
+	// --------------------------------------------------
+	// 1st Check Authentication
+	// --------------------------------------------------
+	// If authentication is required and the client does not provide credentials
+	// or their credentials do not match, then send an error message.
+	// We need to return right here as to prevent further processing.
+	if s.Authenticated == true {
+		s.Logger.Debugln("DEBUG: Authentication Enabled")
+		if s.BasicAuth == true {
+			s.Logger.Debugln("DEBUG: Basic Authentication Enabled")
+			w.Header().Set("WWW-Authenticate", `Basic realm="Authentication Required"`)
+			if success := s.authenticate(r.BasicAuth()); success != true {
+				s.Logger.Debugln("DEBUG: Authentication failed for", r.RemoteAddr, "at", r.RequestURI)
+				s.sendUnauthenticatedError(w, r)
+				return
+			}
+		} else {
+			// If authentication is enabled, but basic is not, then fail since
+			// no other authentication is currently enabled.
+			s.Logger.Debugln("DEBUG: Authentication method from", r.RemoteAddr, "at", r.RequestURI, "not supported")
+			s.sendUnauthenticatedError(w, r)
+			return
+		}
+	} // End Authentication Check
+
+	// --------------------------------------------------
+	// Check Accept Header Media Type
+	// --------------------------------------------------
+	// Search is not part of TAXII, so the results are plain JSON
+	if headers.Negotiate(r.Header.Get("Accept"), []string{defs.MEDIA_TYPE_JSON}) == "" {
+		s.sendNotAcceptableError(w, r)
+		return
+	}
+
+	// ----------------------------------------------------------------------
+	// Handle URL Parameters
+	// ----------------------------------------------------------------------
+	q := search.Query{Limit: s.ServerRecordLimit}
+
+	urlParameters := r.URL.Query()
+	s.Logger.Debugln("DEBUG: Client", r.RemoteAddr, "sent the following (", len(urlParameters), ") url parameters:", urlParameters)
+
+	var problems []string
+	for key, value := range urlParameters {
+		if key != "q" && key != "limit" {
+			problems = append(problems, key+" is not supported")
+		} else if len(value) > 1 {
+			problems = append(problems, key+" may only be given once")
+		}
+	}
+	sort.Strings(problems)
+
+	q.Text = urlParameters.Get("q")
+	if err := search.Verify(q.Text); err != nil {
+		problems = append(problems, "q value "+err.Error())
+	}
+
+	// The client may ask for fewer results than the server record limit,
+	// but not for more
+	if v := urlParameters.Get("limit"); v != "" {
+		if limit, err := strconv.Atoi(v); err != nil || limit < 1 {
+			problems = append(problems, "limit value "+v+" is not a positive integer")
+		} else if q.Limit == 0 || limit < q.Limit {
+			q.Limit = limit
+		}
+	}
+
+	if len(problems) > 0 {
+		s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to invalid URL parameters", problems)
+		s.sendURLParametersError(w, r, problems)
+		return
+	}
+
+	for id := range s.ReadCollections {
+		q.CollectionIDs = append(q.CollectionIDs, id)
+	}
+	sort.Strings(q.CollectionIDs)
+
+	q.Allow = func(result search.Result) bool {
+		return s.ReadCollections[result.CollectionID].Allows(result.Markings)
+	}
+
+	// ----------------------------------------------------------------------
+	// Search the collections
+	// ----------------------------------------------------------------------
+	results, err := s.Index.Search(q)
+	if err != nil {
+		s.Logger.Errorln("ERROR: Unable to search for", q.Text, err)
+		s.sendGetObjectsError(w, r)
+		return
+	}
+
+	apiRoot := strings.TrimSuffix(s.URLPath, search.Path)
+	for i, v := range results.Results {
+		results.Results[i].URL = apiRoot + "collections/" + v.CollectionID + "/objects/" + v.ID + "/"
+	}
+
+	var body bytes.Buffer
+	j := json.NewEncoder(&body)
+	j.SetIndent("", "    ")
+	j.Encode(results)
+
+	s.Logger.Infoln("INFO: Sending", len(results.Results), "search results to", r.RemoteAddr)
+	s.sendResource(w, r, defs.MEDIA_TYPE_JSON, body.Bytes(), "")
+}
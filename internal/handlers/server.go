@@ -6,16 +6,30 @@
 package handlers
 
 import (
+	"net/http"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/freetaxii/libstix2/datastore"
+	"github.com/freetaxii/libstix2/defs"
 	"github.com/freetaxii/libstix2/resources/apiroot"
 	"github.com/freetaxii/libstix2/resources/collections"
 	"github.com/freetaxii/libstix2/resources/discovery"
 	"github.com/freetaxii/libstix2/stixid"
 	"github.com/freetaxii/libstix2/timestamp"
+	"github.com/freetaxii/server/internal/browse"
 	"github.com/freetaxii/server/internal/config"
+	"github.com/freetaxii/server/internal/envelopes"
+	"github.com/freetaxii/server/internal/filters"
+	"github.com/freetaxii/server/internal/graph"
+	"github.com/freetaxii/server/internal/headers"
+	"github.com/freetaxii/server/internal/ingest"
+	"github.com/freetaxii/server/internal/markings"
+	"github.com/freetaxii/server/internal/search"
+	"github.com/freetaxii/server/internal/stream"
+	"github.com/freetaxii/server/internal/templates"
 	"github.com/gologme/log"
 )
 
@@ -29,15 +43,28 @@ all TAXII requests.
 */
 type ServerHandler struct {
 	Logger            *log.Logger
-	URLPath           string // Used in HTML output and to build the URL for the next resource.
-	HTMLEnabled       bool   // Is HTML output enabled for this service
-	HTMLTemplate      string // The full file path (prefix + HTML template directory + template filename)
-	CollectionID      string // The collection ID that is being used
-	ServerRecordLimit int    // The maximum number of records that the server will respond with.
-	Authenticated     bool   // Is this handler to be authenticated
-	BasicAuth         bool   // Is Basic Auth used
+	URLPath           string           // Used in HTML output and to build the URL for the next resource.
+	HTMLEnabled       bool             // Is HTML output enabled for this service
+	HTMLTemplate      string           // The full file path (prefix + HTML template directory + template filename)
+	HTMLErrorTemplate string           // The full file path of the HTML template for error messages
+	Templates         *templates.Cache // The parsed HTML templates, the file is parsed on every request if nil
+	CollectionID      string           // The collection ID that is being used
+	ServerRecordLimit int              // The maximum number of records that the server will respond with.
+	MaxContentLength  int64            // The maximum size of a request body once it is decompressed, 0 for no limit.
+	Authenticated     bool             // Is this handler to be authenticated
+	BasicAuth         bool             // Is Basic Auth used
 	DS                datastore.Datastorer
-	Resource          interface{} // This holds the actual resource and is populated in the main freetaxii.go
+	Notifier          ingest.Notifier             // Told about objects added with POST, if defined
+	Versions          ingest.VersionFinder        // Finds the other collection a posted version is already stored for
+	Hub               *stream.Hub                 // Wakes up the live streams of a collection
+	TAXII20           bool                        // Serve TAXII 2.0 representations to clients that ask for them
+	SpecVersions      []string                    // The STIX versions allowed by the media types of the collection, any if empty
+	Markings          *markings.Policy            // The data markings of the collection, not enforced if nil
+	Index             search.Index                // The full-text search index, if enabled
+	Edges             graph.Index                 // The index of the relationships and sightings that refer to each object
+	ReadCollections   map[string]*markings.Policy // The collections of the API root that can be read, by ID, with their data markings
+	Resource          interface{}                 // This holds the actual resource and is populated in the main freetaxii.go
+	Page              *browse.Page                // The page of a collection that the HTML objects, versions, and manifest templates show
 }
 
 // ----------------------------------------------------------------------
@@ -72,10 +99,22 @@ func NewDiscoveryHandler(logger *log.Logger, c config.DiscoveryService, r discov
 	s.URLPath = c.Path
 	s.HTMLEnabled = c.HTML.Enabled.Value
 	s.HTMLTemplate = c.HTML.FullTemplatePath + c.HTML.TemplateFiles.Discovery.Value
+	s.HTMLErrorTemplate = c.HTML.FullTemplatePath + c.HTML.TemplateFiles.Error.Value
 	s.Resource = r
 	return s, nil
 }
 
+/*
+NewErrorHandler - This function will prepare the data for the handler of the
+requests that no service answers, using the global HTML configuration.
+*/
+func NewErrorHandler(logger *log.Logger, h config.HTMLConfig) (ServerHandler, error) {
+	s, _ := New(logger)
+	s.HTMLEnabled = h.Enabled.Value
+	s.HTMLErrorTemplate = h.FullTemplatePath + h.TemplateFiles.Error.Value
+	return s, nil
+}
+
 /*
 NewAPIRootHandler - This function will prepare the data for the API Root handler.
 */
@@ -84,7 +123,9 @@ func NewAPIRootHandler(logger *log.Logger, api config.APIRootService, r apiroot.
 	s.URLPath = api.Path
 	s.HTMLEnabled = api.HTML.Enabled.Value
 	s.HTMLTemplate = api.HTML.FullTemplatePath + api.HTML.TemplateFiles.APIRoot.Value
+	s.HTMLErrorTemplate = api.HTML.FullTemplatePath + api.HTML.TemplateFiles.Error.Value
 	s.Resource = r
+	s.TAXII20 = api.TAXII20
 	return s, nil
 }
 
@@ -96,8 +137,10 @@ func NewCollectionsHandler(logger *log.Logger, api config.APIRootService, r coll
 	s.URLPath = api.Path + "collections/"
 	s.HTMLEnabled = api.HTML.Enabled.Value
 	s.HTMLTemplate = api.HTML.FullTemplatePath + api.HTML.TemplateFiles.Collections.Value
+	s.HTMLErrorTemplate = api.HTML.FullTemplatePath + api.HTML.TemplateFiles.Error.Value
 	s.Resource = r
 	s.ServerRecordLimit = limit
+	s.TAXII20 = api.TAXII20
 	return s, nil
 }
 
@@ -109,8 +152,10 @@ func NewCollectionHandler(logger *log.Logger, api config.APIRootService, r colle
 	s.URLPath = api.Path + "collections/" + r.ID + "/"
 	s.HTMLEnabled = api.HTML.Enabled.Value
 	s.HTMLTemplate = api.HTML.FullTemplatePath + api.HTML.TemplateFiles.Collection.Value
+	s.HTMLErrorTemplate = api.HTML.FullTemplatePath + api.HTML.TemplateFiles.Error.Value
 	s.Resource = r
 	s.ServerRecordLimit = limit
+	s.TAXII20 = api.TAXII20
 	return s, nil
 }
 
@@ -122,8 +167,10 @@ func NewObjectsHandler(logger *log.Logger, api config.APIRootService, collection
 	s.URLPath = api.Path + "collections/" + collectionID + "/objects/"
 	s.HTMLEnabled = api.HTML.Enabled.Value
 	s.HTMLTemplate = api.HTML.FullTemplatePath + api.HTML.TemplateFiles.Objects.Value
+	s.HTMLErrorTemplate = api.HTML.FullTemplatePath + api.HTML.TemplateFiles.Error.Value
 	s.CollectionID = collectionID
 	s.ServerRecordLimit = limit
+	s.TAXII20 = api.TAXII20
 	return s, nil
 }
 
@@ -135,8 +182,10 @@ func NewObjectsByIDHandler(logger *log.Logger, api config.APIRootService, collec
 	s.URLPath = api.Path + "collections/" + collectionID + "/objects/{objectid}/"
 	s.HTMLEnabled = api.HTML.Enabled.Value
 	s.HTMLTemplate = api.HTML.FullTemplatePath + api.HTML.TemplateFiles.Objects.Value
+	s.HTMLErrorTemplate = api.HTML.FullTemplatePath + api.HTML.TemplateFiles.Error.Value
 	s.CollectionID = collectionID
 	s.ServerRecordLimit = limit
+	s.TAXII20 = api.TAXII20
 	return s, nil
 }
 
@@ -148,6 +197,7 @@ func NewObjectVersionsHandler(logger *log.Logger, api config.APIRootService, col
 	s.URLPath = api.Path + "collections/" + collectionID + "/objects/{objectid}/versions/"
 	s.HTMLEnabled = api.HTML.Enabled.Value
 	s.HTMLTemplate = api.HTML.FullTemplatePath + api.HTML.TemplateFiles.Versions.Value
+	s.HTMLErrorTemplate = api.HTML.FullTemplatePath + api.HTML.TemplateFiles.Error.Value
 	s.CollectionID = collectionID
 	s.ServerRecordLimit = limit
 	return s, nil
@@ -161,81 +211,272 @@ func NewManifestHandler(logger *log.Logger, api config.APIRootService, collectio
 	s.URLPath = api.Path + "collections/" + collectionID + "/manifest/"
 	s.HTMLEnabled = api.HTML.Enabled.Value
 	s.HTMLTemplate = api.HTML.FullTemplatePath + api.HTML.TemplateFiles.Manifest.Value
+	s.HTMLErrorTemplate = api.HTML.FullTemplatePath + api.HTML.TemplateFiles.Error.Value
+	s.CollectionID = collectionID
+	s.ServerRecordLimit = limit
+	s.TAXII20 = api.TAXII20
+	return s, nil
+}
+
+/*
+NewStreamHandler - This function will prepare the data for the Stream handler.
+*/
+func NewStreamHandler(logger *log.Logger, api config.APIRootService, collectionID string, limit int) (ServerHandler, error) {
+	s, _ := New(logger)
+	s.URLPath = api.Path + "collections/" + collectionID + "/stream/"
 	s.CollectionID = collectionID
 	s.ServerRecordLimit = limit
 	return s, nil
 }
 
+/*
+NewGraphHandler - This function will prepare the data for the Graph handler.
+*/
+func NewGraphHandler(logger *log.Logger, api config.APIRootService, collectionID string) (ServerHandler, error) {
+	s, _ := New(logger)
+	s.URLPath = api.Path + "collections/" + collectionID + "/" + graph.Path + "{objectid}/"
+	s.CollectionID = collectionID
+	s.ReadCollections = make(map[string]*markings.Policy)
+	return s, nil
+}
+
+/*
+NewSearchHandler - This function will prepare the data for the Search handler.
+*/
+func NewSearchHandler(logger *log.Logger, api config.APIRootService, limit int) (ServerHandler, error) {
+	s, _ := New(logger)
+	s.URLPath = api.Path + search.Path
+	s.ServerRecordLimit = limit
+	s.ReadCollections = make(map[string]*markings.Policy)
+	return s, nil
+}
+
 // ----------------------------------------------------------------------
 // Private Methods - ServerHandler
 // ----------------------------------------------------------------------
 
+/*
+negotiateMediaType - This method will choose the media type of the response
+from the Accept header of the request, or return an empty string if none of the
+media types this handler can send are acceptable. TAXII 2.1 is preferred when
+the client does not prefer one over another. HTML is only offered when it is
+enabled for this handler and the TAXII 2.0 media type of the endpoint is only
+offered when TAXII 2.0 is enabled for the API root and the endpoint has one.
+*/
+func (s *ServerHandler) negotiateMediaType(r *http.Request, taxii20MediaType string) string {
+	offers := []string{defs.MEDIA_TYPE_TAXII21}
+	if s.TAXII20 == true && taxii20MediaType != "" {
+		offers = append(offers, taxii20MediaType)
+	}
+	offers = append(offers, defs.MEDIA_TYPE_JSON)
+	if s.HTMLEnabled == true {
+		offers = append(offers, defs.MEDIA_TYPE_HTML)
+	}
+	return headers.Negotiate(r.Header.Get("Accept"), offers)
+}
+
+/*
+sendResource - This method will send a response body that has already been
+encoded, along with an ETag and, when the date_added of the last object is
+known, a Last-Modified header. If the client already has this representation,
+as shown by its If-None-Match or If-Modified-Since headers, a 304 Not Modified
+is sent without the body.
+*/
+func (s *ServerHandler) sendResource(w http.ResponseWriter, r *http.Request, mediaType string, body []byte, dateAddedLast string) {
+	s.writeResource(w, r, http.StatusOK, mediaType, body, dateAddedLast)
+}
+
+/*
+sendPartialResource - This method will send a response body that is only part
+of the items that the request finds, as a 206 Partial Content with the
+Content-Range header provided. It is used for the TAXII 2.0 pagination.
+*/
+func (s *ServerHandler) sendPartialResource(w http.ResponseWriter, r *http.Request, mediaType string, body []byte, contentRange string) {
+	w.Header().Set("Content-Range", contentRange)
+	s.writeResource(w, r, http.StatusPartialContent, mediaType, body, "")
+}
+
+/*
+writeResource - This method will send a response body with the HTTP status
+provided, unless the client already has it, as described for sendResource.
+*/
+func (s *ServerHandler) writeResource(w http.ResponseWriter, r *http.Request, status int, mediaType string, body []byte, dateAddedLast string) {
+	etag := headers.ETag(mediaType, body)
+	lastModified := headers.LastModified(dateAddedLast)
+	headers.SetValidators(w, etag, lastModified)
+	w.Header().Set("Content-Type", mediaType)
+
+	if headers.NotModified(r, etag, lastModified) == true {
+		s.Logger.Debugln("DEBUG: Client", r.RemoteAddr, "already has the resource with ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+/*
+collectionURL - This method will return the URL path of the collection that
+this handler serves, ending in a slash.
+*/
+func (s *ServerHandler) collectionURL() string {
+	collectionPath := "collections/" + s.CollectionID + "/"
+	if i := strings.Index(s.URLPath, collectionPath); i >= 0 {
+		return s.URLPath[:i+len(collectionPath)]
+	}
+	return s.URLPath
+}
+
+/*
+restrictSpecVersions - This method will limit a query to the STIX versions that
+are allowed by the media types of the collection. The versions the client asked
+for are kept if the collection allows them. If none of them are allowed, false
+is returned as there is nothing the query can find.
+*/
+func (s *ServerHandler) restrictSpecVersions(q *collections.CollectionQuery) bool {
+	if len(s.SpecVersions) == 0 {
+		return true
+	}
+
+	if len(q.SpecVersion) == 0 {
+		q.SpecVersion = append([]string(nil), s.SpecVersions...)
+		return true
+	}
+
+	var allowed []string
+	for _, v := range q.SpecVersion {
+		for _, a := range s.SpecVersions {
+			if v == a {
+				allowed = append(allowed, v)
+			}
+		}
+	}
+	q.SpecVersion = allowed
+	return len(allowed) > 0
+}
+
 /*
 processURLParameters - This method will process all of the URL parameters from
-an HTTP request.
+an HTTP request. Every value is checked and a description of each problem that
+is found is returned, so that the client can be told about all of them at once
+instead of getting results for a query that it did not ask for.
 */
-func (s *ServerHandler) processURLParameters(q *collections.CollectionQuery, values map[string][]string) error {
+func (s *ServerHandler) processURLParameters(q *collections.CollectionQuery, values map[string][]string) []string {
+	var problems []string
+
+	// Parameters without a value, like match[type]=, are ignored
+	values = withValues(values)
+
+	// Each parameter may only be given once, multiple values are separated
+	// by commas. The values of a match filter that is given more than once
+	// are merged.
+	var repeated []string
+	for key, value := range values {
+		if len(value) > 1 && !strings.HasPrefix(key, "match[") {
+			repeated = append(repeated, key+" may only be given once")
+		}
+	}
+	sort.Strings(repeated)
+	problems = append(problems, repeated...)
 
 	if values["added_after"] != nil {
 		after := strings.Split(values["added_after"][0], ",")
+		if len(after) > 1 {
+			problems = append(problems, "added_after must be a single timestamp")
+		}
 		for _, v := range after {
 			if timestamp.Valid(v) {
 				q.AddedAfter = append(q.AddedAfter, v)
+			} else {
+				problems = append(problems, "added_after value "+v+" is not a valid timestamp")
 			}
 		}
 	}
 
+	// The next parameter continues from the end of the previous page, it is
+	// the date_added of the last object of that page. The records that share
+	// it and were already sent are skipped by the objects endpoint.
+	if values["next"] != nil {
+		v := values["next"][0]
+		if values["added_after"] != nil {
+			problems = append(problems, "next and added_after can not both be given")
+		} else if addedAfter, _, ok := envelopes.ParseNext(v); ok == true {
+			q.AddedAfter = append(q.AddedAfter, addedAfter)
+		} else {
+			problems = append(problems, "next value "+v+" is not valid")
+		}
+	}
+
 	if values["added_before"] != nil {
 		before := strings.Split(values["added_before"][0], ",")
+		if len(before) > 1 {
+			problems = append(problems, "added_before must be a single timestamp")
+		}
 		for _, v := range before {
 			if timestamp.Valid(v) {
 				q.AddedBefore = append(q.AddedBefore, v)
+			} else {
+				problems = append(problems, "added_before value "+v+" is not a valid timestamp")
 			}
 		}
 	}
 
 	if values["limit"] != nil {
-		q.Limit = strings.Split(values["limit"][0], ",")
+		v := values["limit"][0]
+		if limit, err := strconv.Atoi(v); err != nil || limit < 1 {
+			problems = append(problems, "limit value "+v+" is not a positive integer")
+		} else {
+			q.Limit = []string{v}
+		}
 	}
 
 	if values["match[id]"] != nil {
-		ids := strings.Split(values["match[id]"][0], ",")
+		ids := filters.List(values["match[id]"])
 		for _, v := range ids {
 			if stixid.ValidSTIXID(v) {
 				q.STIXID = append(q.STIXID, v)
+			} else {
+				problems = append(problems, "match[id] value "+v+" is not a valid STIX identifier")
 			}
 		}
 	}
 
 	if values["match[type]"] != nil {
-		objTypes := strings.Split(values["match[type]"][0], ",")
+		objTypes := filters.List(values["match[type]"])
 		for _, v := range objTypes {
 			if stixid.ValidSTIXObjectType(v) {
 				q.STIXType = append(q.STIXType, v)
+			} else {
+				problems = append(problems, "match[type] value "+v+" is not a valid STIX object type")
 			}
 		}
 	}
 
 	if values["match[version]"] != nil {
-		vers := strings.Split(values["match[version]"][0], ",")
+		vers := filters.List(values["match[version]"])
 		for _, v := range vers {
 			if v == "all" || v == "last" || v == "first" {
 				q.STIXVersion = append(q.STIXVersion, v)
 			} else if timestamp.Valid(v) {
 				q.STIXVersion = append(q.STIXVersion, v)
+			} else {
+				problems = append(problems, "match[version] value "+v+" is not all, first, last, or a timestamp")
 			}
 		}
 	}
 
 	// This list needs to also be updated in t_collectindataManifest.go : sqlCollectionDataWhereSpecVersion
 	if values["match[spec_version]"] != nil {
-		specV := strings.Split(values["match[spec_version]"][0], ",")
+		specV := filters.List(values["match[spec_version]"])
 		for _, v := range specV {
 			switch v {
 			case "2.0":
 				q.SpecVersion = append(q.SpecVersion, v)
 			case "2.1":
 				q.SpecVersion = append(q.SpecVersion, v)
+			default:
+				problems = append(problems, "match[spec_version] value "+v+" is not 2.0 or 2.1")
 			}
 		}
 	}
@@ -248,5 +489,29 @@ func (s *ServerHandler) processURLParameters(q *collections.CollectionQuery, val
 	s.Logger.Debugln("DEBUG: URL Parameter Added Before", q.AddedBefore)
 	s.Logger.Debugln("DEBUG: URL Parameter Limit", q.Limit)
 
-	return nil
+	return problems
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+withValues - This function will return a copy of the URL parameters without
+the empty values, and without the parameters that only have empty values.
+*/
+func withValues(values map[string][]string) map[string][]string {
+	result := make(map[string][]string)
+	for key, list := range values {
+		var kept []string
+		for _, v := range list {
+			if v != "" {
+				kept = append(kept, v)
+			}
+		}
+		if len(kept) > 0 {
+			result[key] = kept
+		}
+	}
+	return result
 }
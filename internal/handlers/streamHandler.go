@@ -0,0 +1,126 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/libstix2/timestamp"
+	"github.com/freetaxii/server/internal/envelopes"
+	"github.com/freetaxii/server/internal/filters"
+	"github.com/freetaxii/server/internal/headers"
+	"github.com/freetaxii/server/internal/stream"
+)
+
+/*
+StreamHandler - This method will handle all requests for the live stream of a
+collection. New objects, or manifest entries when the view=manifest URL
+parameter is used, are sent as Server-Sent Events until the client goes away.
+*/
+func (s *ServerHandler) StreamHandler(w http.ResponseWriter, r *http.Request) {
+
+	s.Logger.Infoln("INFO: Found Stream request from", r.RemoteAddr, "for collection:", s.CollectionID)
+
+	// If trace is enabled in the logger, than decode the HTTP Request to the log
+	if s.Logger.GetLevel("trace") {
+		headers.DebugHttpRequest(r)
+	}
+
+	// --------------------------------------------------
+	// 1st Check Authentication
+	// --------------------------------------------------
+	// If authentication is required and the client does not provide credentials
+	// or their credentials do not match, then send an error message.
+	// We need to return right here as to prevent further processing.
+	if s.Authenticated == true {
+		s.Logger.Debugln("DEBUG: Authentication Enabled")
+		if s.BasicAuth == true {
+			s.Logger.Debugln("DEBUG: Basic Authentication Enabled")
+			w.Header().Set("WWW-Authenticate", `Basic realm="Authentication Required"`)
+			if success := s.authenticate(r.BasicAuth()); success != true {
+				s.Logger.Debugln("DEBUG: Authentication failed for", r.RemoteAddr, "at", r.RequestURI)
+				s.sendUnauthenticatedError(w, r)
+				return
+			}
+		} else {
+			// If authentication is enabled, but basic is not, then fail since
+			// no other authentication is currently enabled.
+			s.Logger.Debugln("DEBUG: Authentication method from", r.RemoteAddr, "at", r.RequestURI, "not supported")
+			s.sendUnauthenticatedError(w, r)
+			return
+		}
+	} // End Authentication Check
+
+	// --------------------------------------------------
+	// Check Accept Header Media Type
+	// --------------------------------------------------
+	if headers.Negotiate(r.Header.Get("Accept"), []string{stream.MediaType}) == "" {
+		s.sendNotAcceptableError(w, r)
+		return
+	}
+
+	// ----------------------------------------------------------------------
+	// Handle URL Parameters
+	// ----------------------------------------------------------------------
+	q := collections.NewCollectionQuery(s.CollectionID, s.ServerRecordLimit)
+
+	urlParameters := r.URL.Query()
+	s.Logger.Debugln("DEBUG: Client", r.RemoteAddr, "sent the following (", len(urlParameters), ") url parameters:", urlParameters)
+
+	// Invalid URL parameters are reported to the client along with the
+	// interoperability match filters that are not supported
+	problems := s.processURLParameters(q, urlParameters)
+	matchFilters, filterProblems := filters.Parse(urlParameters)
+	problems = append(problems, filterProblems...)
+	if len(problems) > 0 {
+		s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to invalid URL parameters", problems)
+		s.sendURLParametersError(w, r, problems)
+		return
+	}
+
+	// Only objects that match the media types of the collection are sent
+	if s.restrictSpecVersions(q) == false {
+		s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to a spec_version filter that does not match the media types of collection", s.CollectionID)
+		s.sendGetObjectsError(w, r)
+		return
+	}
+
+	// ----------------------------------------------------------------------
+	// Find the starting point of the stream
+	// ----------------------------------------------------------------------
+	// The id of each event is a date_added, so a client that reconnects picks
+	// up at the last event it saw. The events that share that date_added are
+	// sent again, so none of them are lost if the client went away part way
+	// through them. Without an id or an added_after URL parameter the stream
+	// starts with the objects that are added from now on.
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID != "" && timestamp.Valid(lastEventID) {
+		q.AddedAfter = []string{envelopes.Before(lastEventID)}
+	} else if lastEventID != "" {
+		s.Logger.Infoln("INFO: Client", r.RemoteAddr, "sent an invalid Last-Event-ID of", lastEventID)
+	}
+
+	if len(q.AddedAfter) == 0 {
+		q.AddedAfter = []string{time.Now().UTC().Format("2006-01-02T15:04:05.000000Z")}
+	}
+
+	st := stream.New(s.Logger, s.DS, s.Hub, *q)
+	st.Manifest = urlParameters.Get("view") == "manifest"
+	st.Markings = s.Markings
+	st.Filters = matchFilters
+
+	// Set header for TLS
+	w.Header().Add("Strict-Transport-Security", "max-age=86400; includeSubDomains")
+
+	s.Logger.Infoln("INFO: Starting stream to", r.RemoteAddr, "for collection", s.CollectionID, "from", q.AddedAfter[0])
+	if err := st.Serve(w, r.Context().Done()); err != nil {
+		s.Logger.Infoln("INFO: Stream to", r.RemoteAddr, "for collection", s.CollectionID, "closed:", err)
+		return
+	}
+	s.Logger.Infoln("INFO: Stream to", r.RemoteAddr, "for collection", s.CollectionID, "closed")
+}
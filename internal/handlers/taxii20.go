@@ -0,0 +1,344 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/freetaxii/libstix2/resources/apiroot"
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/libstix2/resources/envelope"
+	"github.com/freetaxii/libstix2/resources/manifest"
+	"github.com/freetaxii/server/internal/envelopes"
+	"github.com/freetaxii/server/internal/headers"
+	"github.com/freetaxii/server/internal/uuid"
+)
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+bundle20 - This type defines the STIX 2.0 bundle that TAXII 2.0 uses to send
+objects, in place of the TAXII 2.1 envelope.
+*/
+type bundle20 struct {
+	Type        string        `json:"type"`
+	ID          string        `json:"id"`
+	SpecVersion string        `json:"spec_version"`
+	Objects     []interface{} `json:"objects,omitempty"`
+}
+
+/*
+manifest20 - This type defines the TAXII 2.0 manifest resource. Unlike TAXII
+2.1, there is one entry per object that lists all of its versions.
+*/
+type manifest20 struct {
+	Objects []manifestEntry20 `json:"objects,omitempty"`
+}
+
+/*
+manifestEntry20 - This type defines a single entry in a TAXII 2.0 manifest.
+*/
+type manifestEntry20 struct {
+	ID         string   `json:"id"`
+	DateAdded  string   `json:"date_added"`
+	Versions   []string `json:"versions"`
+	MediaTypes []string `json:"media_types"`
+}
+
+/*
+itemRange20 - This type picks the items of a TAXII 2.0 response out of all of
+the items that a request finds, and counts them, as TAXII 2.0 pages with the
+Range and Content-Range headers instead of the limit and next URL parameters.
+
+first  - The zero based index of the first item that is sent
+size   - The most items that are sent, 0 for no limit
+ranged - Did the client send a Range header
+total  - The number of items that were counted so far
+*/
+type itemRange20 struct {
+	first  int
+	size   int
+	ranged bool
+	total  int
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - ServerHandler
+// ----------------------------------------------------------------------
+
+/*
+sendObjects20 - This method will send the objects of a Pager to a TAXII 2.0
+client as a STIX 2.0 bundle. Every object is read so that the Content-Range
+header can give the total, but only the objects in the range are kept.
+*/
+func (s *ServerHandler) sendObjects20(w http.ResponseWriter, r *http.Request, pager *envelopes.Pager, mediaType string) {
+	items := s.newItemRange20(r, pager.Limit)
+	pager.Limit = 0
+
+	page, err := pager.Next()
+	if err != nil {
+		s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to:", err.Error())
+		s.sendGetObjectsError(w, r)
+		return
+	}
+
+	var objects []interface{}
+	for page != nil {
+		for _, o := range page {
+			if items.add() == true {
+				objects = append(objects, o)
+			}
+		}
+		if page, err = pager.Next(); err != nil {
+			s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to:", err.Error())
+			s.sendGetObjectsError(w, r)
+			return
+		}
+	}
+
+	w.Header().Add("Strict-Transport-Security", "max-age=86400; includeSubDomains")
+	s.sendItems20(w, r, mediaType, items, len(objects), newBundle20(objects), pager.DateAddedLast)
+}
+
+/*
+sendManifest20 - This method will send the TAXII 2.0 manifest of the records
+that a query finds. TAXII 2.0 has one entry per object, so every record is read
+and grouped before the entries in the range are picked. The filter removes the
+records of a page that the client may not see or that do not match its
+filters.
+*/
+func (s *ServerHandler) sendManifest20(w http.ResponseWriter, r *http.Request, q collections.CollectionQuery, mediaType string, filter func(records []manifest.ManifestRecord) []manifest.ManifestRecord) {
+	items := s.newItemRange20(r, s.ServerRecordLimit)
+
+	results, err := envelopes.Manifest(s.DS, q, 0, filter)
+	if err != nil {
+		s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to:", err.Error())
+		s.sendGetObjectsError(w, r)
+		return
+	}
+
+	var m manifest20
+	for _, entry := range taxii20Manifest(results.ManifestData).Objects {
+		if items.add() == true {
+			m.Objects = append(m.Objects, entry)
+		}
+	}
+
+	w.Header().Add("Strict-Transport-Security", "max-age=86400; includeSubDomains")
+	s.sendItems20(w, r, mediaType, items, len(m.Objects), m, results.DateAddedLast)
+}
+
+/*
+sendItems20 - This method will send the n items of a TAXII 2.0 response that
+are in the range. It is sent as a 206 Partial Content with a Content-Range
+header when the client asked for a range or when not every item fit in the
+response, and as a 416 when the range starts after the last item. The
+date_added of the last item is the Last-Modified time of a whole response.
+*/
+func (s *ServerHandler) sendItems20(w http.ResponseWriter, r *http.Request, mediaType string, items itemRange20, n int, resource interface{}, dateAddedLast string) {
+	if items.ranged == true && items.first >= items.total {
+		s.Logger.Infoln("INFO: Sending error response to", r.RemoteAddr, "due to a range that starts after the last of", items.total, "items")
+		w.Header().Set("Content-Range", "items */"+strconv.Itoa(items.total))
+		s.sendRangeNotSatisfiableError(w, r)
+		return
+	}
+
+	var body bytes.Buffer
+	json.NewEncoder(&body).Encode(resource)
+
+	s.Logger.Infoln("INFO: Sending response to", r.RemoteAddr)
+	if items.ranged == false && n == items.total {
+		s.sendResource(w, r, mediaType, body.Bytes(), dateAddedLast)
+		return
+	}
+
+	contentRange := fmt.Sprintf("items %d-%d/%d", items.first, items.first+n-1, items.total)
+	s.sendPartialResource(w, r, mediaType, body.Bytes(), contentRange)
+}
+
+/*
+newItemRange20 - This method will create the itemRange20 of a request from
+its Range header. A request without a valid Range header gets the items from
+the first one. No more than limit items are sent, if it is larger than 0.
+*/
+func (s *ServerHandler) newItemRange20(r *http.Request, limit int) itemRange20 {
+	var items itemRange20
+	items.size = limit
+
+	value := r.Header.Get("Range")
+	if value == "" {
+		return items
+	}
+
+	first, last, ok := parseRange20(value)
+	if ok == false {
+		s.Logger.Infoln("INFO: Ignoring the invalid Range header", value, "from", r.RemoteAddr)
+		return items
+	}
+
+	items.first = first
+	items.ranged = true
+	if limit <= 0 || last-first+1 < limit {
+		items.size = last - first + 1
+	}
+	return items
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - itemRange20
+// ----------------------------------------------------------------------
+
+/*
+add - This method will count the next item and return true if it is in the
+range.
+*/
+func (items *itemRange20) add() bool {
+	i := items.total
+	items.total++
+	return i >= items.first && (items.size <= 0 || i < items.first+items.size)
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+parseRange20 - This function will parse the Range header of a TAXII 2.0
+request, like "items 0-9", in to the zero based indexes of the first and the
+last item that it asks for. False is returned if it is not a valid range.
+*/
+func parseRange20(value string) (int, int, bool) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "items ") == false {
+		return 0, 0, false
+	}
+
+	bounds := strings.Split(strings.TrimSpace(strings.TrimPrefix(value, "items ")), "-")
+	if len(bounds) != 2 {
+		return 0, 0, false
+	}
+
+	first, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil || first < 0 {
+		return 0, 0, false
+	}
+	last, err := strconv.Atoi(strings.TrimSpace(bounds[1]))
+	if err != nil || last < first {
+		return 0, 0, false
+	}
+	return first, last, true
+}
+
+/*
+taxii20Resource - This function will return the TAXII 2.0 representation of a
+TAXII 2.1 resource. Resources that are the same in both versions, like the
+discovery resource, are returned as they are.
+*/
+func taxii20Resource(resource interface{}) interface{} {
+	switch r := resource.(type) {
+	case apiroot.APIRoot:
+		r.Versions = []string{"taxii-2.0"}
+		return r
+
+	case collections.Collection:
+		return taxii20Collection(r)
+
+	case *collections.Collection:
+		return taxii20Collection(*r)
+
+	case collections.Collections:
+		var c collections.Collections
+		for _, v := range r.Collections {
+			col := taxii20Collection(*v)
+			c.Collections = append(c.Collections, &col)
+		}
+		return c
+
+	case envelope.Envelope:
+		return newBundle20(r.Objects)
+
+	case *envelope.Envelope:
+		return newBundle20(r.Objects)
+
+	case manifest.Manifest:
+		return taxii20Manifest(r)
+
+	case *manifest.Manifest:
+		return taxii20Manifest(*r)
+	}
+	return resource
+}
+
+/*
+taxii20Collection - This function will return a copy of a collection with its
+media types changed to the STIX 2.0 media type.
+*/
+func taxii20Collection(c collections.Collection) collections.Collection {
+	if len(c.MediaTypes) > 0 {
+		c.MediaTypes = []string{headers.MediaTypeSTIX20}
+	}
+	return c
+}
+
+/*
+taxii20Manifest - This function will group the TAXII 2.1 manifest records,
+which have one record per object version, in to one TAXII 2.0 entry per
+object. The date_added of an entry is the latest date_added of its versions.
+*/
+func taxii20Manifest(m manifest.Manifest) manifest20 {
+	var result manifest20
+	index := make(map[string]int)
+
+	for _, record := range m.Objects {
+		i, found := index[record.ID]
+		if !found {
+			i = len(result.Objects)
+			index[record.ID] = i
+			result.Objects = append(result.Objects, manifestEntry20{
+				ID:         record.ID,
+				MediaTypes: []string{headers.MediaTypeSTIX20},
+			})
+		}
+
+		entry := &result.Objects[i]
+		entry.Versions = append(entry.Versions, record.Version)
+		if record.DateAdded > entry.DateAdded {
+			entry.DateAdded = record.DateAdded
+		}
+	}
+	return result
+}
+
+/*
+newBundle20 - This function will create a new STIX 2.0 bundle for the objects
+provided. The bundle identifier is derived from the objects, so the same
+objects are always sent in the same bundle and the ETag of the response only
+changes when they do.
+*/
+func newBundle20(objects []interface{}) bundle20 {
+	var b bundle20
+	b.Type = "bundle"
+	b.ID = bundle20ID(objects)
+	b.SpecVersion = "2.0"
+	b.Objects = objects
+	return b
+}
+
+/*
+bundle20ID - This function will create a STIX bundle identifier from a hash of
+the objects provided.
+*/
+func bundle20ID(objects []interface{}) string {
+	data, _ := json.Marshal(objects)
+	return "bundle--" + uuid.FromContent(data)
+}
@@ -0,0 +1,153 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freetaxii/server/internal/headers"
+	"github.com/freetaxii/server/internal/storetest"
+)
+
+// indicators20 - This function returns a datastore with the number of STIX
+// 2.0 indicators provided in collection 1234.
+func indicators20(total int) *storetest.Store {
+	ds := storetest.New()
+	for i := 1; i <= total; i++ {
+		ds.Add("1234", fmt.Sprintf("2018-01-01T00:00:%02d.000000Z", i),
+			fmt.Sprintf(`{"type": "indicator", "id": "indicator--%d", "created": "2018-01-01T00:00:00.000Z", "modified": "2018-01-01T00:00:00.000Z"}`, i))
+	}
+	return ds
+}
+
+// decodeBundle20 - This function decodes the STIX 2.0 bundle of a response.
+func decodeBundle20(t *testing.T, rr *httptest.ResponseRecorder) bundle20 {
+	var b bundle20
+	if err := json.Unmarshal(rr.Body.Bytes(), &b); err != nil {
+		t.Fatalf("unable to decode the bundle: %v %s", err, rr.Body.String())
+	}
+	return b
+}
+
+// ----------------------------------------------------------------------
+func Test_ParseRange20(t *testing.T) {
+	tests := []struct {
+		value       string
+		first, last int
+		ok          bool
+	}{
+		{"items 0-9", 0, 9, true},
+		{"items 10-10", 10, 10, true},
+		{" items 5 - 7 ", 5, 7, true},
+		{"items 9-0", 0, 0, false},
+		{"items -1-5", 0, 0, false},
+		{"items 0-", 0, 0, false},
+		{"bytes 0-9", 0, 0, false},
+		{"", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		first, last, ok := parseRange20(test.value)
+		if first != test.first || last != test.last || ok != test.ok {
+			t.Errorf("%q: expected %d %d %v, got %d %d %v", test.value, test.first, test.last, test.ok, first, last, ok)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Objects20Range(t *testing.T) {
+	s := objectsHandler(indicators20(5))
+
+	rr := get(s.STIXContentServerHandler, "/api1/collections/1234/objects/", headers.MediaTypeSTIX20, "Range", "items 1-2")
+	if rr.Code != http.StatusPartialContent || rr.Header().Get("Content-Range") != "items 1-2/5" {
+		t.Fatalf("expected 206 with items 1-2/5, got %d %q", rr.Code, rr.Header().Get("Content-Range"))
+	}
+	b := decodeBundle20(t, rr)
+	if len(b.Objects) != 2 || fmt.Sprint(b.Objects[0].(map[string]interface{})["id"]) != "indicator--2" {
+		t.Errorf("wrong objects sent: %s", rr.Body.String())
+	}
+
+	// A range that goes past the end is cut short
+	rr = get(s.STIXContentServerHandler, "/api1/collections/1234/objects/", headers.MediaTypeSTIX20, "Range", "items 3-10")
+	if rr.Code != http.StatusPartialContent || rr.Header().Get("Content-Range") != "items 3-4/5" {
+		t.Errorf("expected 206 with items 3-4/5, got %d %q", rr.Code, rr.Header().Get("Content-Range"))
+	}
+
+	// A range that starts after the last object can not be satisfied
+	rr = get(s.STIXContentServerHandler, "/api1/collections/1234/objects/", headers.MediaTypeSTIX20, "Range", "items 5-9")
+	if rr.Code != http.StatusRequestedRangeNotSatisfiable || rr.Header().Get("Content-Range") != "items */5" {
+		t.Errorf("expected 416 with items */5, got %d %q", rr.Code, rr.Header().Get("Content-Range"))
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Objects20ServerLimit(t *testing.T) {
+	s := objectsHandler(indicators20(5))
+	s.ServerRecordLimit = 2
+
+	// Without a Range header the response is still partial when the record
+	// limit of the server cuts it short, so that the client can ask for the
+	// rest
+	rr := get(s.STIXContentServerHandler, "/api1/collections/1234/objects/", headers.MediaTypeSTIX20)
+	if rr.Code != http.StatusPartialContent || rr.Header().Get("Content-Range") != "items 0-1/5" {
+		t.Errorf("expected 206 with items 0-1/5, got %d %q", rr.Code, rr.Header().Get("Content-Range"))
+	}
+
+	rr = get(s.STIXContentServerHandler, "/api1/collections/1234/objects/", headers.MediaTypeSTIX20, "Range", "items 2-9")
+	if rr.Code != http.StatusPartialContent || rr.Header().Get("Content-Range") != "items 2-3/5" {
+		t.Errorf("expected 206 with items 2-3/5, got %d %q", rr.Code, rr.Header().Get("Content-Range"))
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Manifest20Range(t *testing.T) {
+	ds := indicators20(3)
+	ds.Add("1234", "2018-01-01T00:00:09.000000Z", `{"type": "indicator", "id": "indicator--1", "created": "2018-01-01T00:00:00.000Z", "modified": "2018-01-02T00:00:00.000Z"}`)
+	s := objectsHandler(ds)
+
+	// The two versions of indicator--1 are one entry of the manifest
+	rr := get(s.STIXContentServerHandler, "/api1/collections/1234/manifest/?match[version]=all", headers.MediaTypeTAXII20, "Range", "items 0-1")
+	if rr.Code != http.StatusPartialContent || rr.Header().Get("Content-Range") != "items 0-1/3" {
+		t.Fatalf("expected 206 with items 0-1/3, got %d %q", rr.Code, rr.Header().Get("Content-Range"))
+	}
+
+	var m manifest20
+	json.Unmarshal(rr.Body.Bytes(), &m)
+	if len(m.Objects) != 2 || m.Objects[0].ID != "indicator--1" || len(m.Objects[0].Versions) != 2 {
+		t.Errorf("wrong manifest sent: %s", rr.Body.String())
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Objects20ETag(t *testing.T) {
+	s := objectsHandler(indicators20(3))
+	url := "/api1/collections/1234/objects/"
+
+	// The same objects are sent in the same bundle, so a client that polls
+	// for them gets a 304 Not Modified
+	first := get(s.STIXContentServerHandler, url, headers.MediaTypeSTIX20)
+	second := get(s.STIXContentServerHandler, url, headers.MediaTypeSTIX20)
+	if decodeBundle20(t, first).ID != decodeBundle20(t, second).ID {
+		t.Error("the same objects were sent in bundles with different identifiers")
+	}
+
+	etag := first.Header().Get("ETag")
+	if etag == "" || second.Header().Get("ETag") != etag {
+		t.Errorf("the ETag changed from %q to %q", etag, second.Header().Get("ETag"))
+	}
+	if rr := get(s.STIXContentServerHandler, url, headers.MediaTypeSTIX20, "If-None-Match", etag); rr.Code != http.StatusNotModified {
+		t.Errorf("wrong status for a matching If-None-Match: %d", rr.Code)
+	}
+
+	other := get(s.STIXContentServerHandler, url+"?match[id]=indicator--1", headers.MediaTypeSTIX20)
+	if decodeBundle20(t, other).ID == decodeBundle20(t, first).ID {
+		t.Error("different objects were sent in bundles with the same identifier")
+	}
+}
@@ -6,8 +6,8 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
-	"html/template"
 	"net/http"
 
 	"github.com/freetaxii/libstix2/defs"
@@ -71,14 +71,14 @@ func (s *ServerHandler) baseHandler(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("WWW-Authenticate", `Basic realm="Authentication Required"`)
 			if success := s.authenticate(r.BasicAuth()); success != true {
 				s.Logger.Debugln("DEBUG: Authentication failed for", r.RemoteAddr, "at", r.RequestURI)
-				s.sendUnauthenticatedError(w)
+				s.sendUnauthenticatedError(w, r)
 				return
 			}
 		} else {
 			// If authentication is enabled, but basic is not, then fail since
 			// no other authentication is currently enabled.
 			s.Logger.Debugln("DEBUG: Authentication method from", r.RemoteAddr, "at", r.RequestURI, "not supported")
-			s.sendUnauthenticatedError(w)
+			s.sendUnauthenticatedError(w, r)
 			return
 		}
 	} // End Authentication Check
@@ -86,8 +86,7 @@ func (s *ServerHandler) baseHandler(w http.ResponseWriter, r *http.Request) {
 	// --------------------------------------------------
 	// Check Accept Header Media Type
 	// --------------------------------------------------
-	var acceptHeader headers.MediaType
-	acceptHeader.ParseTAXII(r.Header.Get("Accept"))
+	mediaType := s.negotiateMediaType(r, headers.MediaTypeTAXII20)
 
 	// --------------------------------------------------
 	// Encode outgoing response message
@@ -96,33 +95,40 @@ func (s *ServerHandler) baseHandler(w http.ResponseWriter, r *http.Request) {
 	// Set header for TLS
 	w.Header().Add("Strict-Transport-Security", "max-age=86400; includeSubDomains")
 
-	if acceptHeader.TAXII21 == true {
+	// The response is encoded before it is sent so that it can be given an
+	// ETag, these resources only change when the configuration is reloaded
+	var body bytes.Buffer
+
+	if mediaType == defs.MEDIA_TYPE_TAXII21 {
 		// Setup JSON stream encoder
-		j := json.NewEncoder(w)
-		w.Header().Set("Content-Type", defs.MEDIA_TYPE_TAXII21)
-		w.WriteHeader(http.StatusOK)
+		j := json.NewEncoder(&body)
 		j.Encode(s.Resource)
 
-	} else if acceptHeader.JSON == true {
+	} else if mediaType == headers.MediaTypeTAXII20 {
+		// Setup JSON stream encoder
+		j := json.NewEncoder(&body)
+		j.Encode(taxii20Resource(s.Resource))
+
+	} else if mediaType == defs.MEDIA_TYPE_JSON {
 		// Setup JSON stream encoder
-		j := json.NewEncoder(w)
-		w.Header().Set("Content-Type", defs.MEDIA_TYPE_JSON)
-		w.WriteHeader(http.StatusOK)
+		j := json.NewEncoder(&body)
 		j.SetIndent("", "    ")
 		j.Encode(s.Resource)
 
-	} else if s.HTMLEnabled == true && acceptHeader.HTML == true {
-		w.Header().Set("Content-Type", defs.MEDIA_TYPE_HTML)
-		w.WriteHeader(http.StatusOK)
-
+	} else if mediaType == defs.MEDIA_TYPE_HTML {
 		// ----------------------------------------------------------------------
 		// Setup HTML Template
 		// ----------------------------------------------------------------------
-		htmlTemplateResource := template.Must(template.ParseFiles(s.HTMLTemplate))
-		htmlTemplateResource.Execute(w, s)
+		if err := s.Templates.Execute(&body, s.HTMLTemplate, s); err != nil {
+			s.Logger.Errorln("ERROR: Unable to render the HTML template", s.HTMLTemplate, err)
+			s.sendHTMLTemplateError(w, r)
+			return
+		}
 
 	} else {
-		s.sendNotAcceptableError(w)
+		s.sendNotAcceptableError(w, r)
 		return
 	}
+
+	s.sendResource(w, r, mediaType, body.Bytes(), "")
 }
@@ -0,0 +1,361 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package headers
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// These are the media types that the headers package knows about, besides
+// the ones found in libstix2/defs.
+const (
+	MediaTypeTAXII20 = "application/vnd.oasis.taxii+json;version=2.0"
+	MediaTypeSTIX20  = "application/vnd.oasis.stix+json;version=2.0"
+)
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+MediaRange - This type holds a single media range from an Accept header as
+defined in RFC 7231 section 5.3.2.
+
+Type    - The type in lower case, or an asterisk for any type
+Subtype - The subtype in lower case, or an asterisk for any subtype
+Params  - The parameters other than q, with the names in lower case
+Q       - The quality value, from 0 to 1
+*/
+type MediaRange struct {
+	Type    string
+	Subtype string
+	Params  map[string]string
+	Q       float64
+}
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+ParseAccept - This function will parse an Accept header and return the media
+ranges that it lists, ranked from most to least preferred. Ranges are ranked by
+their quality value, then by how specific they are, and then by the order they
+were sent in. Ranges that can not be parsed are skipped.
+*/
+func ParseAccept(accept string) []MediaRange {
+	var ranges []MediaRange
+
+	for _, v := range splitList(accept) {
+		t, sub, params, ok := parseMediaType(v)
+		if !ok {
+			continue
+		}
+
+		m := MediaRange{Type: t, Subtype: sub, Params: params, Q: 1}
+		if q, found := params["q"]; found {
+			delete(params, "q")
+			value, err := strconv.ParseFloat(q, 64)
+			if err != nil || !(value >= 0 && value <= 1) {
+				continue
+			}
+			m.Q = value
+		}
+
+		// A wildcard type with a specific subtype is not a valid range
+		if m.Type == "*" && m.Subtype != "*" {
+			continue
+		}
+		ranges = append(ranges, m)
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].Q != ranges[j].Q {
+			return ranges[i].Q > ranges[j].Q
+		}
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+	return ranges
+}
+
+/*
+Negotiate - This function will return the offered media type that the client
+prefers the most, using the Accept header it sent. The offers are listed in the
+order the server prefers them, which is used to break ties. A missing Accept
+header accepts anything, so the first offer is returned. If none of the offers
+are acceptable an empty string is returned.
+*/
+func Negotiate(accept string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	ranges := ParseAccept(accept)
+	best := ""
+	bestQ := 0.0
+
+	for _, offer := range offers {
+		q := quality(ranges, offer)
+		if q > bestQ {
+			best = offer
+			bestQ = q
+		}
+	}
+	return best
+}
+
+/*
+SpecVersions - This function will return the STIX spec_version values that are
+allowed by a list of STIX media types, like the media_types of a collection.
+An empty list is returned when any version is allowed, which is the case when
+the list is empty or when one of the STIX media types does not have a version
+parameter.
+*/
+func SpecVersions(mediaTypes []string) []string {
+	var versions []string
+
+	for _, m := range mediaTypes {
+		t, sub, params, ok := parseMediaType(m)
+		if !ok || t != "application" || (sub != "stix+json" && sub != "vnd.oasis.stix+json") {
+			continue
+		}
+
+		v := params["version"]
+		if v == "" {
+			return nil
+		}
+
+		found := false
+		for _, existing := range versions {
+			if existing == v {
+				found = true
+			}
+		}
+		if !found {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - MediaRange
+// ----------------------------------------------------------------------
+
+/*
+Matches - This method will return true if the media type is covered by this
+media range. Every parameter of the range must be found in the media type with
+the same value, but the media type may have parameters the range does not.
+*/
+func (m MediaRange) Matches(mediaType string) bool {
+	t, sub, params, ok := parseMediaType(mediaType)
+	if !ok {
+		return false
+	}
+
+	if m.Type != "*" && m.Type != t {
+		return false
+	}
+	if m.Subtype != "*" && m.Subtype != sub {
+		return false
+	}
+
+	for k, v := range m.Params {
+		if params[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - MediaRange
+// ----------------------------------------------------------------------
+
+/*
+specificity - This method will return how specific the media range is. A range
+with parameters is more specific than one without, a full media type is more
+specific than a range with a wildcard subtype, and the any media type range is
+the least specific.
+*/
+func (m MediaRange) specificity() int {
+	if m.Type == "*" {
+		return 0
+	}
+	if m.Subtype == "*" {
+		return 1
+	}
+	return 2 + len(m.Params)
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+quality - This function will return the quality value that the client gave a
+media type. The most specific range that matches decides the value, as required
+by RFC 7231, and a media type that no range matches has a value of 0.
+*/
+func quality(ranges []MediaRange, mediaType string) float64 {
+	q := 0.0
+	specificity := -1
+
+	for _, m := range ranges {
+		if m.Matches(mediaType) && m.specificity() > specificity {
+			q = m.Q
+			specificity = m.specificity()
+		}
+	}
+	return q
+}
+
+/*
+parseMediaType - This function will parse a single media type or media range
+in to its lower case type and subtype and its parameters. Parameter values may
+be quoted strings.
+*/
+func parseMediaType(s string) (string, string, map[string]string, bool) {
+	parts := splitOutsideQuotes(s, ';')
+
+	full := strings.ToLower(strings.TrimSpace(parts[0]))
+	if full == "*" {
+		// Some clients send a bare * for any media type
+		full = "*/*"
+	}
+	slash := strings.Index(full, "/")
+	if slash <= 0 || slash == len(full)-1 {
+		return "", "", nil, false
+	}
+	t := full[:slash]
+	sub := full[slash+1:]
+	if !validToken(t) || !validToken(sub) {
+		return "", "", nil, false
+	}
+
+	params := make(map[string]string)
+	for _, p := range parts[1:] {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		eq := strings.Index(p, "=")
+		if eq <= 0 {
+			return "", "", nil, false
+		}
+		name := strings.ToLower(strings.TrimSpace(p[:eq]))
+		value := strings.TrimSpace(p[eq+1:])
+		if !validToken(name) {
+			return "", "", nil, false
+		}
+
+		if strings.HasPrefix(value, `"`) {
+			unquoted, ok := unquote(value)
+			if !ok {
+				return "", "", nil, false
+			}
+			value = unquoted
+		} else if !validToken(value) {
+			return "", "", nil, false
+		}
+		params[name] = value
+	}
+	return t, sub, params, true
+}
+
+/*
+splitList - This function will split a comma separated header value in to its
+elements, ignoring commas inside of quoted strings and empty elements.
+*/
+func splitList(s string) []string {
+	var list []string
+	for _, v := range splitOutsideQuotes(s, ',') {
+		if strings.TrimSpace(v) != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+/*
+splitOutsideQuotes - This function will split a string on a separator that is
+not inside of a quoted string.
+*/
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	quoted := false
+	escaped := false
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+/*
+unquote - This function will return the contents of a quoted string as defined
+in RFC 7230 section 3.2.6, with any quoted pairs replaced by the character
+they escape.
+*/
+func unquote(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", false
+	}
+
+	var b strings.Builder
+	escaped := false
+	for i := 1; i < len(s)-1; i++ {
+		switch {
+		case escaped:
+			b.WriteByte(s[i])
+			escaped = false
+		case s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			return "", false
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	if escaped {
+		return "", false
+	}
+	return b.String(), true
+}
+
+/*
+validToken - This function will return true if the string is a token as
+defined in RFC 7230 section 3.2.6.
+*/
+func validToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"(),/:;<=>?@[\]{}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
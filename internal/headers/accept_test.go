@@ -0,0 +1,167 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package headers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/freetaxii/libstix2/defs"
+)
+
+var taxiiOffers = []string{defs.MEDIA_TYPE_TAXII21, defs.MEDIA_TYPE_JSON, defs.MEDIA_TYPE_HTML}
+
+// ----------------------------------------------------------------------
+func Test_Negotiate(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		offers []string
+		want   string
+	}{
+		{"no header", "", taxiiOffers, defs.MEDIA_TYPE_TAXII21},
+		{"exact taxii", "application/taxii+json;version=2.1", taxiiOffers, defs.MEDIA_TYPE_TAXII21},
+		{"taxii without version", "application/taxii+json", taxiiOffers, defs.MEDIA_TYPE_TAXII21},
+		{"space after semicolon", "application/taxii+json;  version=2.1", taxiiOffers, defs.MEDIA_TYPE_TAXII21},
+		{"space around equals", "application/taxii+json ; version = 2.1", taxiiOffers, defs.MEDIA_TYPE_TAXII21},
+		{"quoted version", `application/taxii+json;version="2.1"`, taxiiOffers, defs.MEDIA_TYPE_TAXII21},
+		{"upper case", "Application/TAXII+JSON;Version=2.1", taxiiOffers, defs.MEDIA_TYPE_TAXII21},
+		{"wrong version", "application/taxii+json;version=2.0", taxiiOffers, ""},
+		{"taxii 2.0 only", "application/vnd.oasis.taxii+json;version=2.0", taxiiOffers, ""},
+		{"q values prefer html", "application/taxii+json;version=2.1;q=0.9, text/html;q=1", taxiiOffers, defs.MEDIA_TYPE_HTML},
+		{"q values prefer taxii", "text/html;q=0.5, application/taxii+json;q=0.8", taxiiOffers, defs.MEDIA_TYPE_TAXII21},
+		{"wildcard", "*/*", taxiiOffers, defs.MEDIA_TYPE_TAXII21},
+		{"bare wildcard", "*", taxiiOffers, defs.MEDIA_TYPE_TAXII21},
+		{"wildcard with lower q", "*/*;q=0.1, text/html", taxiiOffers, defs.MEDIA_TYPE_HTML},
+		{"subtype wildcard", "text/*", taxiiOffers, defs.MEDIA_TYPE_HTML},
+		{"specific range decides q", "application/*;q=0.9, application/taxii+json;q=0, application/json;q=0.5", taxiiOffers, defs.MEDIA_TYPE_JSON},
+		{"q of zero is refused", "text/html;q=0", taxiiOffers, ""},
+		{"html not offered", "text/html, application/json;q=0.2", taxiiOffers[:2], defs.MEDIA_TYPE_JSON},
+		{"browser header", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", taxiiOffers, defs.MEDIA_TYPE_HTML},
+		{"tie uses server order", "application/json, application/taxii+json", taxiiOffers, defs.MEDIA_TYPE_TAXII21},
+		{"invalid q skipped", "text/html;q=2, application/json", taxiiOffers, defs.MEDIA_TYPE_JSON},
+		{"garbage", ";;;,,,/", taxiiOffers, ""},
+		{"empty elements", " , application/json , ", taxiiOffers, defs.MEDIA_TYPE_JSON},
+		{"no offers", "*/*", nil, ""},
+	}
+
+	for _, tt := range tests {
+		if got := Negotiate(tt.accept, tt.offers); got != tt.want {
+			t.Errorf("%s: Negotiate(%q) = %q want %q", tt.name, tt.accept, got, tt.want)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_ParseAccept(t *testing.T) {
+	ranges := ParseAccept(`text/*;q=0.5, */*;q=0.1, text/html;level="1;2", text/html, application/json;q=0.5`)
+
+	want := []struct {
+		mediaType string
+		q         float64
+		params    int
+	}{
+		{"text/html", 1, 1},
+		{"text/html", 1, 0},
+		{"application/json", 0.5, 0},
+		{"text/*", 0.5, 0},
+		{"*/*", 0.1, 0},
+	}
+
+	if len(ranges) != len(want) {
+		t.Fatalf("wrong number of ranges: got %d want %d", len(ranges), len(want))
+	}
+
+	for i, w := range want {
+		got := ranges[i].Type + "/" + ranges[i].Subtype
+		if got != w.mediaType || ranges[i].Q != w.q || len(ranges[i].Params) != w.params {
+			t.Errorf("range %d: got %s q=%v %v want %s q=%v", i, got, ranges[i].Q, ranges[i].Params, w.mediaType, w.q)
+		}
+	}
+
+	if ranges[0].Params["level"] != "1;2" {
+		t.Errorf("quoted parameter not decoded: %v", ranges[0].Params)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_ParseTAXII(t *testing.T) {
+	var h MediaType
+	h.ParseTAXII("application/taxii+json; version=2.1, application/vnd.oasis.taxii+json, text/html;q=0")
+
+	if h.TAXII21 != true || h.TAXII20 != true || h.HTML != false || h.JSON != false {
+		t.Errorf("wrong media types found: %+v", h)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_ParseContentType(t *testing.T) {
+	tests := []struct {
+		media   string
+		taxii21 bool
+	}{
+		{"application/taxii+json;version=2.1", true},
+		{"application/taxii+json; version=\"2.1\"", true},
+		{"*/*", false},
+		{"*", false},
+		{"application/*", false},
+		{"application/taxii+json;version=2.1, */*", false},
+		{"text/html", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		var h MediaType
+		h.ParseContentType(test.media)
+		if h.TAXII21 != test.taxii21 {
+			t.Errorf("Content-Type %q: expected TAXII 2.1 %v, got %v", test.media, test.taxii21, h.TAXII21)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_SpecVersions(t *testing.T) {
+	tests := []struct {
+		mediaTypes []string
+		want       []string
+	}{
+		{nil, nil},
+		{[]string{defs.MEDIA_TYPE_STIX21}, []string{"2.1"}},
+		{[]string{MediaTypeSTIX20, defs.MEDIA_TYPE_STIX21, "application/stix+json; version=2.1"}, []string{"2.0", "2.1"}},
+		{[]string{defs.MEDIA_TYPE_STIX21, "application/stix+json"}, nil},
+		{[]string{"text/plain", defs.MEDIA_TYPE_STIX21}, []string{"2.1"}},
+	}
+
+	for _, tt := range tests {
+		got := SpecVersions(tt.mediaTypes)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("SpecVersions(%v) = %v want %v", tt.mediaTypes, got, tt.want)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func FuzzNegotiate(f *testing.F) {
+	f.Add("application/taxii+json;version=2.1;q=0.9, text/html;q=1")
+	f.Add(`text/html;level="a\"b", */*;q=0.001`)
+	f.Add("*, ;q=, /, a/b;c")
+
+	f.Fuzz(func(t *testing.T, accept string) {
+		got := Negotiate(accept, taxiiOffers)
+		if got != "" && got != taxiiOffers[0] && got != taxiiOffers[1] && got != taxiiOffers[2] {
+			t.Errorf("Negotiate(%q) returned %q which was not offered", accept, got)
+		}
+
+		for _, m := range ParseAccept(accept) {
+			if !(m.Q >= 0 && m.Q <= 1) {
+				t.Errorf("ParseAccept(%q) returned a q value of %v", accept, m.Q)
+			}
+			if m.Type == "" || m.Subtype == "" {
+				t.Errorf("ParseAccept(%q) returned an empty type", accept)
+			}
+		}
+	})
+}
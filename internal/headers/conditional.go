@@ -0,0 +1,106 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package headers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+ETag - This function will return an entity tag for a response body in the
+media type provided. The tag is weak since the same representation may be sent
+with different content codings.
+*/
+func ETag(mediaType string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(mediaType))
+	h.Write([]byte{0})
+	h.Write(body)
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+/*
+LastModified - This function will convert a TAXII date_added timestamp to the
+time used for the Last-Modified header. The zero time is returned if the
+timestamp is empty or can not be parsed.
+*/
+func LastModified(dateAdded string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, dateAdded)
+	if err != nil {
+		return time.Time{}
+	}
+	return t.UTC().Truncate(time.Second)
+}
+
+/*
+SetValidators - This function will add the ETag and Last-Modified headers to a
+response. Last-Modified is left out when it is the zero time.
+*/
+func SetValidators(w http.ResponseWriter, etag string, lastModified time.Time) {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if lastModified.IsZero() == false {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+/*
+NotModified - This function will return true if the conditional headers of a
+request show that the client already has the representation with the entity tag
+and modification time provided, as defined in RFC 7232 section 6. If-None-Match
+is checked first, and If-Modified-Since is only used when it is not sent.
+*/
+func NotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if values := r.Header["If-None-Match"]; len(values) > 0 {
+		return matchETag(strings.Join(values, ","), etag)
+	}
+
+	since := r.Header.Get("If-Modified-Since")
+	if since == "" || lastModified.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(since)
+	if err != nil {
+		return false
+	}
+	return lastModified.Truncate(time.Second).After(t) == false
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+matchETag - This function will return true if an If-None-Match header lists
+the entity tag provided or is an asterisk. The weak comparison is used, so the
+W/ prefix is ignored on both sides.
+*/
+func matchETag(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+
+	for _, v := range splitList(ifNoneMatch) {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package headers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/freetaxii/libstix2/defs"
+)
+
+// ----------------------------------------------------------------------
+func Test_ETag(t *testing.T) {
+	body := []byte(`{"title": "FreeTAXII"}`)
+	etag := ETag(defs.MEDIA_TYPE_TAXII21, body)
+
+	if etag != ETag(defs.MEDIA_TYPE_TAXII21, body) {
+		t.Error("the same body has different entity tags")
+	}
+	if etag == ETag(defs.MEDIA_TYPE_JSON, body) {
+		t.Error("different media types have the same entity tag")
+	}
+	if etag == ETag(defs.MEDIA_TYPE_TAXII21, []byte(`{"title": "Other"}`)) {
+		t.Error("different bodies have the same entity tag")
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_LastModified(t *testing.T) {
+	want := time.Date(2018, 3, 1, 12, 30, 15, 0, time.UTC)
+	if got := LastModified("2018-03-01T12:30:15.123456Z"); !got.Equal(want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+	if got := LastModified(""); !got.IsZero() {
+		t.Errorf("empty timestamp returned %v", got)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_NotModified(t *testing.T) {
+	etag := ETag(defs.MEDIA_TYPE_TAXII21, []byte("body"))
+	modified := LastModified("2018-03-01T12:30:15.5Z")
+
+	tests := []struct {
+		name   string
+		method string
+		header map[string]string
+		want   bool
+	}{
+		{"no conditions", "GET", nil, false},
+		{"matching etag", "GET", map[string]string{"If-None-Match": etag}, true},
+		{"strong form of etag", "GET", map[string]string{"If-None-Match": etag[2:]}, true},
+		{"etag in list", "GET", map[string]string{"If-None-Match": `"abc", ` + etag}, true},
+		{"asterisk", "GET", map[string]string{"If-None-Match": "*"}, true},
+		{"other etag", "GET", map[string]string{"If-None-Match": `"abc"`}, false},
+		{"etag wins over date", "GET", map[string]string{"If-None-Match": `"abc"`, "If-Modified-Since": "Thu, 01 Mar 2018 12:30:15 GMT"}, false},
+		{"same date", "GET", map[string]string{"If-Modified-Since": "Thu, 01 Mar 2018 12:30:15 GMT"}, true},
+		{"later date", "GET", map[string]string{"If-Modified-Since": "Fri, 02 Mar 2018 00:00:00 GMT"}, true},
+		{"earlier date", "GET", map[string]string{"If-Modified-Since": "Thu, 01 Mar 2018 12:30:14 GMT"}, false},
+		{"invalid date", "GET", map[string]string{"If-Modified-Since": "yesterday"}, false},
+		{"post", "POST", map[string]string{"If-None-Match": etag}, false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/", nil)
+		for k, v := range tt.header {
+			r.Header.Set(k, v)
+		}
+		if got := NotModified(r, etag, modified); got != tt.want {
+			t.Errorf("%s: got %v want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Without a modification time If-Modified-Since can not be answered
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("If-Modified-Since", "Fri, 02 Mar 2018 00:00:00 GMT")
+	if NotModified(r, etag, time.Time{}) == true {
+		t.Error("If-Modified-Since was used without a modification time")
+	}
+}
@@ -7,8 +7,8 @@ package headers
 
 import (
 	"net/http"
-	"strings"
 
+	"github.com/freetaxii/libstix2/defs"
 	"github.com/gologme/log"
 )
 
@@ -21,38 +21,59 @@ type MediaType struct {
 	JSON    bool
 }
 
+/*
+ParseTAXII - This method will set a flag for each TAXII, JSON, or HTML media
+type that the header value accepts. Quality values of 0 are not accepted.
+*/
 func (h *MediaType) ParseTAXII(media string) {
-	// If there are spaces after the semicolon, remove all of them
-	a := strings.Replace(media, "; ", ";", -1)
-	a1 := strings.Split(a, ",")
-
-	for _, v := range a1 {
-		if v == "*" || v == "*/*" || v == "application/taxii+json" || v == "application/taxii+json;version=2.1" {
-			h.TAXII21 = true
-		} else if v == "application/vnd.oasis.taxii+json" || v == "application/vnd.oasis.taxii+json;version=2.0" {
-			h.TAXII20 = true
-		} else if strings.Contains(v, "application/json") {
-			h.JSON = true
-		} else if strings.Contains(v, "text/html") {
-			h.HTML = true
+	for _, m := range ParseAccept(media) {
+		if m.Q == 0 {
+			continue
 		}
+		h.TAXII21 = h.TAXII21 || m.Matches(defs.MEDIA_TYPE_TAXII21)
+		h.TAXII20 = h.TAXII20 || m.Matches(MediaTypeTAXII20)
+		h.JSON = h.JSON || m.Matches(defs.MEDIA_TYPE_JSON)
+		h.HTML = h.HTML || m.Matches(defs.MEDIA_TYPE_HTML)
 	}
 }
 
-func (h *MediaType) ParseSTIX(media string) {
-	a := strings.Replace(media, " ", "", -1)
-	a1 := strings.Split(a, ",")
+/*
+ParseContentType - This method will set a flag for the TAXII, JSON, or HTML
+media type of a Content-Type header. A Content-Type names the one media type of
+a body, so a list of media types, or a media range with a wildcard type or
+subtype, does not set any flag.
+*/
+func (h *MediaType) ParseContentType(media string) {
+	list := splitList(media)
+	if len(list) != 1 {
+		return
+	}
+
+	t, sub, params, ok := parseMediaType(list[0])
+	if !ok || t == "*" || sub == "*" {
+		return
+	}
+
+	m := MediaRange{Type: t, Subtype: sub, Params: params, Q: 1}
+	h.TAXII21 = m.Matches(defs.MEDIA_TYPE_TAXII21)
+	h.TAXII20 = m.Matches(MediaTypeTAXII20)
+	h.JSON = m.Matches(defs.MEDIA_TYPE_JSON)
+	h.HTML = m.Matches(defs.MEDIA_TYPE_HTML)
+}
 
-	for _, v := range a1 {
-		if v == "*" || v == "*/*" || v == "application/stix+json" || v == "application/stix+json;version=2.1" {
-			h.STIX21 = true
-		} else if v == "application/vnd.oasis.stix+json" || v == "application/vnd.oasis.stix+json;version=2.0" {
-			h.STIX20 = true
-		} else if strings.Contains(v, "application/json") {
-			h.JSON = true
-		} else if strings.Contains(v, "text/html") {
-			h.HTML = true
+/*
+ParseSTIX - This method will set a flag for each STIX, JSON, or HTML media type
+that the header value accepts. Quality values of 0 are not accepted.
+*/
+func (h *MediaType) ParseSTIX(media string) {
+	for _, m := range ParseAccept(media) {
+		if m.Q == 0 {
+			continue
 		}
+		h.STIX21 = h.STIX21 || m.Matches(defs.MEDIA_TYPE_STIX21)
+		h.STIX20 = h.STIX20 || m.Matches(MediaTypeSTIX20)
+		h.JSON = h.JSON || m.Matches(defs.MEDIA_TYPE_JSON)
+		h.HTML = h.HTML || m.Matches(defs.MEDIA_TYPE_HTML)
 	}
 }
 
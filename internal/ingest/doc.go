@@ -0,0 +1,25 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package ingest adds STIX objects to a collection. The same ingest path is used
+for objects that are posted to the TAXII objects endpoint and for bundle and
+envelope files that are dropped in to a watched directory. Each object is
+validated against the specification of its STIX version before it is added,
+STIX 2.0 for objects without a spec_version, except for cyber-observable
+objects, and STIX 2.1 otherwise. The reason an object was rejected is recorded
+in the status resource. Values of the open vocabularies that the specification
+does not suggest are only logged as a warning, as producers are allowed to use
+their own.
+
+Ingesting is idempotent. An object with the same id and version as an object
+that is already in the collection is reported as already present and is not
+written again, unless its content is different, in which case it is reported as
+a conflict. A version that is already stored for another collection is only
+added to this collection, as the datastore keeps each version once. The content
+is compared in the form the datastore keeps it. The outcomes are counted in the
+"ingest" metrics for each collection.
+*/
+package ingest
@@ -0,0 +1,415 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package ingest
+
+import (
+	"encoding/json"
+	"expvar"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/freetaxii/libstix2/datastore"
+	"github.com/freetaxii/libstix2/objects"
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/libstix2/resources/status"
+	"github.com/freetaxii/server/internal/markings"
+	"github.com/gologme/log"
+)
+
+// metrics - The counters for the outcome of each object that is ingested, by
+// collection. These are published with the rest of the server metrics.
+var metrics = expvar.NewMap("ingest")
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Ingester - This type holds everything that is needed to add objects to a
+single collection.
+*/
+type Ingester struct {
+	Logger       *log.Logger
+	DS           datastore.Datastorer
+	CollectionID string
+	Notifier     Notifier         // Told about the objects that were added, if defined
+	SpecVersions []string         // Only objects with these spec_version values are accepted, any if empty
+	Markings     *markings.Policy // The data markings objects may carry, not enforced if nil
+	Versions     VersionFinder    // Finds the other collection a version is already stored for, not looked up if nil
+}
+
+/*
+VersionFinder - This interface is used to find a collection, other than the one
+provided, that a version of an object was already added to. It is a single
+lookup by the id and version of the object, whatever the number of collections.
+An empty version matches an object without a version. It returns an empty
+string if the version is not found.
+*/
+type VersionFinder interface {
+	FindVersion(collectionID, id, version string) (string, error)
+}
+
+/*
+Notifier - This interface is used to tell other parts of the server about the
+objects that were just added to a collection.
+*/
+type Notifier interface {
+	Notify(collectionID string, added []Added)
+}
+
+/*
+Notifiers - This type is a Notifier that passes each notification on to every
+Notifier in the list.
+*/
+type Notifiers []Notifier
+
+/*
+Added - This type identifies an object that was added to a collection. The
+object itself is kept for the notifiers that need its content, like the search
+index, but it is never sent.
+*/
+type Added struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"-"`
+}
+
+/*
+Counts - This type records the number of objects that were processed by a
+single call to Ingest. Duplicates are objects that were already present and
+are also counted as a success. Conflicts are objects that have the same id and
+version as an object that is already present but different content and are
+also counted as a failure. Transient failures are objects that were valid but
+could not be written because of a datastore error, so they may be added if they
+are sent again, and are also counted as a failure. Every other failure is an
+object that will be rejected every time it is sent.
+*/
+type Counts struct {
+	Total     int
+	Success   int
+	Failure   int
+	Duplicate int
+	Conflict  int
+	Transient int
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+New - This function will create a new Ingester for the collection provided.
+*/
+func New(logger *log.Logger, ds datastore.Datastorer, collectionID string) *Ingester {
+	var in Ingester
+
+	if logger == nil {
+		in.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	} else {
+		in.Logger = logger
+	}
+
+	in.DS = ds
+	in.CollectionID = collectionID
+	return &in
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Ingester
+// ----------------------------------------------------------------------
+
+/*
+Ingest - This method will decode each raw object one at a time and if the
+object is valid write it off to the datastore and add it to the collection.
+The outcome for each object and the totals are recorded in the status
+resource.
+*/
+func (in *Ingester) Ingest(rawObjects []json.RawMessage, statusMessage *status.Status) Counts {
+	var c Counts
+	var added []Added
+
+	for _, v := range rawObjects {
+		c.Total++
+		in.Logger.Debugln("DEBUG: Processing envelope object number", c.Total)
+
+		// First, validate the object so that the client is told exactly why an
+		// object was not accepted. The id and version are read even if the
+		// object is not valid so the failure can be reported against them.
+		id, version, err := Validate(v)
+
+		// Only objects that match the media types of the collection are accepted
+		if len(in.SpecVersions) > 0 {
+			specVersion := SpecVersion(v)
+			if !contains(in.SpecVersions, specVersion) {
+				in.Logger.Infoln("INFO: Object", id, "with spec_version", specVersion, "does not match the media types of collection", in.CollectionID)
+				c.Failure++
+				statusMessage.CreateFailureDetails(id, version, "spec_version "+specVersion+" does not match the media types of this collection")
+				continue
+			}
+		}
+
+		if err != nil {
+			in.Logger.Infoln("INFO: Object", id, "in envelope is not valid:", err)
+			c.Failure++
+			statusMessage.CreateFailureDetails(id, version, err.Error())
+			// If there is an error, lets just skip and move on to the next object
+			continue
+		}
+
+		// Values of the open vocabularies that STIX does not suggest are
+		// allowed, but they may be a typo
+		for _, w := range Warnings(v) {
+			in.Logger.Warnln("WARN: Object", id, "in collection", in.CollectionID, w)
+		}
+
+		// Unmarked objects get the default markings of the collection and only
+		// objects with markings that are allowed are accepted
+		if in.Markings != nil {
+			v = in.Markings.ApplyDefault(v)
+			if disallowed := in.Markings.Disallowed(markings.Refs(v)); len(disallowed) > 0 {
+				in.Logger.Infoln("INFO: Object", id, "has markings", disallowed, "that are not allowed in collection", in.CollectionID)
+				c.Failure++
+				statusMessage.CreateFailureDetails(id, version, "markings "+strings.Join(disallowed, ", ")+" are not allowed in this collection")
+				continue
+			}
+		}
+
+		// Ingesting is idempotent. If this version of the object is already in
+		// the collection it is not written again. It is a success if the content
+		// is the same and a conflict if it is not.
+		if stored, found := in.existing(in.CollectionID, id, version); found {
+			if sameObject(v, stored) {
+				in.Logger.Debugln("DEBUG: Object", id, "version", version, "is already in collection", in.CollectionID)
+				c.Success++
+				c.Duplicate++
+				statusMessage.CreateSuccessDetails(id, version, "Object already present")
+			} else {
+				in.Logger.Infoln("INFO: Object", id, "version", version, "conflicts with the object already in collection", in.CollectionID)
+				c.Failure++
+				c.Conflict++
+				statusMessage.CreateFailureDetails(id, version, "conflict: a different object with the same id and version is already present")
+			}
+			continue
+		}
+
+		// The datastore keeps each version of an object once, so a version
+		// that is already stored for another collection is only added to this
+		// one. It is still a conflict if its content is different.
+		if stored, collectionID, found := in.elsewhere(id, version); found {
+			if !sameObject(v, stored) {
+				in.Logger.Infoln("INFO: Object", id, "version", version, "conflicts with the object already in collection", collectionID)
+				c.Failure++
+				c.Conflict++
+				statusMessage.CreateFailureDetails(id, version, "conflict: a different object with the same id and version is already present")
+				continue
+			}
+
+			in.Logger.Debugln("DEBUG: Object", id, "version", version, "is already in collection", collectionID, "adding it to collection", in.CollectionID)
+			if err := in.DS.AddToCollection(in.CollectionID, id); err != nil {
+				in.Logger.Errorln("ERROR: Error adding object", id, "to collection", in.CollectionID, err)
+				c.Failure++
+				c.Transient++
+				statusMessage.CreateFailureDetails(id, version, "unable to add object to the collection")
+				continue
+			}
+			c.Success++
+			statusMessage.CreateSuccessDetails(id, version, "Object added")
+			added = append(added, Added{ID: id, Type: objectType(id), Object: v})
+			continue
+		}
+
+		// Next, decode the object and if it succeeds try to add it to the
+		// datastore
+		o, err := objects.Decode(v)
+		if err != nil {
+			in.Logger.Errorln("ERROR: Error decoding object in envelope", err)
+			c.Failure++
+			statusMessage.CreateFailureDetails(id, version, "unable to decode object: "+err.Error())
+			continue
+		}
+
+		// Add the object to the datastore, if the decode was successful
+		in.Logger.Debugln("DEBUG: Adding object", id, "to the datastore")
+		err = in.DS.AddObject(o)
+		if err != nil {
+			in.Logger.Errorln("ERROR: Error adding object", id, "to datastore", err)
+			c.Failure++
+			c.Transient++
+			statusMessage.CreateFailureDetails(id, version, "unable to add object to the datastore")
+			// If there was an error, lets just skip and move on to the next object
+			continue
+		}
+
+		// If the add was successful then lets add an entry in to the collection
+		// record table. The object is only added once it is in the collection.
+		in.Logger.Debugln("DEBUG: Adding Collection Entry of", in.CollectionID, id)
+		err = in.DS.AddToCollection(in.CollectionID, id)
+		if err != nil {
+			in.Logger.Errorln("ERROR: Error adding object", id, "to collection", in.CollectionID, err)
+			c.Failure++
+			c.Transient++
+			statusMessage.CreateFailureDetails(id, version, "unable to add object to the collection")
+			continue
+		}
+		c.Success++
+		statusMessage.CreateSuccessDetails(id, version, "Object added")
+		added = append(added, Added{ID: id, Type: objectType(id), Object: v})
+	}
+
+	statusMessage.SetTotalCount(c.Total)
+	statusMessage.SetSuccessCount(c.Success)
+	statusMessage.SetFailureCount(c.Failure)
+
+	in.Logger.Debugln("DEBUG: Total number of objects in Envelope", c.Total)
+	in.Logger.Debugln("DEBUG: Total objects successfully added to datastore", c.Success)
+	in.Logger.Debugln("DEBUG: Total objects that failed to be added to the datastore", c.Failure)
+	in.Logger.Debugln("DEBUG: Total objects that were already present", c.Duplicate)
+	in.Logger.Debugln("DEBUG: Total objects that conflict with an object already present", c.Conflict)
+
+	metrics.Add(in.CollectionID+".added", int64(c.Success-c.Duplicate))
+	metrics.Add(in.CollectionID+".duplicates", int64(c.Duplicate))
+	metrics.Add(in.CollectionID+".conflicts", int64(c.Conflict))
+	metrics.Add(in.CollectionID+".failures", int64(c.Failure-c.Conflict))
+
+	if in.Notifier != nil && len(added) > 0 {
+		in.Notifier.Notify(in.CollectionID, added)
+	}
+
+	return c
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Notifiers
+// ----------------------------------------------------------------------
+
+/*
+Notify - This method will pass the notification on to every Notifier in the
+list.
+*/
+func (n Notifiers) Notify(collectionID string, added []Added) {
+	for _, v := range n {
+		v.Notify(collectionID, added)
+	}
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - Ingester
+// ----------------------------------------------------------------------
+
+/*
+existing - This method will look for a version of an object in a collection
+and return it if it is found. Objects without a version, like cyber-observable
+objects, only have one version.
+*/
+func (in *Ingester) existing(collectionID, id, version string) (interface{}, bool) {
+	if in.DS == nil || id == "" {
+		return nil, false
+	}
+
+	q := collections.NewCollectionQuery(collectionID, 1)
+	q.STIXID = []string{id}
+	if version != "" {
+		q.STIXVersion = []string{version}
+	} else {
+		q.STIXVersion = []string{"last"}
+	}
+
+	// The datastore returns an error when no records are found
+	results, err := in.DS.GetObjects(*q)
+	if err != nil || results == nil || len(results.ObjectData.Objects) == 0 {
+		return nil, false
+	}
+	return results.ObjectData.Objects[0], true
+}
+
+/*
+elsewhere - This method will look for a version of an object in the other
+collections of the datastore and return it, along with the collection it was
+found in.
+*/
+func (in *Ingester) elsewhere(id, version string) (interface{}, string, bool) {
+	if in.Versions == nil || id == "" {
+		return nil, "", false
+	}
+
+	collectionID, err := in.Versions.FindVersion(in.CollectionID, id, version)
+	if err != nil {
+		in.Logger.Errorln("ERROR: Unable to look for object", id, "version", version, "in the other collections", err)
+		return nil, "", false
+	}
+	if collectionID == "" {
+		return nil, "", false
+	}
+
+	stored, found := in.existing(collectionID, id, version)
+	return stored, collectionID, found
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+objectType - This function will return the object type from a STIX identifier.
+*/
+func objectType(id string) string {
+	return strings.SplitN(id, "--", 2)[0]
+}
+
+/*
+contains - This function will return true if the value is in the list.
+*/
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+sameObject - This function will return true if the raw JSON of an object has
+the same content as an object from the datastore. The datastore only keeps the
+properties that it knows about, so both are compared in the form they have once
+they are decoded and encoded again. The order of the properties and the white
+space do not matter.
+*/
+func sameObject(data []byte, stored interface{}) bool {
+	storedData, err := json.Marshal(stored)
+	if err != nil {
+		return false
+	}
+
+	a, errA := canonical(data)
+	b, errB := canonical(storedData)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+/*
+canonical - This function will decode the raw JSON of an object the same way
+it is decoded before it is added to the datastore, and return the generic JSON
+value of what would be stored.
+*/
+func canonical(data []byte) (interface{}, error) {
+	o, err := objects.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	err = json.Unmarshal(stored, &v)
+	return v, err
+}
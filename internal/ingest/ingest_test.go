@@ -0,0 +1,171 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package ingest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/freetaxii/libstix2/resources/status"
+	"github.com/freetaxii/server/internal/markings"
+	"github.com/freetaxii/server/internal/storetest"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// collectionFailure - This type is a datastore that stores objects but can not
+// add them to a collection.
+type collectionFailure struct {
+	*storetest.Store
+}
+
+func (s collectionFailure) AddToCollection(collectionID, stixid string) error {
+	return errors.New("database is locked")
+}
+
+// notified - This type is a Notifier that records the objects it is told about.
+type notified []Added
+
+func (n *notified) Notify(collectionID string, added []Added) {
+	*n = append(*n, added...)
+}
+
+// ----------------------------------------------------------------------
+func Test_IngestSpecVersions(t *testing.T) {
+	in := New(storetest.Logger(), nil, "1234")
+	in.SpecVersions = []string{"2.1"}
+
+	objects := []json.RawMessage{
+		indicator(map[string]interface{}{"spec_version": "2.0"}),
+		indicator(map[string]interface{}{"spec_version": nil}),
+	}
+
+	c := in.Ingest(objects, status.New())
+	if c.Total != 2 || c.Failure != 2 || c.Success != 0 {
+		t.Errorf("objects that do not match the collection media types were not rejected: %+v", c)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_IngestDuplicates(t *testing.T) {
+	ds := storetest.New()
+	ds.Add("1234", "2018-02-01T00:00:00.000000Z", string(indicator(nil)))
+	in := New(storetest.Logger(), ds, "1234")
+
+	// The same object with its properties in a different order
+	var reordered map[string]interface{}
+	json.Unmarshal(indicator(nil), &reordered)
+	same, _ := json.MarshalIndent(reordered, "", "  ")
+
+	objects := []json.RawMessage{
+		same,
+		indicator(map[string]interface{}{"pattern": "[ipv4-addr:value = '198.51.100.2']"}),
+		indicator(map[string]interface{}{"modified": "2018-03-01T00:00:00.000Z"}),
+	}
+
+	c := in.Ingest(objects, status.New())
+	if c.Success != 2 || c.Duplicate != 1 || c.Failure != 1 || c.Conflict != 1 {
+		t.Errorf("wrong outcome for duplicate, conflicting and new versions: %+v", c)
+	}
+	if ds.Count("1234") != 2 {
+		t.Errorf("only the new version should be written to the datastore, the collection has %d versions", ds.Count("1234"))
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_IngestOtherCollection(t *testing.T) {
+	ds := storetest.New()
+	ds.Add("5678", "2018-02-01T00:00:00.000000Z", string(indicator(nil)))
+	in := New(storetest.Logger(), ds, "1234")
+	in.Versions = ds
+
+	// The version that is already stored for collection 5678 is added to this
+	// collection as well, but a different object with the same version is not
+	objects := []json.RawMessage{
+		indicator(nil),
+		indicator(map[string]interface{}{"pattern": "[ipv4-addr:value = '198.51.100.2']"}),
+	}
+
+	c := in.Ingest(objects, status.New())
+	if c.Success != 1 || c.Duplicate != 0 || c.Failure != 1 || c.Conflict != 1 {
+		t.Errorf("wrong outcome for objects stored for another collection: %+v", c)
+	}
+	if ds.Count("1234") != 1 || ds.Count("5678") != 1 {
+		t.Errorf("the stored version should be in both collections, found %d and %d", ds.Count("1234"), ds.Count("5678"))
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_IngestMarkings(t *testing.T) {
+	ds := storetest.New()
+	in := New(storetest.Logger(), ds, "1234")
+	in.Markings = markings.New([]string{markings.TLP["tlp:green"]}, []string{markings.TLP["tlp:green"]})
+
+	objects := []json.RawMessage{
+		indicator(map[string]interface{}{"object_marking_refs": []string{markings.TLP["tlp:red"]}}),
+		indicator(map[string]interface{}{"modified": "2018-03-01T00:00:00.000Z"}),
+	}
+
+	c := in.Ingest(objects, status.New())
+	if c.Success != 1 || c.Failure != 1 || ds.Count("1234") != 1 {
+		t.Errorf("objects with markings that are not allowed were not rejected: %+v", c)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_IngestCollectionFailure(t *testing.T) {
+	var n notified
+	in := New(storetest.Logger(), collectionFailure{storetest.New()}, "1234")
+	in.Notifier = &n
+
+	c := in.Ingest([]json.RawMessage{indicator(nil)}, status.New())
+	if c.Success != 0 || c.Failure != 1 || c.Transient != 1 {
+		t.Errorf("an object that could not be added to the collection was not a failure: %+v", c)
+	}
+	if len(n) != 0 {
+		t.Errorf("the notifiers were told about an object that is not in the collection: %v", n)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_SQLiteFinder(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "ingest.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, stmt := range []string{
+		`CREATE TABLE s_base_object (id TEXT, modified TEXT)`,
+		`CREATE TABLE t_collection_data (collection_id TEXT, stix_id TEXT)`,
+		`INSERT INTO s_base_object VALUES ("malware--1", "2018-01-01T00:00:00.000Z")`,
+		`INSERT INTO t_collection_data VALUES ("1234", "malware--1"), ("5678", "malware--1")`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tests = []struct {
+		collectionID string
+		version      string
+		found        string
+	}{
+		{"1234", "2018-01-01T00:00:00.000Z", "5678"},
+		{"5678", "2018-01-01T00:00:00.000Z", "1234"},
+		{"9999", "", "1234"},
+		{"1234", "2018-01-02T00:00:00.000Z", ""},
+	}
+
+	f := NewSQLiteFinder(db)
+	for _, test := range tests {
+		if v, err := f.FindVersion(test.collectionID, "malware--1", test.version); v != test.found || err != nil {
+			t.Errorf("version %q outside of %s found in %q %v, expected %q", test.version, test.collectionID, v, err, test.found)
+		}
+	}
+}
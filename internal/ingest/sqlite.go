@@ -0,0 +1,46 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package ingest
+
+import (
+	"database/sql"
+)
+
+/*
+SQLiteFinder - This type implements the VersionFinder interface for the sqlite3
+datastore. The versions of an object are stored once and each collection lists
+the objects that were added to it.
+*/
+type SQLiteFinder struct {
+	DB *sql.DB
+}
+
+/*
+NewSQLiteFinder - This function will create a new VersionFinder for the sqlite3
+datastore that uses the provided database connection.
+*/
+func NewSQLiteFinder(db *sql.DB) *SQLiteFinder {
+	return &SQLiteFinder{DB: db}
+}
+
+/*
+FindVersion - This method will return a collection, other than the one
+provided, that lists an object whose version is stored in the datastore, or an
+empty string if there is none.
+*/
+func (f *SQLiteFinder) FindVersion(collectionID, id, version string) (string, error) {
+	stmt := `SELECT c.collection_id FROM s_base_object AS b
+		JOIN t_collection_data AS c ON c.stix_id = b.id
+		WHERE b.id = ? AND (? = '' OR b.modified = ?) AND c.collection_id != ?
+		LIMIT 1`
+
+	var found string
+	err := f.DB.QueryRow(stmt, id, version, version, collectionID).Scan(&found)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return found, err
+}
@@ -0,0 +1,501 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// These regular expressions define the format of STIX 2.1 object types,
+// identifiers, and timestamps.
+var (
+	typePattern      = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,248}[a-z0-9]$`)
+	uuidPattern      = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	timestampPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?Z$`)
+)
+
+// cyberObservables - The STIX 2.1 cyber-observable object types. These do not
+// have the created and modified properties and spec_version is optional.
+var cyberObservables = map[string]bool{
+	"artifact":             true,
+	"autonomous-system":    true,
+	"directory":            true,
+	"domain-name":          true,
+	"email-addr":           true,
+	"email-message":        true,
+	"file":                 true,
+	"ipv4-addr":            true,
+	"ipv6-addr":            true,
+	"mac-addr":             true,
+	"mutex":                true,
+	"network-traffic":      true,
+	"process":              true,
+	"software":             true,
+	"url":                  true,
+	"user-account":         true,
+	"windows-registry-key": true,
+	"x509-certificate":     true,
+}
+
+// requiredProperties - The properties that STIX 2.1 requires for each object
+// type, in addition to the common properties.
+var requiredProperties = map[string][]string{
+	"attack-pattern":   {"name"},
+	"campaign":         {"name"},
+	"course-of-action": {"name"},
+	"grouping":         {"context", "object_refs"},
+	"identity":         {"name"},
+	"indicator":        {"pattern", "pattern_type", "valid_from"},
+	"infrastructure":   {"name"},
+	"intrusion-set":    {"name"},
+	"language-content": {"object_ref", "contents"},
+	"malware":          {"is_family"},
+	"malware-analysis": {"product"},
+	"note":             {"content", "object_refs"},
+	"observed-data":    {"first_observed", "last_observed", "number_observed"},
+	"opinion":          {"opinion", "object_refs"},
+	"relationship":     {"relationship_type", "source_ref", "target_ref"},
+	"report":           {"name", "published", "object_refs"},
+	"sighting":         {"sighting_of_ref"},
+	"threat-actor":     {"name"},
+	"tool":             {"name"},
+	"vulnerability":    {"name"},
+}
+
+// enumerations - The STIX 2.1 enumerations, by object type and property.
+// These are closed lists, so values outside of them are rejected.
+var enumerations = map[string]map[string][]string{
+	"opinion": {
+		"opinion": {"strongly-disagree", "disagree", "neutral", "agree", "strongly-agree"},
+	},
+}
+
+// requiredProperties20 - The properties that STIX 2.0 requires for each object
+// type, in addition to the common properties.
+var requiredProperties20 = map[string][]string{
+	"attack-pattern":     {"name"},
+	"campaign":           {"name"},
+	"course-of-action":   {"name"},
+	"identity":           {"name", "identity_class"},
+	"indicator":          {"labels", "pattern", "valid_from"},
+	"intrusion-set":      {"name"},
+	"malware":            {"labels", "name"},
+	"marking-definition": {"definition_type", "definition"},
+	"observed-data":      {"first_observed", "last_observed", "number_observed", "objects"},
+	"relationship":       {"relationship_type", "source_ref", "target_ref"},
+	"report":             {"labels", "name", "published", "object_refs"},
+	"sighting":           {"sighting_of_ref"},
+	"threat-actor":       {"labels", "name"},
+	"tool":               {"labels", "name"},
+	"vulnerability":      {"name"},
+}
+
+// vocabularies - The STIX 2.1 open vocabularies, by object type and property.
+// Producers may use values outside of these, so they are only reported as
+// warnings.
+var vocabularies = map[string]map[string][]string{
+	"grouping": {
+		"context": {"suspicious-activity", "malware-analysis", "unspecified"},
+	},
+	"identity": {
+		"identity_class": {"individual", "group", "system", "organization", "class", "unknown"},
+	},
+	"indicator": {
+		"indicator_types": {"anomalous-activity", "anonymization", "benign", "compromised", "malicious-activity", "attribution", "unknown"},
+		"pattern_type":    {"stix", "pcre", "sigma", "snort", "suricata", "yara"},
+	},
+	"infrastructure": {
+		"infrastructure_types": {"amplification", "anonymization", "botnet", "command-and-control", "exfiltration", "hosting-malware", "hosting-target-lists", "phishing", "reconnaissance", "staging", "unknown"},
+	},
+	"malware": {
+		"malware_types": {"adware", "backdoor", "bot", "bootkit", "ddos", "downloader", "dropper", "exploit-kit", "keylogger", "ransomware", "remote-access-trojan", "resource-exploitation", "rogue-security-software", "rootkit", "screen-capture", "spyware", "trojan", "unknown", "virus", "webshell", "wiper", "worm"},
+	},
+	"report": {
+		"report_types": {"attack-pattern", "campaign", "identity", "indicator", "intrusion-set", "malware", "observed-data", "threat-actor", "threat-report", "tool", "vulnerability"},
+	},
+	"threat-actor": {
+		"threat_actor_types": {"activist", "competitor", "crime-syndicate", "criminal", "hacker", "insider-accidental", "insider-disgruntled", "nation-state", "sensationalist", "spy", "terrorist", "unknown"},
+	},
+	"tool": {
+		"tool_types": {"denial-of-service", "exploitation", "information-gathering", "network-capture", "credential-exploitation", "remote-access", "vulnerability-scanning", "unknown"},
+	},
+}
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+ValidationError - This type describes why an object is not a valid STIX
+object. The message is sent back to the client in the status resource.
+*/
+type ValidationError struct {
+	Property string
+	Reason   string
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - ValidationError
+// ----------------------------------------------------------------------
+
+/*
+Error - This method will return the reason the object failed validation.
+*/
+func (e *ValidationError) Error() string {
+	if e.Property == "" {
+		return e.Reason
+	}
+	return "property " + e.Property + " " + e.Reason
+}
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+Validate - This function will check that the raw JSON of an object is a valid
+object of its STIX version, 2.0 for objects without a spec_version, except for
+cyber-observable objects, and 2.1 otherwise. It checks the common and type
+specific mandatory properties, the identifier format, the timestamp formats and
+their order, spec_version, and the values of the STIX 2.1 enumerations. The id
+and the version of the object are returned whenever they can be read, even if
+the object is not valid, so that the failure can be reported against them.
+*/
+func Validate(data []byte) (string, string, error) {
+	var o map[string]interface{}
+	if err := json.Unmarshal(data, &o); err != nil {
+		return "", "", &ValidationError{Reason: "object is not valid JSON: " + err.Error()}
+	}
+
+	id, _ := o["id"].(string)
+	version, _ := o["modified"].(string)
+	if version == "" {
+		version, _ = o["created"].(string)
+	}
+
+	return id, version, validateObject(o)
+}
+
+/*
+Warnings - This function will return a description of each value of a STIX
+2.1 open vocabulary in the raw JSON of a STIX 2.1 object that is not one of the
+values the specification suggests. These do not make the object invalid.
+*/
+func Warnings(data []byte) []string {
+	var o map[string]interface{}
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil
+	}
+
+	objectType, _ := o["type"].(string)
+	if SpecVersion(data) != "2.1" {
+		return nil
+	}
+
+	var warnings []string
+	for property, values := range vocabularies[objectType] {
+		if err := inVocabulary(o, property, values); err != nil {
+			warnings = append(warnings, err.Error())
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+/*
+SpecVersion - This function will return the STIX version of the raw JSON of
+an object. Objects without a spec_version are STIX 2.0 objects, except for
+cyber-observable objects where STIX 2.1 made it optional.
+*/
+func SpecVersion(data []byte) string {
+	var o struct {
+		Type        string `json:"type"`
+		SpecVersion string `json:"spec_version"`
+	}
+	json.Unmarshal(data, &o)
+
+	if o.SpecVersion != "" {
+		return o.SpecVersion
+	}
+	if cyberObservables[o.Type] == true {
+		return "2.1"
+	}
+	return "2.0"
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+validateObject - This function will run each of the validation checks on a
+decoded object and return the first problem that is found.
+*/
+func validateObject(o map[string]interface{}) error {
+
+	// ----------------------------------------------------------------------
+	// Type and Identifier
+	// ----------------------------------------------------------------------
+	objectType, err := requiredString(o, "type")
+	if err != nil {
+		return err
+	}
+	if !typePattern.MatchString(objectType) || strings.Contains(objectType, "--") {
+		return &ValidationError{"type", "must be 3 to 250 lowercase letters, digits, and hyphens"}
+	}
+
+	id, err := requiredString(o, "id")
+	if err != nil {
+		return err
+	}
+	parts := strings.SplitN(id, "--", 2)
+	if len(parts) != 2 || parts[0] != objectType {
+		return &ValidationError{"id", "must start with the object type " + objectType + " followed by --"}
+	}
+	if !uuidPattern.MatchString(parts[1]) {
+		return &ValidationError{"id", "must end with a lowercase RFC 4122 UUID"}
+	}
+
+	// ----------------------------------------------------------------------
+	// Spec Version
+	// ----------------------------------------------------------------------
+	// STIX 2.0 objects do not have a spec_version. Cyber observables without
+	// one are STIX 2.1 objects, as they are only top level objects in 2.1.
+	observable := cyberObservables[objectType]
+	specVersion := "2.1"
+	if _, found := o["spec_version"]; found {
+		v, err := requiredString(o, "spec_version")
+		if err != nil {
+			return err
+		}
+		specVersion = v
+	} else if !observable {
+		specVersion = "2.0"
+	}
+
+	switch specVersion {
+	case "2.1":
+		return validate21(o, objectType)
+	case "2.0":
+		return validate20(o, objectType)
+	}
+	return &ValidationError{"spec_version", "must be 2.0 or 2.1 but is " + specVersion}
+}
+
+/*
+validate20 - This function will check the properties of a STIX 2.0 object
+whose type and identifier were already checked.
+*/
+func validate20(o map[string]interface{}, objectType string) error {
+	if err := requiredTimestamp(o, "created"); err != nil {
+		return err
+	}
+	if objectType != "marking-definition" {
+		if err := requiredTimestamp(o, "modified"); err != nil {
+			return err
+		}
+		if err := timestampOrder(o, "created", "modified"); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range requiredProperties20[objectType] {
+		if v, found := o[p]; !found || v == nil {
+			return &ValidationError{p, "is required for STIX 2.0 " + objectType + " objects"}
+		}
+	}
+
+	switch objectType {
+	case "indicator":
+		if err := requiredTimestamp(o, "valid_from"); err != nil {
+			return err
+		}
+		if _, found := o["valid_until"]; found {
+			if err := timestampOrder(o, "valid_from", "valid_until"); err != nil {
+				return err
+			}
+		}
+	case "observed-data":
+		if err := timestampOrder(o, "first_observed", "last_observed"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+validate21 - This function will check the properties of a STIX 2.1 object
+whose type and identifier were already checked.
+*/
+func validate21(o map[string]interface{}, objectType string) error {
+	observable := cyberObservables[objectType]
+
+	// ----------------------------------------------------------------------
+	// Timestamps
+	// ----------------------------------------------------------------------
+	if !observable {
+		if err := requiredTimestamp(o, "created"); err != nil {
+			return err
+		}
+		if objectType != "marking-definition" {
+			if err := requiredTimestamp(o, "modified"); err != nil {
+				return err
+			}
+			if err := timestampOrder(o, "created", "modified"); err != nil {
+				return err
+			}
+		}
+	}
+
+	// ----------------------------------------------------------------------
+	// Type Specific Properties
+	// ----------------------------------------------------------------------
+	for _, p := range requiredProperties[objectType] {
+		if v, found := o[p]; !found || v == nil {
+			return &ValidationError{p, "is required for " + objectType + " objects"}
+		}
+	}
+
+	switch objectType {
+	case "indicator":
+		if err := requiredTimestamp(o, "valid_from"); err != nil {
+			return err
+		}
+		if _, found := o["valid_until"]; found {
+			if err := timestampOrder(o, "valid_from", "valid_until"); err != nil {
+				return err
+			}
+		}
+	case "observed-data":
+		if err := timestampOrder(o, "first_observed", "last_observed"); err != nil {
+			return err
+		}
+	case "malware":
+		isFamily, ok := o["is_family"].(bool)
+		if !ok {
+			return &ValidationError{"is_family", "must be a boolean"}
+		}
+		if isFamily == true {
+			if _, err := requiredString(o, "name"); err != nil {
+				return &ValidationError{"name", "is required for malware objects that are a family"}
+			}
+		}
+	}
+
+	if _, found := o["confidence"]; found {
+		c, ok := o["confidence"].(float64)
+		if !ok || c < 0 || c > 100 || c != float64(int(c)) {
+			return &ValidationError{"confidence", "must be an integer from 0 to 100"}
+		}
+	}
+
+	// ----------------------------------------------------------------------
+	// Enumerations
+	// ----------------------------------------------------------------------
+	for property, values := range enumerations[objectType] {
+		if err := inVocabulary(o, property, values); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+requiredString - This function will return the value of a property that must
+be a non-empty string.
+*/
+func requiredString(o map[string]interface{}, property string) (string, error) {
+	v, found := o[property]
+	if !found {
+		return "", &ValidationError{property, "is required"}
+	}
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return "", &ValidationError{property, "must be a non-empty string"}
+	}
+	return s, nil
+}
+
+/*
+requiredTimestamp - This function will check that a property is a STIX
+timestamp in UTC.
+*/
+func requiredTimestamp(o map[string]interface{}, property string) error {
+	s, err := requiredString(o, property)
+	if err != nil {
+		return err
+	}
+	if !timestampPattern.MatchString(s) {
+		return &ValidationError{property, "must be a timestamp in the format YYYY-MM-DDTHH:mm:ss[.s+]Z"}
+	}
+	if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+		return &ValidationError{property, "is not a valid timestamp"}
+	}
+	return nil
+}
+
+/*
+timestampOrder - This function will check that the timestamp in the first
+property is not later than the timestamp in the second property.
+*/
+func timestampOrder(o map[string]interface{}, first, second string) error {
+	if err := requiredTimestamp(o, first); err != nil {
+		return err
+	}
+	if err := requiredTimestamp(o, second); err != nil {
+		return err
+	}
+
+	a, _ := time.Parse(time.RFC3339Nano, o[first].(string))
+	b, _ := time.Parse(time.RFC3339Nano, o[second].(string))
+	if a.After(b) {
+		return &ValidationError{second, fmt.Sprintf("must not be earlier than %s (%s)", first, o[first])}
+	}
+	return nil
+}
+
+/*
+inVocabulary - This function will check that the value of a property, or every
+value if the property is a list, is found in the enumeration or vocabulary. A
+property that is not present is not checked.
+*/
+func inVocabulary(o map[string]interface{}, property string, vocabulary []string) error {
+	v, found := o[property]
+	if !found {
+		return nil
+	}
+
+	var values []interface{}
+	if list, ok := v.([]interface{}); ok {
+		values = list
+	} else {
+		values = []interface{}{v}
+	}
+
+	for _, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			return &ValidationError{property, "must only contain strings"}
+		}
+		valid := false
+		for _, allowed := range vocabulary {
+			if s == allowed {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return &ValidationError{property, "has a value of " + s + " that is not in the STIX 2.1 list of values"}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package ingest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// indicator - This function returns a valid indicator with the properties
+// provided replaced, or removed if the value is nil.
+func indicator(changes map[string]interface{}) []byte {
+	o := map[string]interface{}{
+		"type":         "indicator",
+		"spec_version": "2.1",
+		"id":           "indicator--8e2e2d2b-17d4-4cbf-938f-98ee46b3cd3f",
+		"created":      "2018-01-01T00:00:00.000Z",
+		"modified":     "2018-02-01T00:00:00.000Z",
+		"pattern":      "[ipv4-addr:value = '198.51.100.1']",
+		"pattern_type": "stix",
+		"valid_from":   "2018-01-01T00:00:00Z",
+	}
+	for k, v := range changes {
+		if v == nil {
+			delete(o, k)
+		} else {
+			o[k] = v
+		}
+	}
+	data, _ := json.Marshal(o)
+	return data
+}
+
+// opinion - This function returns an opinion with the opinion provided.
+func opinion(value string) []byte {
+	return []byte(`{"type": "opinion", "spec_version": "2.1", "id": "opinion--b01efc25-77b4-4003-b18b-f6e24b5cd9f7", "created": "2018-01-01T00:00:00.000Z", "modified": "2018-01-01T00:00:00.000Z", "opinion": "` + value + `", "object_refs": ["indicator--8e2e2d2b-17d4-4cbf-938f-98ee46b3cd3f"]}`)
+}
+
+// ----------------------------------------------------------------------
+func Test_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		problem string // Empty if the object is valid
+	}{
+		{"valid indicator", indicator(nil), ""},
+		{"valid observable without spec_version", []byte(`{"type": "ipv4-addr", "id": "ipv4-addr--ff26c055-6336-5bc5-b98d-13d6226742dd", "value": "198.51.100.3"}`), ""},
+		{"valid marking without modified", []byte(`{"type": "marking-definition", "spec_version": "2.1", "id": "marking-definition--613f2e26-407d-48c7-9eca-b8e91df99dc9", "created": "2017-01-20T00:00:00.000Z"}`), ""},
+		{"not json", []byte(`{"type": `), "not valid JSON"},
+		{"missing type", indicator(map[string]interface{}{"type": nil}), "property type is required"},
+		{"bad type", indicator(map[string]interface{}{"type": "Indicator"}), "property type must be"},
+		{"id of another type", indicator(map[string]interface{}{"id": "malware--8e2e2d2b-17d4-4cbf-938f-98ee46b3cd3f"}), "property id must start with the object type indicator"},
+		{"id without uuid", indicator(map[string]interface{}{"id": "indicator--1234"}), "property id must end with"},
+		{"2.1 indicator without spec_version", indicator(map[string]interface{}{"spec_version": nil}), "property labels is required for STIX 2.0 indicator objects"},
+		{"valid 2.0 indicator", indicator(map[string]interface{}{"spec_version": nil, "pattern_type": nil, "labels": []string{"malicious-activity"}}), ""},
+		{"2.0 malware without name", []byte(`{"type": "malware", "id": "malware--0c7b5b88-8ff7-4a4d-aa9d-feb398cd0061", "created": "2018-01-01T00:00:00.000Z", "modified": "2018-01-01T00:00:00.000Z", "labels": ["worm"]}`), "property name is required for STIX 2.0 malware"},
+		{"unknown spec_version", indicator(map[string]interface{}{"spec_version": "2.2"}), "property spec_version must be 2.0 or 2.1 but is 2.2"},
+		{"empty spec_version", indicator(map[string]interface{}{"spec_version": ""}), "property spec_version must be a non-empty string"},
+		{"missing modified", indicator(map[string]interface{}{"modified": nil}), "property modified is required"},
+		{"bad timestamp", indicator(map[string]interface{}{"created": "2018-01-01 00:00:00"}), "property created must be a timestamp"},
+		{"modified before created", indicator(map[string]interface{}{"modified": "2017-01-01T00:00:00.000Z"}), "property modified must not be earlier than created"},
+		{"valid_until before valid_from", indicator(map[string]interface{}{"valid_until": "2017-01-01T00:00:00Z"}), "property valid_until must not be earlier than valid_from"},
+		{"missing pattern", indicator(map[string]interface{}{"pattern": nil}), "property pattern is required for indicator objects"},
+		{"open vocabulary", indicator(map[string]interface{}{"pattern_type": "regex"}), ""},
+		{"open vocabulary in list", indicator(map[string]interface{}{"indicator_types": []string{"benign", "evil"}}), ""},
+		{"valid enumeration", opinion("agree"), ""},
+		{"bad enumeration", opinion("maybe"), "property opinion has a value of maybe"},
+		{"bad confidence", indicator(map[string]interface{}{"confidence": 101}), "property confidence must be an integer"},
+		{"malware family without name", []byte(`{"type": "malware", "spec_version": "2.1", "id": "malware--0c7b5b88-8ff7-4a4d-aa9d-feb398cd0061", "created": "2018-01-01T00:00:00.000Z", "modified": "2018-01-01T00:00:00.000Z", "is_family": true}`), "property name is required for malware"},
+	}
+
+	for _, tt := range tests {
+		_, _, err := Validate(tt.data)
+		if tt.problem == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if tt.problem != "" && (err == nil || !strings.Contains(err.Error(), tt.problem)) {
+			t.Errorf("%s: got error %v want %q", tt.name, err, tt.problem)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_ValidateReturnsVersion(t *testing.T) {
+	id, version, err := Validate(indicator(map[string]interface{}{"spec_version": "2.2"}))
+	if err == nil {
+		t.Fatal("expected an error for spec_version 2.2")
+	}
+	if id != "indicator--8e2e2d2b-17d4-4cbf-938f-98ee46b3cd3f" || version != "2018-02-01T00:00:00.000Z" {
+		t.Errorf("wrong id or version for a failed object: %s %s", id, version)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Warnings(t *testing.T) {
+	if w := Warnings(indicator(nil)); len(w) != 0 {
+		t.Errorf("unexpected warnings for a valid indicator: %v", w)
+	}
+
+	w := Warnings(indicator(map[string]interface{}{"pattern_type": "regex", "indicator_types": []string{"benign", "evil"}}))
+	if len(w) != 2 || !strings.Contains(w[0], "indicator_types has a value of evil") || !strings.Contains(w[1], "pattern_type has a value of regex") {
+		t.Errorf("wrong warnings: %v", w)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_SpecVersion(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{indicator(nil), "2.1"},
+		{indicator(map[string]interface{}{"spec_version": nil}), "2.0"},
+		{[]byte(`{"type": "ipv4-addr", "value": "198.51.100.3"}`), "2.1"},
+	}
+
+	for _, tt := range tests {
+		if got := SpecVersion(tt.data); got != tt.want {
+			t.Errorf("SpecVersion(%s) = %s want %s", tt.data, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package ingest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/freetaxii/libstix2/resources/envelope"
+	"github.com/freetaxii/libstix2/resources/status"
+	"github.com/gologme/log"
+)
+
+// These are the sub directories of a watched directory that processed files
+// are moved in to.
+const (
+	DoneDir   = "done"
+	FailedDir = "failed"
+)
+
+// reportSuffix - The suffix of the status report that is written next to
+// each processed file.
+const reportSuffix = ".status.json"
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Watcher - This type holds the settings for watching a single directory for
+STIX bundle and envelope files. Files should be written to the directory with
+an atomic rename, files that start with a "." are ignored. A file that is
+written in place is only read once its size and modification time have not
+changed since the previous scan, or it was last modified more than one interval
+ago, so that a file the producer is still writing is not read half written.
+
+Directory - The full path of the directory to watch
+Interval  - How often the directory is checked for new files
+*/
+type Watcher struct {
+	Logger    *log.Logger
+	Directory string
+	Interval  time.Duration
+	Ingester  *Ingester
+	seen      map[string]fileState
+}
+
+/*
+fileState - This type records the size and modification time of a file when it
+was last scanned.
+*/
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+/*
+Report - This type defines the status report that is written next to each
+processed file.
+*/
+type Report struct {
+	File      string         `json:"file"`
+	Processed string         `json:"processed"`
+	Error     string         `json:"error,omitempty"`
+	Status    *status.Status `json:"status,omitempty"`
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+NewWatcher - This function will create a new Watcher for a directory that will
+add the objects it finds using the Ingester provided.
+*/
+func NewWatcher(logger *log.Logger, directory string, interval time.Duration, in *Ingester) *Watcher {
+	var w Watcher
+
+	if logger == nil {
+		w.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	} else {
+		w.Logger = logger
+	}
+
+	w.Directory = directory
+	w.Interval = interval
+	w.Ingester = in
+	w.seen = make(map[string]fileState)
+	return &w
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Watcher
+// ----------------------------------------------------------------------
+
+/*
+Run - This method will check the directory for new files at every interval
+until the stop channel is closed.
+*/
+func (w *Watcher) Run(stop <-chan struct{}) {
+	w.Logger.Infoln("INFO: Watching directory", w.Directory, "for collection", w.Ingester.CollectionID)
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Scan(); err != nil {
+			w.Logger.Errorln("ERROR: Unable to scan ingest directory", w.Directory, err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			w.Logger.Infoln("INFO: Stopping watch of directory", w.Directory)
+			return
+		}
+	}
+}
+
+/*
+Scan - This method will ingest every JSON file that is currently found in the
+directory and is no longer being written.
+*/
+func (w *Watcher) Scan() error {
+	for _, d := range []string{DoneDir, FailedDir} {
+		if err := os.MkdirAll(filepath.Join(w.Directory, d), 0755); err != nil {
+			return err
+		}
+	}
+
+	files, err := ioutil.ReadDir(w.Directory)
+	if err != nil {
+		return err
+	}
+
+	if w.seen == nil {
+		w.seen = make(map[string]fileState)
+	}
+
+	seen := make(map[string]fileState)
+	for _, f := range files {
+		name := f.Name()
+		if !f.Mode().IsRegular() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		current := fileState{size: f.Size(), modTime: f.ModTime()}
+		if w.seen[name] != current && time.Since(current.modTime) < w.Interval {
+			w.Logger.Debugln("DEBUG: Waiting for file", name, "in ingest directory", w.Directory, "to stop changing")
+			seen[name] = current
+			continue
+		}
+		w.processFile(name)
+	}
+
+	// Only the files that are still waiting are kept, so a new file with the
+	// name of one that was processed is checked again
+	w.seen = seen
+	return nil
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - Watcher
+// ----------------------------------------------------------------------
+
+/*
+processFile - This method will ingest a single file and then move it and its
+status report to the done or failed sub directory.
+*/
+func (w *Watcher) processFile(name string) {
+	w.Logger.Infoln("INFO: Found file", name, "in ingest directory", w.Directory)
+
+	var report Report
+	report.File = name
+
+	statusMessage := status.New()
+	statusMessage.SetNewID()
+	statusMessage.SetStatusCompleted()
+	statusMessage.SetRequestTimestampToCurrentTime()
+
+	// A bundle and an envelope both carry their content in an objects array,
+	// so the same decode works for both.
+	failed := false
+	f, err := os.Open(filepath.Join(w.Directory, name))
+	if err != nil {
+		report.Error = err.Error()
+		failed = true
+	} else {
+		e, err := envelope.DecodeRaw(f)
+		f.Close()
+
+		if err != nil {
+			w.Logger.Errorln("ERROR: Could not decode file", name, err)
+			report.Error = "unable to decode bundle or envelope: " + err.Error()
+			failed = true
+		} else {
+			c := w.Ingester.Ingest(e.Objects, statusMessage)
+			report.Status = statusMessage
+			failed = c.Failure > 0
+			w.Logger.Infoln("INFO: Ingested", c.Success, "of", c.Total, "objects from file", name, "in to collection", w.Ingester.CollectionID)
+		}
+	}
+	report.Processed = time.Now().UTC().Format(time.RFC3339Nano)
+
+	dest := DoneDir
+	if failed {
+		dest = FailedDir
+	}
+
+	target := w.target(dest, name)
+	if err := os.Rename(filepath.Join(w.Directory, name), target); err != nil {
+		// If the file can not be moved it would be ingested again on the
+		// next scan, so stop here and make it very visible.
+		w.Logger.Errorln("ERROR: Unable to move file", name, "to", target, err)
+		return
+	}
+
+	data, _ := json.MarshalIndent(report, "", "    ")
+	if err := ioutil.WriteFile(target+reportSuffix, data, 0644); err != nil {
+		w.Logger.Errorln("ERROR: Unable to write status report for file", name, err)
+	}
+}
+
+/*
+target - This method will return the path that a processed file is moved to,
+making sure that it does not overwrite an earlier file with the same name.
+*/
+func (w *Watcher) target(dest, name string) string {
+	target := filepath.Join(w.Directory, dest, name)
+	if _, err := os.Stat(target); err == nil {
+		ext := filepath.Ext(name)
+		target = filepath.Join(w.Directory, dest, strings.TrimSuffix(name, ext)+"-"+strconv.FormatInt(time.Now().UnixNano(), 10)+ext)
+	}
+	return target
+}
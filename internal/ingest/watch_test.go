@@ -0,0 +1,100 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package ingest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/freetaxii/server/internal/storetest"
+)
+
+// ----------------------------------------------------------------------
+func Test_WatcherScan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freetaxii-ingest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"empty.json":    `{"type": "bundle", "id": "bundle--1", "objects": []}`,
+		"broken.json":   `{"objects": [`,
+		".partial.json": `{"objects": []}`,
+		"notes.txt":     `not a bundle`,
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The files were just written, so they are only read once they have not
+	// changed since the previous scan
+	w := NewWatcher(storetest.Logger(), dir, time.Minute, New(storetest.Logger(), storetest.New(), "1234"))
+	if err := w.Scan(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "empty.json")); err != nil {
+		t.Errorf("a new file was read on the first scan: %v", err)
+	}
+
+	if err := w.Scan(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		filepath.Join(dir, DoneDir, "empty.json"),
+		filepath.Join(dir, DoneDir, "empty.json"+reportSuffix),
+		filepath.Join(dir, FailedDir, "broken.json"),
+		filepath.Join(dir, FailedDir, "broken.json"+reportSuffix),
+		filepath.Join(dir, ".partial.json"),
+		filepath.Join(dir, "notes.txt"),
+	}
+	for _, f := range expected {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("expected file %s is missing", f)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_WatcherPartialFile(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWatcher(storetest.Logger(), dir, time.Minute, New(storetest.Logger(), storetest.New(), "1234"))
+
+	// The producer is still writing the file during the first two scans
+	file := filepath.Join(dir, "bundle.json")
+	ioutil.WriteFile(file, []byte(`{"type": "bundle", "id": "bundle--1", `), 0644)
+	w.Scan()
+	ioutil.WriteFile(file, []byte(`{"type": "bundle", "id": "bundle--1", "objects": []}`), 0644)
+	w.Scan()
+
+	if _, err := os.Stat(file); err != nil {
+		t.Fatalf("a file that was still changing was read: %v", err)
+	}
+
+	w.Scan()
+	if _, err := os.Stat(filepath.Join(dir, DoneDir, "bundle.json")); err != nil {
+		t.Errorf("the finished file was not read: %v", err)
+	}
+
+	// A file that was last changed more than one interval ago is read right
+	// away, like the files that are found when the server starts
+	old := filepath.Join(dir, "old.json")
+	ioutil.WriteFile(old, []byte(`{"type": "bundle", "id": "bundle--2", "objects": []}`), 0644)
+	then := time.Now().Add(-time.Hour)
+	os.Chtimes(old, then, then)
+
+	w = NewWatcher(storetest.Logger(), dir, time.Minute, New(storetest.Logger(), storetest.New(), "1234"))
+	w.Scan()
+	if _, err := os.Stat(filepath.Join(dir, DoneDir, "old.json")); err != nil {
+		t.Errorf("an old file was not read on the first scan: %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package markings enforces the data marking policy of a collection. A policy
+lists the marking definitions, like the TLP markings, that objects in the
+collection may carry and the markings that are added to unmarked objects when
+they are ingested. Objects with any other marking are rejected when they are
+added and are never returned to a client.
+*/
+package markings
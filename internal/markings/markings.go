@@ -0,0 +1,270 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package markings
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/freetaxii/libstix2/datastore"
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/libstix2/resources/manifest"
+	"github.com/freetaxii/server/internal/envelopes"
+)
+
+// TLP - The marking-definition ids of the STIX 2.1 TLP markings, by name.
+var TLP = map[string]string{
+	"tlp:white": "marking-definition--613f2e26-407d-48c7-9eca-b8e91df99dc9",
+	"tlp:green": "marking-definition--34098fce-860f-48ae-8e50-ebd3cc5e41da",
+	"tlp:amber": "marking-definition--f88d31f6-486f-44da-b317-01333bde0b82",
+	"tlp:red":   "marking-definition--5e57c739-391a-4eb3-b6be-7d15ca92d5ed",
+}
+
+// idPattern - The format of a marking-definition identifier.
+var idPattern = regexp.MustCompile(`^marking-definition--[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Policy - This type defines the markings that objects may carry and the
+markings that are added to objects that do not have any.
+
+Any     - Objects with any marking are allowed
+Allowed - The marking-definition ids objects may carry when Any is false
+Default - The marking-definition ids added to unmarked objects on ingest
+*/
+type Policy struct {
+	Any     bool
+	Allowed map[string]bool
+	Default []string
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+New - This function will create a new Policy. An empty list of allowed
+markings allows any marking. The markings are expected to be marking-definition
+ids, see ID.
+*/
+func New(allowed, defaults []string) *Policy {
+	var p Policy
+
+	p.Any = len(allowed) == 0
+	p.Allowed = make(map[string]bool)
+	for _, v := range allowed {
+		p.Allowed[v] = true
+	}
+	p.Default = defaults
+	return &p
+}
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+ID - This function will return the marking-definition id for a TLP name, like
+tlp:red, or for a marking-definition id. False is returned if the value is
+neither.
+*/
+func ID(name string) (string, bool) {
+	if id, found := TLP[strings.ToLower(name)]; found {
+		return id, true
+	}
+	if idPattern.MatchString(name) {
+		return name, true
+	}
+	return "", false
+}
+
+/*
+Refs - This function will return the marking-definition ids that the raw JSON
+of an object refers to in object_marking_refs and granular_markings.
+*/
+func Refs(data []byte) []string {
+	var o struct {
+		ObjectMarkingRefs []string `json:"object_marking_refs"`
+		GranularMarkings  []struct {
+			MarkingRef string `json:"marking_ref"`
+		} `json:"granular_markings"`
+	}
+	json.Unmarshal(data, &o)
+
+	refs := o.ObjectMarkingRefs
+	for _, g := range o.GranularMarkings {
+		if g.MarkingRef != "" {
+			refs = append(refs, g.MarkingRef)
+		}
+	}
+	return refs
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Policy
+// ----------------------------------------------------------------------
+
+/*
+Allows - This method will return true if every one of the markings is allowed.
+Unmarked objects are always allowed.
+*/
+func (p *Policy) Allows(refs []string) bool {
+	if p == nil || p.Any == true {
+		return true
+	}
+	for _, v := range refs {
+		if p.Allowed[v] == false {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Disallowed - This method will return the markings that are not allowed.
+*/
+func (p *Policy) Disallowed(refs []string) []string {
+	var result []string
+	if p == nil || p.Any == true {
+		return result
+	}
+	for _, v := range refs {
+		if p.Allowed[v] == false {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+/*
+ApplyDefault - This method will add the default markings to the raw JSON of an
+object that does not have any object_marking_refs. Marking definitions are
+never marked. The object is returned unchanged if there is nothing to add.
+*/
+func (p *Policy) ApplyDefault(data []byte) []byte {
+	if p == nil || len(p.Default) == 0 {
+		return data
+	}
+
+	var o map[string]json.RawMessage
+	if err := json.Unmarshal(data, &o); err != nil {
+		return data
+	}
+	if _, found := o["object_marking_refs"]; found {
+		return data
+	}
+
+	var objectType string
+	json.Unmarshal(o["type"], &objectType)
+	if objectType == "marking-definition" {
+		return data
+	}
+
+	refs, _ := json.Marshal(p.Default)
+	o["object_marking_refs"] = refs
+
+	result, err := json.Marshal(o)
+	if err != nil {
+		return data
+	}
+	return result
+}
+
+/*
+Filter - This method will return only the objects from the datastore whose
+markings are allowed.
+*/
+func (p *Policy) Filter(objects []interface{}) []interface{} {
+	if p == nil || p.Any == true {
+		return objects
+	}
+
+	result := make([]interface{}, 0, len(objects))
+	for _, o := range objects {
+		if p.allowsObject(o) {
+			result = append(result, o)
+		}
+	}
+	return result
+}
+
+/*
+FilterManifest - This method will return only the manifest records whose
+object versions have markings that are allowed. Manifest records do not carry
+the markings of the object, so the versions of the records are read from the
+collection of the query.
+*/
+func (p *Policy) FilterManifest(ds datastore.Datastorer, q collections.CollectionQuery, records []manifest.ManifestRecord) []manifest.ManifestRecord {
+	if p == nil || p.Any == true || len(records) == 0 {
+		return records
+	}
+
+	ids, versions := envelopes.RecordKeys(records)
+	allowed := p.allowedVersions(ds, q.CollectionID, ids, versions)
+
+	result := make([]manifest.ManifestRecord, 0, len(records))
+	for _, r := range records {
+		if allowed[r.ID+"|"+r.Version] == true {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+/*
+FilterVersions - This method will return only the versions of an object whose
+markings are allowed. The query must be for the single object.
+*/
+func (p *Policy) FilterVersions(ds datastore.Datastorer, q collections.CollectionQuery, versions []string) []string {
+	if p == nil || p.Any == true || len(versions) == 0 || len(q.STIXID) == 0 {
+		return versions
+	}
+
+	allowed := p.allowedVersions(ds, q.CollectionID, q.STIXID[:1], versions)
+
+	result := make([]string, 0, len(versions))
+	for _, v := range versions {
+		if allowed[q.STIXID[0]+"|"+v] == true {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - Policy
+// ----------------------------------------------------------------------
+
+/*
+allowsObject - This method will return true if the markings of an object from
+the datastore are allowed.
+*/
+func (p *Policy) allowsObject(o interface{}) bool {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return false
+	}
+	return p.Allows(Refs(data))
+}
+
+/*
+allowedVersions - This method will read the versions provided of the objects
+with the ids provided from a collection and return the id and version, joined
+with a "|", of each one that is allowed.
+*/
+func (p *Policy) allowedVersions(ds datastore.Datastorer, collectionID string, ids, versions []string) map[string]bool {
+	allowed := make(map[string]bool)
+	envelopes.EachVersion(ds, collectionID, ids, versions, func(key string, o interface{}) {
+		if p.allowsObject(o) {
+			allowed[key] = true
+		}
+	})
+	return allowed
+}
@@ -0,0 +1,124 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package markings
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/libstix2/resources/manifest"
+	"github.com/freetaxii/server/internal/storetest"
+)
+
+var (
+	green = TLP["tlp:green"]
+	amber = TLP["tlp:amber"]
+	red   = TLP["tlp:red"]
+)
+
+// marked - This function returns the raw JSON of an indicator version with
+// the markings provided.
+func marked(modified string, refs ...string) json.RawMessage {
+	o := map[string]interface{}{
+		"type":     "indicator",
+		"id":       "indicator--8e2e2d2b-17d4-4cbf-938f-98ee46b3cd3f",
+		"created":  "2018-01-01T00:00:00.000Z",
+		"modified": modified,
+	}
+	if len(refs) > 0 {
+		o["object_marking_refs"] = refs
+	}
+	data, _ := json.Marshal(o)
+	return data
+}
+
+// ----------------------------------------------------------------------
+func Test_ID(t *testing.T) {
+	if id, ok := ID("TLP:RED"); !ok || id != red {
+		t.Errorf("TLP name not found: %s", id)
+	}
+	if id, ok := ID(green); !ok || id != green {
+		t.Errorf("marking-definition id not accepted: %s", id)
+	}
+	if _, ok := ID("tlp:clear-ish"); ok {
+		t.Error("unknown marking accepted")
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_PolicyAllows(t *testing.T) {
+	p := New([]string{green, amber}, nil)
+
+	if !p.Allows([]string{green, amber}) || p.Allows([]string{red}) || !p.Allows(nil) {
+		t.Error("collection policy is wrong")
+	}
+
+	var none *Policy
+	if !none.Allows([]string{red}) {
+		t.Error("a nil policy should allow everything")
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_ApplyDefault(t *testing.T) {
+	p := New(nil, []string{green})
+
+	refs := Refs(p.ApplyDefault(marked("2018-01-01T00:00:00.000Z")))
+	if len(refs) != 1 || refs[0] != green {
+		t.Errorf("default marking not applied: %v", refs)
+	}
+
+	refs = Refs(p.ApplyDefault(marked("2018-01-01T00:00:00.000Z", amber)))
+	if len(refs) != 1 || refs[0] != amber {
+		t.Errorf("existing marking replaced: %v", refs)
+	}
+
+	definition := []byte(`{"type": "marking-definition", "id": "` + red + `"}`)
+	if string(p.ApplyDefault(definition)) != string(definition) {
+		t.Error("marking definitions should never be marked")
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Filter(t *testing.T) {
+	p := New([]string{green}, nil)
+
+	objects := []interface{}{
+		marked("2018-01-01T00:00:00.000Z", green),
+		marked("2018-02-01T00:00:00.000Z", red),
+		marked("2018-03-01T00:00:00.000Z"),
+	}
+	ds := storetest.New()
+	for _, o := range objects {
+		ds.Add("1234", "2018-04-01T00:00:00.000000Z", string(o.(json.RawMessage)))
+	}
+
+	if got := p.Filter(objects); len(got) != 2 {
+		t.Errorf("wrong number of objects: got %d want 2", len(got))
+	}
+
+	id := "indicator--8e2e2d2b-17d4-4cbf-938f-98ee46b3cd3f"
+	records := []manifest.ManifestRecord{
+		{ID: id, Version: "2018-01-01T00:00:00.000Z"},
+		{ID: id, Version: "2018-02-01T00:00:00.000Z"},
+		{ID: id, Version: "2018-03-01T00:00:00.000Z"},
+	}
+	// The records may be from any page of a query, so the query itself does
+	// not decide which objects are read
+	q := collections.NewCollectionQuery("1234", 10)
+	q.Limit = []string{"1"}
+	q.AddedAfter = []string{"2018-05-01T00:00:00.000000Z"}
+	if got := p.FilterManifest(ds, *q, records); len(got) != 2 || got[1].Version != "2018-03-01T00:00:00.000Z" {
+		t.Errorf("wrong manifest records: %+v", got)
+	}
+
+	q.STIXID = []string{id}
+	versions := []string{"2018-01-01T00:00:00.000Z", "2018-02-01T00:00:00.000Z", "2018-03-01T00:00:00.000Z"}
+	if got := p.FilterVersions(ds, *q, versions); len(got) != 2 || got[0] != versions[0] {
+		t.Errorf("wrong versions: %v", got)
+	}
+}
@@ -0,0 +1,14 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package retention enforces the retention policy of each collection. A
+background job periodically removes objects that were added to a collection
+before the maximum age, indicators whose valid_until is in the past, and old
+versions of objects beyond the number of versions that should be kept. The
+versions of an object are removed from the datastore once no collection lists
+the object, so the database does not keep growing.
+*/
+package retention
@@ -0,0 +1,334 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package retention
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/freetaxii/libstix2/datastore"
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/server/internal/config"
+	"github.com/freetaxii/server/internal/envelopes"
+	"github.com/gologme/log"
+)
+
+// DateAddedFormat - The format of the date_added values in the datastore
+const DateAddedFormat = "2006-01-02T15:04:05.000000Z"
+
+// pageSize - The number of records that are read from the datastore at a time
+const pageSize = 500
+
+// ErrVersionShared - Returned by a Purger when an object version can not be
+// removed because the object is also found in another collection.
+var ErrVersionShared = errors.New("object is shared with another collection")
+
+// metrics - The counters for everything the retention job has removed, these
+// are published with the rest of the server metrics.
+var metrics = expvar.NewMap("retention")
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Purger - This interface defines the datastore operations that are needed to
+remove content from a collection. Each method returns the number of records
+that were removed.
+*/
+type Purger interface {
+	PurgeOlderThan(collectionID, dateAdded string) (int, error)
+	PurgeObject(collectionID, stixID string) (int, error)
+	PurgeVersion(collectionID, stixID, version string) (int, error)
+}
+
+/*
+Stats - This type records what was removed from a single collection in a
+single run of the retention job.
+*/
+type Stats struct {
+	MaxAge   int
+	Expired  int
+	Versions int
+	Skipped  int
+}
+
+/*
+Job - This type holds everything the retention job needs. The policies are
+keyed by collection ID.
+*/
+type Job struct {
+	Logger   *log.Logger
+	DS       datastore.Datastorer
+	Purger   Purger
+	Interval time.Duration
+	Policies map[string]config.RetentionPolicy
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+New - This function will create a new retention job for every collection
+resource in the configuration that has an enabled retention policy.
+*/
+func New(logger *log.Logger, ds datastore.Datastorer, p Purger, c config.ServerConfig) *Job {
+	var j Job
+
+	if logger == nil {
+		j.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	} else {
+		j.Logger = logger
+	}
+
+	j.DS = ds
+	j.Purger = p
+	j.Interval = c.Retention.IntervalDuration
+	j.Policies = make(map[string]config.RetentionPolicy)
+
+	for _, value := range c.CollectionResources {
+		if value.Retention.Enabled == true {
+			j.Policies[value.ID] = value.Retention
+		}
+	}
+	return &j
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Job
+// ----------------------------------------------------------------------
+
+/*
+Run - This method will enforce the retention policies once right away and then
+again at every interval until the stop channel is closed.
+*/
+func (j *Job) Run(stop <-chan struct{}) {
+	j.Logger.Infoln("INFO: Starting retention job for", len(j.Policies), "collection(s) every", j.Interval)
+	j.RunOnce()
+
+	ticker := time.NewTicker(j.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			j.RunOnce()
+		case <-stop:
+			j.Logger.Infoln("INFO: Stopping retention job")
+			return
+		}
+	}
+}
+
+/*
+RunOnce - This method will enforce the retention policy of every collection a
+single time and log what was removed.
+*/
+func (j *Job) RunOnce() {
+	metrics.Add("runs", 1)
+
+	for collectionID, p := range j.Policies {
+		stats, err := j.Enforce(collectionID, p, time.Now().UTC())
+		if err != nil {
+			j.Logger.Errorln("ERROR: Retention policy for collection", collectionID, "failed:", err)
+			metrics.Add("errors", 1)
+		}
+
+		j.Logger.Infoln("INFO: Retention for collection", collectionID, "removed", stats.MaxAge, "aged,", stats.Expired, "expired indicator(s), and", stats.Versions, "old version(s),", stats.Skipped, "skipped")
+
+		metrics.Add(collectionID+".maxage", int64(stats.MaxAge))
+		metrics.Add(collectionID+".expired", int64(stats.Expired))
+		metrics.Add(collectionID+".versions", int64(stats.Versions))
+		metrics.Add(collectionID+".skipped", int64(stats.Skipped))
+	}
+}
+
+/*
+Enforce - This method will enforce a retention policy on a single collection
+as of the time provided.
+*/
+func (j *Job) Enforce(collectionID string, p config.RetentionPolicy, now time.Time) (Stats, error) {
+	var stats Stats
+
+	if p.MaxAgeDuration > 0 {
+		cutoff := now.Add(-p.MaxAgeDuration).Format(DateAddedFormat)
+		j.Logger.Debugln("DEBUG: Removing objects added to collection", collectionID, "before", cutoff)
+
+		n, err := j.Purger.PurgeOlderThan(collectionID, cutoff)
+		stats.MaxAge += n
+		if err != nil {
+			return stats, fmt.Errorf("unable to remove aged objects: %v", err)
+		}
+	}
+
+	if p.DropExpiredIndicators == true {
+		ids, err := j.expiredIndicators(collectionID, now)
+		if err != nil {
+			return stats, err
+		}
+
+		for _, id := range ids {
+			j.Logger.Debugln("DEBUG: Removing expired indicator", id, "from collection", collectionID)
+			n, err := j.Purger.PurgeObject(collectionID, id)
+			stats.Expired += n
+			if err != nil {
+				return stats, fmt.Errorf("unable to remove expired indicator %s: %v", id, err)
+			}
+		}
+	}
+
+	if p.MaxVersions > 0 {
+		old, err := j.oldVersions(collectionID, p.MaxVersions)
+		if err != nil {
+			return stats, err
+		}
+
+		for id, versions := range old {
+			for _, v := range versions {
+				j.Logger.Debugln("DEBUG: Removing version", v, "of", id, "from collection", collectionID)
+				n, err := j.Purger.PurgeVersion(collectionID, id, v)
+				if err == ErrVersionShared {
+					j.Logger.Infoln("INFO: Keeping version", v, "of", id, "since it is shared with another collection")
+					stats.Skipped++
+					continue
+				}
+				stats.Versions += n
+				if err != nil {
+					return stats, fmt.Errorf("unable to remove version %s of %s: %v", v, id, err)
+				}
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - Job
+// ----------------------------------------------------------------------
+
+/*
+expiredIndicators - This method will return the IDs of the indicators in a
+collection whose latest version has a valid_until in the past.
+*/
+func (j *Job) expiredIndicators(collectionID string, now time.Time) ([]string, error) {
+	var ids []string
+
+	q := collections.NewCollectionQuery(collectionID, pageSize)
+	q.STIXType = []string{"indicator"}
+
+	// The datastore returns an error when no records are found, so an error
+	// is only reported if it is not for the first page
+	var boundary envelopes.Boundary
+	for {
+		q.ServerRecordLimit = boundary.Limit(pageSize)
+		results, err := j.DS.GetObjects(*q)
+		if err != nil && boundary.DateAdded == "" {
+			j.Logger.Debugln("DEBUG: No indicators found in collection", collectionID, err)
+			return ids, nil
+		} else if err != nil {
+			return ids, fmt.Errorf("unable to read indicators: %v", err)
+		}
+
+		for _, o := range results.ObjectData.Objects {
+			if !boundary.Add(envelopes.Key(o)) {
+				continue
+			}
+
+			data, err := json.Marshal(o)
+			if err != nil {
+				continue
+			}
+
+			var i struct {
+				ID         string `json:"id"`
+				ValidUntil string `json:"valid_until"`
+			}
+			json.Unmarshal(data, &i)
+
+			if i.ValidUntil == "" {
+				continue
+			}
+
+			t, err := time.Parse(time.RFC3339Nano, i.ValidUntil)
+			if err != nil {
+				j.Logger.Warnln("WARN: Indicator", i.ID, "has an invalid valid_until of", i.ValidUntil)
+				continue
+			}
+
+			if t.Before(now) {
+				ids = append(ids, i.ID)
+			}
+		}
+
+		if results.ObjectData.More == false || results.DateAddedLast == "" {
+			break
+		}
+		boundary.Advance(q, results.DateAddedLast)
+	}
+	return ids, nil
+}
+
+/*
+oldVersions - This method will return the versions of each object in a
+collection that are beyond the number of versions that should be kept, keyed
+by object ID.
+*/
+func (j *Job) oldVersions(collectionID string, keep int) (map[string][]string, error) {
+	all := make(map[string][]string)
+
+	q := collections.NewCollectionQuery(collectionID, pageSize)
+	q.STIXVersion = []string{"all"}
+
+	var boundary envelopes.Boundary
+	for {
+		q.ServerRecordLimit = boundary.Limit(pageSize)
+		results, err := j.DS.GetManifestData(*q)
+		if err != nil && boundary.DateAdded == "" {
+			j.Logger.Debugln("DEBUG: No objects found in collection", collectionID, err)
+			return nil, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read manifest: %v", err)
+		}
+
+		for _, m := range results.ManifestData.Objects {
+			if boundary.Add(m.ID + "|" + m.Version) {
+				all[m.ID] = append(all[m.ID], m.Version)
+			}
+		}
+
+		if results.ManifestData.More == false || results.DateAddedLast == "" {
+			break
+		}
+		boundary.Advance(q, results.DateAddedLast)
+	}
+
+	old := make(map[string][]string)
+	for id, versions := range all {
+		if len(versions) <= keep {
+			continue
+		}
+
+		// Sort oldest to newest, timestamps can have different precision so
+		// compare them as times and not as strings
+		sort.Slice(versions, func(a, b int) bool {
+			ta, errA := time.Parse(time.RFC3339Nano, versions[a])
+			tb, errB := time.Parse(time.RFC3339Nano, versions[b])
+			if errA != nil || errB != nil {
+				return versions[a] < versions[b]
+			}
+			return ta.Before(tb)
+		})
+		old[id] = versions[:len(versions)-keep]
+	}
+	return old, nil
+}
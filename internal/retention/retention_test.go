@@ -0,0 +1,196 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package retention
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/freetaxii/server/internal/config"
+	"github.com/freetaxii/server/internal/storetest"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// content - This function returns a datastore with three indicators, one of
+// them expired, three versions of malware--1, and one of malware--2.
+func content() *storetest.Store {
+	ds := storetest.New()
+	ds.Add("1234", "2018-02-01T00:00:00.000000Z",
+		`{"id": "indicator--1", "modified": "2017-01-01T00:00:00.000Z", "valid_until": "2018-01-01T00:00:00Z"}`,
+		`{"id": "indicator--2", "modified": "2017-01-01T00:00:00.000Z", "valid_until": "2030-01-01T00:00:00Z"}`,
+		`{"id": "indicator--3", "modified": "2017-01-01T00:00:00.000Z"}`,
+		`{"id": "malware--1", "modified": "2018-01-03T00:00:00.000Z"}`,
+		`{"id": "malware--1", "modified": "2018-01-01T00:00:00Z"}`,
+		`{"id": "malware--1", "modified": "2018-01-02T00:00:00.000Z"}`,
+		`{"id": "malware--2", "modified": "2018-01-01T00:00:00.000Z"}`,
+	)
+	return ds
+}
+
+type dummyPurger struct {
+	cutoff   string
+	objects  []string
+	versions []string
+}
+
+func (p *dummyPurger) PurgeOlderThan(collectionID, dateAdded string) (int, error) {
+	p.cutoff = dateAdded
+	return 4, nil
+}
+
+func (p *dummyPurger) PurgeObject(collectionID, stixID string) (int, error) {
+	p.objects = append(p.objects, stixID)
+	return 1, nil
+}
+
+func (p *dummyPurger) PurgeVersion(collectionID, stixID, version string) (int, error) {
+	p.versions = append(p.versions, stixID+"|"+version)
+	return 1, nil
+}
+
+// ----------------------------------------------------------------------
+func Test_Enforce(t *testing.T) {
+	p := &dummyPurger{}
+	j := New(storetest.Logger(), content(), p, config.ServerConfig{})
+
+	policy := config.RetentionPolicy{
+		Enabled:               true,
+		MaxAgeDuration:        24 * time.Hour,
+		DropExpiredIndicators: true,
+		MaxVersions:           1,
+	}
+
+	now := time.Date(2018, 6, 2, 12, 0, 0, 0, time.UTC)
+	stats, err := j.Enforce("1234", policy, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if p.cutoff != "2018-06-01T12:00:00.000000Z" {
+		t.Errorf("wrong cutoff for max age: got %s", p.cutoff)
+	}
+
+	if len(p.objects) != 1 || p.objects[0] != "indicator--1" {
+		t.Errorf("wrong expired indicators removed: got %v", p.objects)
+	}
+
+	// The two oldest versions of malware--1 should be removed, and nothing
+	// from malware--2 since it only has one version.
+	if len(p.versions) != 2 || p.versions[0] != "malware--1|2018-01-01T00:00:00Z" || p.versions[1] != "malware--1|2018-01-02T00:00:00.000Z" {
+		t.Errorf("wrong versions removed: got %v", p.versions)
+	}
+
+	if stats.MaxAge != 4 || stats.Expired != 1 || stats.Versions != 2 {
+		t.Errorf("wrong stats: got %+v", stats)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_EnforceEmpty(t *testing.T) {
+	p := &dummyPurger{}
+	j := New(storetest.Logger(), storetest.New(), p, config.ServerConfig{})
+
+	policy := config.RetentionPolicy{Enabled: true, DropExpiredIndicators: true, MaxVersions: 1}
+	if _, err := j.Enforce("1234", policy, time.Now()); err != nil {
+		t.Errorf("an empty collection returned %v", err)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_SQLitePurgeVersion(t *testing.T) {
+	db := sqliteContent(t)
+	p := NewSQLitePurger(db)
+
+	// The older version of malware--1 was added to the collection last
+	if n, err := p.PurgeVersion("1234", "malware--1", "2018-01-01T00:00:00.000Z"); n != 1 || err != nil {
+		t.Fatalf("got %d %v want 1 version removed", n, err)
+	}
+
+	var dateAdded string
+	var entries int
+	db.QueryRow(`SELECT COUNT(*), MAX(date_added) FROM t_collection_data WHERE stix_id = "malware--1"`).Scan(&entries, &dateAdded)
+	if entries != 1 || dateAdded != "2018-02-01T00:00:00.000001Z" {
+		t.Errorf("the collection entry of the version was not removed: %d entries, last %s", entries, dateAdded)
+	}
+
+	if v := count(db, `SELECT COUNT(*) FROM s_labels WHERE datastore_id = 1`); v != 0 {
+		t.Errorf("the labels of the removed version were left behind: %d", v)
+	}
+	if v := count(db, `SELECT COUNT(*) FROM s_malware WHERE datastore_id = 2`); v != 1 {
+		t.Errorf("the properties of the version that is kept were removed: %d", v)
+	}
+
+	if _, err := p.PurgeVersion("1234", "malware--2", "2018-01-01T00:00:00.000Z"); err != ErrVersionShared {
+		t.Errorf("a shared version returned %v", err)
+	}
+	if v := count(db, `SELECT COUNT(*) FROM t_collection_data WHERE stix_id = "malware--2"`); v != 2 {
+		t.Errorf("the entries of a shared version were changed: %d", v)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_SQLitePurgeObject(t *testing.T) {
+	db := sqliteContent(t)
+	p := NewSQLitePurger(db)
+
+	if n, err := p.PurgeObject("1234", "malware--1"); n != 2 || err != nil {
+		t.Fatalf("got %d %v want 2 entries removed", n, err)
+	}
+	if v := count(db, `SELECT COUNT(*) FROM s_base_object WHERE id = "malware--1"`); v != 0 {
+		t.Errorf("the versions of an object in no collection were kept: %d", v)
+	}
+	if v := count(db, `SELECT COUNT(*) FROM s_malware`); v != 1 {
+		t.Errorf("the properties of an object in no collection were kept: %d", v)
+	}
+	if v := count(db, `SELECT COUNT(*) FROM s_labels`); v != 0 {
+		t.Errorf("the labels of an object in no collection were kept: %d", v)
+	}
+
+	// malware--2 is still in collection 5678
+	if n, err := p.PurgeOlderThan("1234", "2018-03-01T00:00:00.000000Z"); n != 1 || err != nil {
+		t.Fatalf("got %d %v want 1 entry removed", n, err)
+	}
+	if v := count(db, `SELECT COUNT(*) FROM s_base_object WHERE id = "malware--2"`); v != 1 {
+		t.Errorf("the version of an object in another collection was removed: %d", v)
+	}
+}
+
+// sqliteContent - This function returns a database with the tables of the
+// datastore that hold the object versions and the entries of each collection.
+// There are two versions of malware--1, the older one added last, and one of
+// malware--2 that is also in collection 5678.
+func sqliteContent(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "retention.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, stmt := range []string{
+		`CREATE TABLE s_base_object (datastore_id INTEGER PRIMARY KEY, date_added TEXT, id TEXT, modified TEXT)`,
+		`CREATE TABLE s_malware (row_id INTEGER PRIMARY KEY, datastore_id INTEGER, name TEXT)`,
+		`CREATE TABLE s_labels (row_id INTEGER PRIMARY KEY, datastore_id INTEGER, labels TEXT)`,
+		`CREATE TABLE t_collection_data (collection_id TEXT, stix_id TEXT, date_added TEXT)`,
+		`INSERT INTO s_base_object VALUES (1, "2018-02-02T00:00:00.000000Z", "malware--1", "2018-01-01T00:00:00.000Z"), (2, "2018-02-01T00:00:00.000000Z", "malware--1", "2018-01-02T00:00:00.000Z"), (3, "2018-02-01T00:00:00.000000Z", "malware--2", "2018-01-01T00:00:00.000Z")`,
+		`INSERT INTO s_malware (datastore_id, name) VALUES (1, "one"), (2, "one"), (3, "two")`,
+		`INSERT INTO s_labels (datastore_id, labels) VALUES (1, "trojan"), (1, "dropper")`,
+		`INSERT INTO t_collection_data VALUES ("1234", "malware--1", "2018-02-02T00:00:00.000001Z"), ("1234", "malware--1", "2018-02-01T00:00:00.000001Z"), ("1234", "malware--2", "2018-02-01T00:00:00.000001Z"), ("5678", "malware--2", "2018-02-03T00:00:00.000000Z")`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+// count - This function returns the number that a query returns.
+func count(db *sql.DB, stmt string) int {
+	var n int
+	db.QueryRow(stmt).Scan(&n)
+	return n
+}
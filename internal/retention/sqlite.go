@@ -0,0 +1,204 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package retention
+
+import (
+	"database/sql"
+)
+
+/*
+SQLitePurger - This type implements the Purger interface for the sqlite3
+datastore. Object versions are stored once, in s_base_object and in the tables
+that hold their type specific and child properties, and are shared by every
+collection they were added to. The versions of an object are only removed once
+no collection lists the object.
+
+The rows of a version in the other tables are found by the datastore_id of its
+s_base_object row, so every table with a datastore_id column is cleaned up along
+with it.
+*/
+type SQLitePurger struct {
+	DB *sql.DB
+}
+
+/*
+NewSQLitePurger - This function will create a new Purger for the sqlite3
+datastore that uses the provided database connection.
+*/
+func NewSQLitePurger(db *sql.DB) *SQLitePurger {
+	return &SQLitePurger{DB: db}
+}
+
+/*
+PurgeOlderThan - This method will remove every entry from a collection that was
+added before the date provided, along with the versions of the objects that are
+no longer in any collection.
+*/
+func (p *SQLitePurger) PurgeOlderThan(collectionID, dateAdded string) (int, error) {
+	return p.purge(`collection_id = ? AND date_added < ?`, collectionID, dateAdded)
+}
+
+/*
+PurgeObject - This method will remove every entry for an object from a
+collection, along with its versions if the object is no longer in any
+collection.
+*/
+func (p *SQLitePurger) PurgeObject(collectionID, stixID string) (int, error) {
+	return p.purge(`collection_id = ? AND stix_id = ?`, collectionID, stixID)
+}
+
+/*
+PurgeVersion - This method will remove a single version of an object from the
+datastore, as long as the object is not also found in another collection. The
+collection entry that was added with the version is removed in the same
+transaction so that the collection never lists a version that is gone. An
+object version is added to the datastore right before it is added to the
+collection, so that entry is the one whose date added is the closest to the
+date the version was added. This holds even when the versions were not added in
+the order they were modified, like the versions copied from a feed.
+*/
+func (p *SQLitePurger) PurgeVersion(collectionID, stixID, version string) (int, error) {
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var shared int
+	stmt := `SELECT COUNT(*) FROM t_collection_data WHERE stix_id = ? AND collection_id != ?`
+	if err := tx.QueryRow(stmt, stixID, collectionID).Scan(&shared); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if shared > 0 {
+		tx.Rollback()
+		return 0, ErrVersionShared
+	}
+
+	stmt = `SELECT date_added FROM s_base_object WHERE id = ? AND modified = ?`
+	added, err := queryStrings(tx, stmt, stixID, version)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	stmt = `DELETE FROM t_collection_data WHERE rowid = (
+		SELECT rowid FROM t_collection_data WHERE collection_id = ? AND stix_id = ?
+		ORDER BY ABS(julianday(date_added) - julianday(?)) LIMIT 1)`
+	for _, dateAdded := range added {
+		if _, err := tx.Exec(stmt, collectionID, stixID, dateAdded); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	n, err := deleteVersions(tx, `id = ? AND modified = ?`, stixID, version)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// ----------------------------------------------------------------------
+// Private Methods
+// ----------------------------------------------------------------------
+
+/*
+purge - This method will remove the entries of a collection that match the
+where clause, and then the versions of those objects that no collection lists
+any more. It returns the number of entries that were removed.
+*/
+func (p *SQLitePurger) purge(where string, args ...interface{}) (int, error) {
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	ids, err := queryStrings(tx, `SELECT DISTINCT stix_id FROM t_collection_data WHERE `+where, args...)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	result, err := tx.Exec(`DELETE FROM t_collection_data WHERE `+where, args...)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	for _, id := range ids {
+		stmt := `id = ? AND NOT EXISTS (SELECT 1 FROM t_collection_data WHERE stix_id = ?)`
+		if _, err := deleteVersions(tx, stmt, id, id); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	return int(n), tx.Commit()
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+deleteVersions - This function will remove the object versions in s_base_object
+that match the where clause, along with their rows in every other table that
+has a datastore_id column. It returns the number of versions that were removed.
+*/
+func deleteVersions(tx *sql.Tx, where string, args ...interface{}) (int, error) {
+	ids, err := queryStrings(tx, `SELECT datastore_id FROM s_base_object WHERE `+where, args...)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	stmt := `SELECT m.name FROM sqlite_master AS m JOIN pragma_table_info(m.name) AS c
+		WHERE m.type = 'table' AND m.name != 's_base_object' AND c.name = 'datastore_id'`
+	tables, err := queryStrings(tx, stmt)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		for _, table := range tables {
+			if _, err := tx.Exec(`DELETE FROM "`+table+`" WHERE datastore_id = ?`, id); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := tx.Exec(`DELETE FROM s_base_object WHERE datastore_id = ?`, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+/*
+queryStrings - This function will run a query that returns a single column and
+return the values of that column.
+*/
+func queryStrings(tx *sql.Tx, stmt string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,15 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package search keeps a full-text index of the name, description, pattern, and
+external references of the objects in each collection so that clients can find
+an object by a substring of one of them without exporting the whole collection.
+The index is updated as objects are added to a collection, since an Indexer is
+an ingest.Notifier, and Rebuild adds the objects that are already in the
+datastore when the server starts. Search is not part of TAXII, so it is served under the
+x-freetaxii/search/ path of each API root.
+*/
+package search
@@ -0,0 +1,274 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package search
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/freetaxii/libstix2/datastore"
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/server/internal/envelopes"
+	"github.com/freetaxii/server/internal/ingest"
+	"github.com/freetaxii/server/internal/markings"
+	"github.com/gologme/log"
+)
+
+// Path - The URL path of the search endpoint, relative to the API root. The
+// x-freetaxii prefix keeps it apart from the TAXII endpoints.
+const Path = "x-freetaxii/search/"
+
+// MinLength - The shortest text that can be searched for. The index matches
+// substrings by their three character sequences, so shorter text can not be
+// found.
+const MinLength = 3
+
+// ErrTooShort - The error that is returned when the search text is shorter
+// than MinLength.
+var ErrTooShort = errors.New("the search text must be at least 3 characters")
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Index - This interface is used to add objects to a full-text index and to
+search it. Each collection has its own entry for an object, which holds only
+the latest version of the object that was added to that collection.
+*/
+type Index interface {
+	Add(docs []Document) error
+	Search(q Query) (*Results, error)
+}
+
+/*
+Indexer - This type adds the objects that are added to a collection to the
+search index. It implements the ingest.Notifier interface.
+*/
+type Indexer struct {
+	Logger *log.Logger
+	Index  Index
+}
+
+/*
+Document - This type holds the text of an object that is indexed, along with
+the collection it was added to.
+
+CollectionID       - The collection the object was added to
+ID                 - The id of the object
+Type               - The type of the object
+Version            - The modified timestamp of the object, or created if it has none
+Name               - The name of the object
+Description        - The description of the object
+Pattern            - The pattern of an indicator
+ExternalReferences - The source_name, description, url, and external_id of each external reference
+Markings           - The marking-definitions of the object, used to check what a client may read
+*/
+type Document struct {
+	CollectionID       string
+	ID                 string
+	Type               string
+	Version            string
+	Name               string
+	Description        string
+	Pattern            string
+	ExternalReferences string
+	Markings           []string
+}
+
+/*
+Query - This type defines a search. Only the collections listed are searched.
+If Allow is defined, results that it returns false for are skipped, which is
+how the data markings a client may read are enforced.
+*/
+type Query struct {
+	Text          string
+	CollectionIDs []string
+	Limit         int
+	Allow         func(r Result) bool
+}
+
+/*
+Results - This type defines the response of the search endpoint. More is true
+when there were more results than the limit.
+*/
+type Results struct {
+	More    bool     `json:"more"`
+	Results []Result `json:"results"`
+}
+
+/*
+Result - This type identifies an object that matched a search and the
+collection it was found in. The URL is the path of the object at the API root
+and is set by the handler.
+*/
+type Result struct {
+	CollectionID string   `json:"collection_id"`
+	ID           string   `json:"id"`
+	Type         string   `json:"type"`
+	Version      string   `json:"version"`
+	Name         string   `json:"name,omitempty"`
+	URL          string   `json:"url,omitempty"`
+	Markings     []string `json:"-"`
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+NewIndexer - This function will create a new Indexer that adds objects to the
+index provided.
+*/
+func NewIndexer(logger *log.Logger, index Index) *Indexer {
+	var i Indexer
+
+	if logger == nil {
+		i.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	} else {
+		i.Logger = logger
+	}
+
+	i.Index = index
+	return &i
+}
+
+/*
+NewDocument - This function will create the Document of a STIX object that was
+added to the collection provided.
+*/
+func NewDocument(collectionID string, data []byte) (Document, error) {
+	var o struct {
+		ID                 string `json:"id"`
+		Type               string `json:"type"`
+		Created            string `json:"created"`
+		Modified           string `json:"modified"`
+		Name               string `json:"name"`
+		Description        string `json:"description"`
+		Pattern            string `json:"pattern"`
+		ExternalReferences []struct {
+			SourceName  string `json:"source_name"`
+			Description string `json:"description"`
+			URL         string `json:"url"`
+			ExternalID  string `json:"external_id"`
+		} `json:"external_references"`
+	}
+
+	var d Document
+	if err := json.Unmarshal(data, &o); err != nil {
+		return d, err
+	}
+
+	d.CollectionID = collectionID
+	d.ID = o.ID
+	d.Type = o.Type
+	d.Version = o.Modified
+	if d.Version == "" {
+		d.Version = o.Created
+	}
+	d.Name = o.Name
+	d.Description = o.Description
+	d.Pattern = o.Pattern
+
+	var refs []string
+	for _, v := range o.ExternalReferences {
+		for _, text := range []string{v.SourceName, v.Description, v.URL, v.ExternalID} {
+			if text != "" {
+				refs = append(refs, text)
+			}
+		}
+	}
+	d.ExternalReferences = strings.Join(refs, " ")
+	d.Markings = markings.Refs(data)
+	return d, nil
+}
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+Verify - This function will return an error if the search text can not be
+searched for.
+*/
+func Verify(text string) error {
+	if utf8.RuneCountInString(strings.TrimSpace(text)) < MinLength {
+		return ErrTooShort
+	}
+	return nil
+}
+
+/*
+Rebuild - This function will add the latest version of every object in the
+collections provided to the index, so that the objects that were added before
+the index was enabled can be found. The objects are read a page at a time. An
+entry is only replaced by a newer version, so the index can be rebuilt at any
+time. The number of objects that were added to the index is returned.
+*/
+func Rebuild(logger *log.Logger, index Index, ds datastore.Datastorer, collectionIDs []string) int {
+	total := 0
+	for _, collectionID := range collectionIDs {
+		q := collections.NewCollectionQuery(collectionID, 0)
+		pager := envelopes.New(ds, *q, 0)
+
+		for {
+			page, _ := pager.Next()
+			if page == nil {
+				break
+			}
+
+			docs := make([]Document, 0, len(page))
+			for _, o := range page {
+				data, err := json.Marshal(o)
+				if err != nil {
+					logger.Errorln("ERROR: Unable to index an object in collection", collectionID, err)
+					continue
+				}
+				d, err := NewDocument(collectionID, data)
+				if err != nil {
+					logger.Errorln("ERROR: Unable to index an object in collection", collectionID, err)
+					continue
+				}
+				docs = append(docs, d)
+			}
+
+			if err := index.Add(docs); err != nil {
+				logger.Errorln("ERROR: Unable to add", len(docs), "objects in collection", collectionID, "to the search index", err)
+				break
+			}
+			total += len(docs)
+		}
+	}
+	return total
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Indexer
+// ----------------------------------------------------------------------
+
+/*
+Notify - This method will add the objects that were just added to a collection
+to the index. Objects that can not be indexed are logged and skipped, they are
+still in the collection.
+*/
+func (i *Indexer) Notify(collectionID string, added []ingest.Added) {
+	docs := make([]Document, 0, len(added))
+	for _, v := range added {
+		d, err := NewDocument(collectionID, v.Object)
+		if err != nil {
+			i.Logger.Errorln("ERROR: Unable to index object", v.ID, "in collection", collectionID, err)
+			continue
+		}
+		docs = append(docs, d)
+	}
+
+	if err := i.Index.Add(docs); err != nil {
+		i.Logger.Errorln("ERROR: Unable to add", len(docs), "objects in collection", collectionID, "to the search index", err)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package search
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/freetaxii/server/internal/ingest"
+	"github.com/freetaxii/server/internal/storetest"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type dummyIndex struct {
+	docs []Document
+}
+
+func (i *dummyIndex) Add(docs []Document) error {
+	i.docs = append(i.docs, docs...)
+	return nil
+}
+
+func (i *dummyIndex) Search(q Query) (*Results, error) {
+	return &Results{}, nil
+}
+
+const indicator = `{
+	"type": "indicator",
+	"id": "indicator--1",
+	"created": "2018-01-01T00:00:00.000Z",
+	"modified": "2018-01-02T00:00:00.000Z",
+	"name": "Bad IP",
+	"description": "Command and control server",
+	"pattern": "[ipv4-addr:value = '198.51.100.7']",
+	"object_marking_refs": ["marking-definition--34098fce-860f-48ae-8e50-ebd3cc5e41da"],
+	"external_references": [{"source_name": "acme", "external_id": "ACME-1234", "url": "https://example.com/acme/1234"}]
+}`
+
+// ----------------------------------------------------------------------
+func Test_NewDocument(t *testing.T) {
+	d, err := NewDocument("1234", []byte(indicator))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.CollectionID != "1234" || d.ID != "indicator--1" || d.Type != "indicator" || d.Version != "2018-01-02T00:00:00.000Z" {
+		t.Errorf("wrong document %+v", d)
+	}
+	if d.Pattern != "[ipv4-addr:value = '198.51.100.7']" || d.ExternalReferences != "acme https://example.com/acme/1234 ACME-1234" {
+		t.Errorf("wrong text %q %q", d.Pattern, d.ExternalReferences)
+	}
+	if len(d.Markings) != 1 {
+		t.Errorf("wrong markings %v", d.Markings)
+	}
+
+	if _, err := NewDocument("1234", []byte("not json")); err == nil {
+		t.Error("an object that is not JSON was indexed")
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Notify(t *testing.T) {
+	index := &dummyIndex{}
+	i := NewIndexer(storetest.Logger(), index)
+
+	i.Notify("1234", []ingest.Added{
+		{ID: "indicator--1", Type: "indicator", Object: []byte(indicator)},
+		{ID: "malware--1", Type: "malware", Object: []byte("{")},
+	})
+
+	if len(index.docs) != 1 || index.docs[0].Name != "Bad IP" {
+		t.Errorf("wrong documents %+v", index.docs)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Rebuild(t *testing.T) {
+	ds := storetest.New()
+	ds.Add("1234", "2018-01-01T00:00:00.000000Z", indicator)
+	ds.Add("1234", "2018-01-02T00:00:00.000000Z", strings.Replace(indicator, "2018-01-02T00:00:00.000Z", "2018-01-03T00:00:00.000Z", 1))
+	ds.Add("5678", "2018-01-01T00:00:00.000000Z", `{"type": "malware", "id": "malware--1", "created": "2018-01-01T00:00:00.000Z", "name": "Evil"}`)
+
+	// Only the latest version of each object is indexed for each collection
+	var index dummyIndex
+	if n := Rebuild(storetest.Logger(), &index, ds, []string{"1234", "5678", "9999"}); n != 2 {
+		t.Errorf("%d objects were indexed, want 2", n)
+	}
+	if len(index.docs) != 2 || index.docs[0].Version != "2018-01-03T00:00:00.000Z" || index.docs[1].CollectionID != "5678" {
+		t.Errorf("wrong documents were indexed: %+v", index.docs)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Verify(t *testing.T) {
+	if Verify(" ab ") == nil {
+		t.Error("a two character search was allowed")
+	}
+	if Verify("abc") != nil {
+		t.Error("a three character search was not allowed")
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_SQLiteIndex(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "search.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	index, err := NewSQLiteIndex(db)
+	if err != nil && strings.Contains(err.Error(), "no such module: fts5") {
+		t.Skip("the sqlite3 driver was built without the sqlite_fts5 build tag")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	// The table of the datastore that lists the objects in each collection
+	db.Exec(`CREATE TABLE t_collection_data (collection_id TEXT, stix_id TEXT)`)
+	db.Exec(`INSERT INTO t_collection_data VALUES ("1234", "indicator--1"), ("5678", "indicator--1"), ("1234", "malware--1")`)
+
+	d1, _ := NewDocument("1234", []byte(indicator))
+	d2 := d1
+	d2.CollectionID = "5678"
+	d3 := Document{CollectionID: "1234", ID: "malware--1", Type: "malware", Version: "2018-01-01T00:00:00Z", Name: "Poison Ivy", Description: "Uses 198.51.100.7"}
+	if err := index.Add([]Document{d1, d2, d3}); err != nil {
+		t.Fatal(err)
+	}
+
+	// An older version does not replace the newer one
+	old := d1
+	old.Version = "2018-01-01T00:00:00.000Z"
+	old.Name = "Old Name"
+	index.Add([]Document{old})
+
+	tests := []struct {
+		text        string
+		collections []string
+		limit       int
+		want        int
+		more        bool
+	}{
+		{"198.51.100", []string{"1234"}, 0, 2, false},
+		{"198.51.100", []string{"1234", "5678"}, 2, 2, true},
+		{"acme-12", []string{"1234"}, 0, 1, false},
+		{"ivy", []string{"5678"}, 0, 0, false},
+		{`"quoted" OR`, []string{"1234"}, 0, 0, false},
+		{"old name", []string{"1234"}, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		r, err := index.Search(Query{Text: tt.text, CollectionIDs: tt.collections, Limit: tt.limit})
+		if err != nil {
+			t.Errorf("%s: %v", tt.text, err)
+			continue
+		}
+		if len(r.Results) != tt.want || r.More != tt.more {
+			t.Errorf("%s: got %d results, more %v", tt.text, len(r.Results), r.More)
+		}
+	}
+
+	// Results the client may not read are skipped
+	r, _ := index.Search(Query{Text: "198.51", CollectionIDs: []string{"1234"}, Allow: func(r Result) bool { return len(r.Markings) == 0 }})
+	if len(r.Results) != 1 || r.Results[0].ID != "malware--1" {
+		t.Errorf("wrong results %+v", r.Results)
+	}
+
+	// Objects that are no longer in the collection are not found
+	db.Exec(`DELETE FROM t_collection_data WHERE stix_id = "malware--1"`)
+	r, _ = index.Search(Query{Text: "poison", CollectionIDs: []string{"1234"}})
+	if len(r.Results) != 0 {
+		t.Errorf("a removed object was found %+v", r.Results)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package search
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+/*
+SQLiteIndex - This type implements the Index interface for the sqlite3
+datastore with an FTS5 table that uses the trigram tokenizer, so any substring
+of three or more characters can be found. The sqlite3 driver must be built with
+the sqlite_fts5 build tag. The object and collection of each entry are kept in
+a separate table, and an entry is only returned while its object is still in
+the collection, so objects that are removed by the retention job are not found.
+*/
+type SQLiteIndex struct {
+	DB *sql.DB
+}
+
+/*
+NewSQLiteIndex - This function will create a new Index in the sqlite3
+datastore that uses the provided database connection. The tables are created if
+they do not already exist.
+*/
+func NewSQLiteIndex(db *sql.DB) (*SQLiteIndex, error) {
+	tables := []string{
+		`CREATE TABLE IF NOT EXISTS t_search_object (
+			id INTEGER PRIMARY KEY,
+			collection_id TEXT NOT NULL,
+			stix_id TEXT NOT NULL,
+			type TEXT NOT NULL,
+			version TEXT NOT NULL,
+			markings TEXT NOT NULL,
+			UNIQUE (collection_id, stix_id)
+		)`,
+		`CREATE VIRTUAL TABLE IF NOT EXISTS t_search USING fts5(
+			name, description, pattern, external_references, tokenize = 'trigram'
+		)`,
+	}
+
+	for _, stmt := range tables {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return &SQLiteIndex{DB: db}, nil
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - SQLiteIndex
+// ----------------------------------------------------------------------
+
+/*
+Add - This method will add the documents to the index. A document replaces the
+entry of the same object in the same collection, unless that entry is for a
+newer version.
+*/
+func (i *SQLiteIndex) Add(docs []Document) error {
+	tx, err := i.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, d := range docs {
+		if err := add(tx, d); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+/*
+Search - This method will return the objects in the collections of the query
+whose name, description, pattern, or external references contain the search
+text, best matches first.
+*/
+func (i *SQLiteIndex) Search(q Query) (*Results, error) {
+	var results Results
+	results.Results = make([]Result, 0)
+
+	if err := Verify(q.Text); err != nil {
+		return nil, err
+	}
+	if len(q.CollectionIDs) == 0 {
+		return &results, nil
+	}
+
+	// The text is sent as a single FTS5 string, so it is matched as a
+	// substring and none of its characters are read as query syntax.
+	args := []interface{}{`"` + strings.Replace(strings.TrimSpace(q.Text), `"`, `""`, -1) + `"`}
+	for _, v := range q.CollectionIDs {
+		args = append(args, v)
+	}
+
+	stmt := `SELECT d.collection_id, d.stix_id, d.type, d.version, d.markings, t_search.name
+		FROM t_search JOIN t_search_object AS d ON d.id = t_search.rowid
+		WHERE t_search MATCH ?
+		AND d.collection_id IN (?` + strings.Repeat(", ?", len(q.CollectionIDs)-1) + `)
+		AND EXISTS (SELECT 1 FROM t_collection_data AS c WHERE c.collection_id = d.collection_id AND c.stix_id = d.stix_id)
+		ORDER BY rank`
+
+	rows, err := i.DB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r Result
+		var refs string
+		if err := rows.Scan(&r.CollectionID, &r.ID, &r.Type, &r.Version, &refs, &r.Name); err != nil {
+			return nil, err
+		}
+		r.Markings = strings.Fields(refs)
+
+		if q.Allow != nil && q.Allow(r) == false {
+			continue
+		}
+
+		if q.Limit > 0 && len(results.Results) == q.Limit {
+			results.More = true
+			break
+		}
+		results.Results = append(results.Results, r)
+	}
+	return &results, rows.Err()
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+add - This function will add a single document to the index as part of a
+transaction.
+*/
+func add(tx *sql.Tx, d Document) error {
+	var id int64
+	var version string
+	err := tx.QueryRow(`SELECT id, version FROM t_search_object WHERE collection_id = ? AND stix_id = ?`, d.CollectionID, d.ID).Scan(&id, &version)
+
+	switch {
+	case err == sql.ErrNoRows:
+		result, err := tx.Exec(`INSERT INTO t_search_object (collection_id, stix_id, type, version, markings) VALUES (?, ?, ?, ?, ?)`,
+			d.CollectionID, d.ID, d.Type, d.Version, strings.Join(d.Markings, " "))
+		if err != nil {
+			return err
+		}
+		if id, err = result.LastInsertId(); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case newer(version, d.Version):
+		// The index already has a newer version of this object
+		return nil
+	default:
+		if _, err := tx.Exec(`UPDATE t_search_object SET type = ?, version = ?, markings = ? WHERE id = ?`,
+			d.Type, d.Version, strings.Join(d.Markings, " "), id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM t_search WHERE rowid = ?`, id); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO t_search (rowid, name, description, pattern, external_references) VALUES (?, ?, ?, ?, ?)`,
+		id, d.Name, d.Description, d.Pattern, d.ExternalReferences)
+	return err
+}
+
+/*
+newer - This function will return true if the first timestamp is after the
+second. Timestamps that can not be parsed are compared as text.
+*/
+func newer(a, b string) bool {
+	ta, errA := time.Parse(time.RFC3339Nano, a)
+	tb, errB := time.Parse(time.RFC3339Nano, b)
+	if errA != nil || errB != nil {
+		return a > b
+	}
+	return ta.After(tb)
+}
@@ -0,0 +1,13 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package storetest has the fixtures that the tests of the other packages share.
+Store is an in-memory datastore that answers collection queries the way the
+sqlite3 datastore does, so that paging, versions, and duplicate detection can
+be tested against real behavior, and Logger returns a logger that discards its
+output.
+*/
+package storetest
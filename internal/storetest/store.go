@@ -0,0 +1,429 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package storetest
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/libstix2/resources/manifest"
+	"github.com/gologme/log"
+)
+
+// DateAddedFormat - The format of the date_added values in the datastore.
+const DateAddedFormat = "2006-01-02T15:04:05.000000Z"
+
+// ErrNotFound - Returned by a query that does not find anything, like the
+// sqlite3 datastore does.
+var ErrNotFound = errors.New("no records found")
+
+// ErrExists - Returned by AddObject for a version of an object that is
+// already in the datastore.
+var ErrExists = errors.New("object version already exists")
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Store - This type is an in-memory datastore. Every version of an object is
+kept once, and each collection has a record with the date_added of each version
+that was added to it. Queries support the id, type, version, spec_version,
+added_after, and limit parameters. The records are returned in the order of
+their date_added, and records with the same date_added are returned in the
+order they were added.
+
+Clock - The date_added of the next record that AddToCollection adds
+Err   - If defined, AddObject and AddToCollection return it and change nothing
+*/
+type Store struct {
+	Clock   time.Time
+	Err     error
+	mu      sync.Mutex
+	objects map[string]json.RawMessage
+	latest  map[string]string
+	records []record
+}
+
+/*
+record - This type is the entry of one version of an object in a collection.
+*/
+type record struct {
+	collectionID string
+	id           string
+	version      string
+	dateAdded    string
+	data         json.RawMessage
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+New - This function will create a new empty Store.
+*/
+func New() *Store {
+	var s Store
+	s.Clock = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.objects = make(map[string]json.RawMessage)
+	s.latest = make(map[string]string)
+	return &s
+}
+
+/*
+Logger - This function will return a logger that discards everything that is
+written to it.
+*/
+func Logger() *log.Logger {
+	return log.New(ioutil.Discard, "", 0)
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Store
+// ----------------------------------------------------------------------
+
+/*
+Add - This method will add the JSON of each object to the datastore and to the
+collection with the date_added provided. It is used to set up a test, so it
+panics if an object can not be decoded.
+*/
+func (s *Store) Add(collectionID, dateAdded string, objects ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, o := range objects {
+		id, version := key([]byte(o))
+		if id == "" {
+			panic("storetest: object without an id: " + o)
+		}
+		s.objects[id+"|"+version] = json.RawMessage(o)
+		s.latest[id] = version
+		s.records = append(s.records, record{collectionID, id, version, dateAdded, json.RawMessage(o)})
+	}
+}
+
+/*
+Count - This method will return the number of object versions in a collection.
+*/
+func (s *Store) Count(collectionID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, r := range s.records {
+		if r.collectionID == collectionID {
+			n++
+		}
+	}
+	return n
+}
+
+/*
+Close - This method does nothing, it is part of the Datastorer interface.
+*/
+func (s *Store) Close() error {
+	return nil
+}
+
+/*
+AddObject - This method will add a version of an object to the datastore. It
+returns ErrExists if the version is already there.
+*/
+func (s *Store) AddObject(obj interface{}) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Err != nil {
+		return s.Err
+	}
+
+	id, version := key(data)
+	if _, found := s.objects[id+"|"+version]; found {
+		return ErrExists
+	}
+	s.objects[id+"|"+version] = data
+	s.latest[id] = version
+	return nil
+}
+
+/*
+AddToCollection - This method will add the version of an object that was last
+given to AddObject to a collection, with the time of the Clock as its
+date_added. The Clock is then moved forward by a second.
+*/
+func (s *Store) AddToCollection(collectionID, stixid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Err != nil {
+		return s.Err
+	}
+
+	version, found := s.latest[stixid]
+	if !found {
+		return ErrNotFound
+	}
+	s.records = append(s.records, record{collectionID, stixid, version, s.Clock.Format(DateAddedFormat), s.objects[stixid+"|"+version]})
+	s.Clock = s.Clock.Add(time.Second)
+	return nil
+}
+
+/*
+GetObjects - This method will return the objects that the query finds.
+*/
+func (s *Store) GetObjects(q collections.CollectionQuery) (*collections.CollectionQueryResult, error) {
+	r, found, more, err := s.query(q)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range found {
+		r.ObjectData.Objects = append(r.ObjectData.Objects, v.data)
+	}
+	r.ObjectData.More = more
+	return r, nil
+}
+
+/*
+GetManifestData - This method will return the manifest records of the objects
+that the query finds.
+*/
+func (s *Store) GetManifestData(q collections.CollectionQuery) (*collections.CollectionQueryResult, error) {
+	r, found, more, err := s.query(q)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range found {
+		var m manifest.ManifestRecord
+		m.ID = v.id
+		m.Version = v.version
+		m.DateAdded = v.dateAdded
+		m.MediaType = "application/stix+json;version=" + specVersion(v.data)
+		r.ManifestData.Objects = append(r.ManifestData.Objects, m)
+	}
+	r.ManifestData.More = more
+	return r, nil
+}
+
+/*
+GetVersions - This method will return the versions of the object that the
+query finds.
+*/
+func (s *Store) GetVersions(q collections.CollectionQuery) (*collections.CollectionQueryResult, error) {
+	q.STIXVersion = []string{"all"}
+	r, found, more, err := s.query(q)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range found {
+		r.VersionsData.Versions = append(r.VersionsData.Versions, v.version)
+	}
+	r.VersionsData.More = more
+	return r, nil
+}
+
+/*
+FindVersion - This method will return a collection, other than the one
+provided, that has a version of an object, or an empty string if there is none.
+It implements the ingest.VersionFinder interface.
+*/
+func (s *Store) FindVersion(collectionID, id, version string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.records {
+		if r.collectionID != collectionID && r.id == id && (version == "" || r.version == version) {
+			return r.collectionID, nil
+		}
+	}
+	return "", nil
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - Store
+// ----------------------------------------------------------------------
+
+/*
+query - This method will return the records that a query finds, up to its
+limit, along with a result that has the size and date_added range filled in
+and whether there are more records after the ones returned.
+*/
+func (s *Store) query(q collections.CollectionQuery) (*collections.CollectionQueryResult, []record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := s.matching(q)
+	if len(found) == 0 {
+		return nil, nil, false, ErrNotFound
+	}
+
+	more := false
+	if l := limit(q); l > 0 && len(found) > l {
+		found = found[:l]
+		more = true
+	}
+
+	var r collections.CollectionQueryResult
+	r.Size = len(found)
+	r.DateAddedFirst = found[0].dateAdded
+	r.DateAddedLast = found[len(found)-1].dateAdded
+	return &r, found, more, nil
+}
+
+/*
+matching - This method will return every record that a query finds, in the
+order of their date_added. The version parameter is applied to the versions
+of each object in the collection before the added_after parameter, so an
+object whose last version was added before added_after is not found at all.
+*/
+func (s *Store) matching(q collections.CollectionQuery) []record {
+	versions := make(map[string][]record)
+	var ids []string
+	for _, r := range s.records {
+		if r.collectionID != q.CollectionID {
+			continue
+		}
+		if len(q.STIXID) > 0 && !contains(q.STIXID, r.id) {
+			continue
+		}
+		if len(q.STIXType) > 0 && !contains(q.STIXType, strings.SplitN(r.id, "--", 2)[0]) {
+			continue
+		}
+		if len(q.SpecVersion) > 0 && !contains(q.SpecVersion, specVersion(r.data)) {
+			continue
+		}
+		if _, seen := versions[r.id]; !seen {
+			ids = append(ids, r.id)
+		}
+		versions[r.id] = append(versions[r.id], r)
+	}
+
+	var found []record
+	for _, id := range ids {
+		list := versions[id]
+		sort.SliceStable(list, func(a, b int) bool { return list[a].version < list[b].version })
+
+		for i, r := range list {
+			if !wanted(q.STIXVersion, r.version, i, len(list)) {
+				continue
+			}
+			if len(q.AddedAfter) > 0 && r.dateAdded <= q.AddedAfter[0] {
+				continue
+			}
+			found = append(found, r)
+		}
+	}
+
+	sort.SliceStable(found, func(a, b int) bool { return found[a].dateAdded < found[b].dateAdded })
+	return found
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+limit - This function will return the number of records a query may return,
+the smaller of its limit parameter and the record limit of the server.
+*/
+func limit(q collections.CollectionQuery) int {
+	l := q.ServerRecordLimit
+	if len(q.Limit) > 0 {
+		if v, err := strconv.Atoi(q.Limit[0]); err == nil && v > 0 && (l <= 0 || v < l) {
+			l = v
+		}
+	}
+	return l
+}
+
+/*
+wanted - This function will return true if the version at position i of the
+n versions of an object matches the version parameter of a query. Only the
+last version is wanted when there is no version parameter.
+*/
+func wanted(filter []string, version string, i, n int) bool {
+	if len(filter) == 0 {
+		return i == n-1
+	}
+	for _, v := range filter {
+		switch v {
+		case "all":
+			return true
+		case "first":
+			if i == 0 {
+				return true
+			}
+		case "last":
+			if i == n-1 {
+				return true
+			}
+		default:
+			if v == version {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+/*
+key - This function will return the id and the version of an object from its
+JSON. The version is the modified timestamp, or the created timestamp for
+objects that are not versioned.
+*/
+func key(data []byte) (string, string) {
+	var o struct {
+		ID       string `json:"id"`
+		Created  string `json:"created"`
+		Modified string `json:"modified"`
+	}
+	json.Unmarshal(data, &o)
+
+	if o.Modified != "" {
+		return o.ID, o.Modified
+	}
+	return o.ID, o.Created
+}
+
+/*
+specVersion - This function will return the spec_version of an object, objects
+without one are STIX 2.0 objects.
+*/
+func specVersion(data []byte) string {
+	var o struct {
+		SpecVersion string `json:"spec_version"`
+	}
+	json.Unmarshal(data, &o)
+
+	if o.SpecVersion == "" {
+		return "2.0"
+	}
+	return o.SpecVersion
+}
+
+/*
+contains - This function will return true if the value is in the list.
+*/
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,13 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package stream sends the objects or manifest entries that are added to a
+collection to clients as Server-Sent Events. The id of each event is the
+date_added of the data that was sent, so a client that reconnects with the
+Last-Event-ID header picks up where it left off. The data that shares that
+date_added is sent again, so that none of it is lost.
+*/
+package stream
@@ -0,0 +1,74 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package stream
+
+import (
+	"sync"
+
+	"github.com/freetaxii/server/internal/ingest"
+)
+
+/*
+Hub - This type keeps track of the open streams of each collection and wakes
+them up when objects are added to that collection. It implements the
+ingest.Notifier interface.
+*/
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]bool // The key in the map is the collection ID
+}
+
+/*
+NewHub - This function will create a new Hub with no subscribers.
+*/
+func NewHub() *Hub {
+	var h Hub
+	h.subscribers = make(map[string]map[chan struct{}]bool)
+	return &h
+}
+
+/*
+Notify - This method will wake up every stream of the collection. A stream that
+has not yet handled an earlier wake up is not sent a second one, since it will
+read everything that was added when it does.
+*/
+func (h *Hub) Notify(collectionID string, added []ingest.Added) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.subscribers[collectionID] {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+/*
+Subscribe - This method will return a channel that receives a value each time
+objects are added to the collection, along with a function that must be called
+to unsubscribe when the stream is closed.
+*/
+func (h *Hub) Subscribe(collectionID string) (<-chan struct{}, func()) {
+	c := make(chan struct{}, 1)
+
+	h.mu.Lock()
+	if h.subscribers[collectionID] == nil {
+		h.subscribers[collectionID] = make(map[chan struct{}]bool)
+	}
+	h.subscribers[collectionID][c] = true
+	h.mu.Unlock()
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers[collectionID], c)
+		if len(h.subscribers[collectionID]) == 0 {
+			delete(h.subscribers, collectionID)
+		}
+	}
+	return c, unsubscribe
+}
@@ -0,0 +1,258 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/freetaxii/libstix2/datastore"
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/libstix2/resources/manifest"
+	"github.com/freetaxii/server/internal/envelopes"
+	"github.com/freetaxii/server/internal/filters"
+	"github.com/freetaxii/server/internal/markings"
+	"github.com/gologme/log"
+)
+
+// MediaType - The media type of a Server-Sent Events stream.
+const MediaType = "text/event-stream"
+
+// DefaultKeepAlive - How often a comment is sent to an idle stream so that
+// proxies do not close it. The datastore is also checked at this interval in
+// case objects were added by something other than this server.
+const DefaultKeepAlive = 30 * time.Second
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Stream - This type holds everything that is needed to send the data that is
+added to a single collection to a single client.
+
+Query     - The filters of the client, added_after moves forward as data is sent
+PageSize  - The most records that are read from the datastore at a time
+Manifest  - Send manifest entries instead of objects
+KeepAlive - How often a comment is sent when nothing has been added
+Markings  - Only send data with markings that are allowed, not enforced if nil
+Filters   - Only send data that matches the interoperability match filters
+*/
+type Stream struct {
+	Logger    *log.Logger
+	DS        datastore.Datastorer
+	Hub       *Hub
+	Query     collections.CollectionQuery
+	PageSize  int
+	Manifest  bool
+	KeepAlive time.Duration
+	Markings  *markings.Policy
+	Filters   filters.Filters
+	boundary  envelopes.Boundary
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+New - This function will create a new Stream for the query provided. If the
+query does not ask for specific versions then every version is sent. The limit
+of the query, or else the record limit of the server, is the page size.
+*/
+func New(logger *log.Logger, ds datastore.Datastorer, hub *Hub, q collections.CollectionQuery) *Stream {
+	var st Stream
+
+	if logger == nil {
+		st.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	} else {
+		st.Logger = logger
+	}
+
+	if len(q.STIXVersion) == 0 {
+		q.STIXVersion = []string{"all"}
+	}
+
+	st.PageSize = q.ServerRecordLimit
+	if len(q.Limit) > 0 {
+		if l, err := strconv.Atoi(q.Limit[0]); err == nil && l > 0 && (st.PageSize <= 0 || l < st.PageSize) {
+			st.PageSize = l
+		}
+	}
+	if st.PageSize <= 0 {
+		st.PageSize = envelopes.DefaultPageSize
+	}
+	q.Limit = nil
+
+	st.DS = ds
+	st.Hub = hub
+	st.Query = q
+	st.KeepAlive = DefaultKeepAlive
+	return &st
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Stream
+// ----------------------------------------------------------------------
+
+/*
+Serve - This method will send everything that was added after the starting
+point of the query and then keep sending new data as it is added, until the
+done channel is closed or the client goes away.
+*/
+func (st *Stream) Serve(w http.ResponseWriter, done <-chan struct{}) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("the response writer does not support streaming")
+	}
+
+	// Subscribe before the first read so nothing added in between is missed
+	wake, unsubscribe := st.Hub.Subscribe(st.Query.CollectionID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", MediaType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(st.KeepAlive)
+	defer ticker.Stop()
+
+	for {
+		total, err := st.send(w)
+		if err != nil {
+			return err
+		}
+		if total > 0 {
+			st.Logger.Debugln("DEBUG: Sent", total, "events on the stream of collection", st.Query.CollectionID)
+			flusher.Flush()
+		}
+
+		select {
+		case <-wake:
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return err
+			}
+			flusher.Flush()
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - Stream
+// ----------------------------------------------------------------------
+
+/*
+send - This method will write an event for everything that was added since the
+last one that was sent and return the number of events written. Each read
+starts at the date_added of the last one, so that data that shares it is not
+lost, and the data that was already sent is skipped. Errors from the datastore
+are logged and the read is tried again the next time the stream wakes up. Only
+errors writing to the client are returned.
+*/
+func (st *Stream) send(w io.Writer) (int, error) {
+	total := 0
+
+	for {
+		var results *collections.CollectionQueryResult
+		var err error
+		var more bool
+
+		st.Query.ServerRecordLimit = st.boundary.Limit(st.PageSize)
+		if st.Manifest == true {
+			results, err = st.DS.GetManifestData(st.Query)
+		} else {
+			results, err = st.DS.GetObjects(st.Query)
+		}
+		if err != nil || results == nil {
+			st.Logger.Debugln("DEBUG: No new data for the stream of collection", st.Query.CollectionID, err)
+			return total, nil
+		}
+
+		if st.Manifest == true {
+			var records []manifest.ManifestRecord
+			for _, m := range results.ManifestData.Objects {
+				if st.boundary.Add(m.ID + "|" + m.Version) {
+					records = append(records, m)
+				}
+			}
+			records = st.Markings.FilterManifest(st.DS, st.Query, records)
+			records = st.Filters.FilterManifest(st.DS, st.Query, records)
+			for _, m := range records {
+				if err := writeEvent(w, m.DateAdded, "manifest", m); err != nil {
+					return total, err
+				}
+				total++
+			}
+			more = results.ManifestData.More
+		} else {
+			// The objects do not carry their own date_added, so only the last
+			// event of each page has an id. A client that reconnects part way
+			// through a page gets that whole page again.
+			var objects []interface{}
+			for _, o := range results.ObjectData.Objects {
+				if st.boundary.Add(envelopes.Key(o)) {
+					objects = append(objects, o)
+				}
+			}
+			objects = st.Filters.Filter(st.Markings.Filter(objects))
+			last := len(objects) - 1
+			for i, o := range objects {
+				id := ""
+				if i == last {
+					id = results.DateAddedLast
+				}
+				if err := writeEvent(w, id, "object", o); err != nil {
+					return total, err
+				}
+				total++
+			}
+			more = results.ObjectData.More
+		}
+
+		if results.DateAddedLast == "" {
+			return total, nil
+		}
+		st.boundary.Advance(&st.Query, results.DateAddedLast)
+
+		if more == false {
+			return total, nil
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+writeEvent - This function will write a single event to the stream. The id is
+left out when it is empty.
+*/
+func writeEvent(w io.Writer, id, event string, data interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, body)
+	return err
+}
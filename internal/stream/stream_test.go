@@ -0,0 +1,133 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package stream
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/server/internal/ingest"
+	"github.com/freetaxii/server/internal/storetest"
+)
+
+// indicators - This function returns a datastore with two indicators that were
+// added a day apart.
+func indicators() *storetest.Store {
+	ds := storetest.New()
+	ds.Add("1234", "2018-01-02T00:00:00.000000Z", `{"id": "indicator--1", "modified": "2018-01-01T00:00:00.000Z"}`)
+	ds.Add("1234", "2018-01-03T00:00:00.000000Z", `{"id": "indicator--2", "modified": "2018-01-01T00:00:00.000Z"}`)
+	ds.Add("1234", "2018-01-03T00:00:00.000000Z", `{"id": "malware--1", "modified": "2018-01-01T00:00:00.000Z"}`)
+	return ds
+}
+
+// serve - This function returns what the stream sends before it is stopped.
+func serve(t *testing.T, st *Stream) string {
+	done := make(chan struct{})
+	close(done)
+	w := httptest.NewRecorder()
+	if err := st.Serve(w, done); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w.Header().Get("Content-Type") != MediaType {
+		t.Errorf("wrong content type: %s", w.Header().Get("Content-Type"))
+	}
+	return w.Body.String()
+}
+
+// ----------------------------------------------------------------------
+func Test_ServeManifest(t *testing.T) {
+	ds := indicators()
+	q := collections.NewCollectionQuery("1234", 10)
+	q.STIXType = []string{"indicator"}
+	q.AddedAfter = []string{"2018-01-01T00:00:00.000000Z"}
+	q.Limit = []string{"1"}
+
+	st := New(storetest.Logger(), ds, NewHub(), *q)
+	st.Manifest = true
+
+	// With the done channel already closed the stream sends what it has and
+	// returns, one page at a time
+	body := serve(t, st)
+	want := "id: 2018-01-02T00:00:00.000000Z\nevent: manifest\ndata: {\"id\":\"indicator--1\""
+	if !strings.Contains(body, want) || !strings.Contains(body, "id: 2018-01-03T00:00:00.000000Z\nevent: manifest\ndata: {\"id\":\"indicator--2\"") {
+		t.Errorf("wrong events sent: %s", body)
+	}
+	if strings.Contains(body, "malware--1") {
+		t.Errorf("the type filter was not applied: %s", body)
+	}
+
+	// Only what was added since is sent the next time
+	ds.Add("1234", "2018-01-04T00:00:00.000000Z", `{"id": "indicator--3", "modified": "2018-01-01T00:00:00.000Z"}`)
+	body = serve(t, st)
+	if strings.Count(body, "event: manifest") != 1 || !strings.Contains(body, "indicator--3") {
+		t.Errorf("wrong events sent after an addition: %s", body)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_ServeSharedDateAdded(t *testing.T) {
+	// Three entries share a date_added and only one is read at a time
+	ds := storetest.New()
+	for _, id := range []string{"indicator--1", "indicator--2", "indicator--3"} {
+		ds.Add("1234", "2018-01-02T00:00:00.000000Z", `{"id": "`+id+`", "modified": "2018-01-01T00:00:00.000Z"}`)
+	}
+	q := collections.NewCollectionQuery("1234", 1)
+	q.AddedAfter = []string{"2018-01-01T00:00:00.000000Z"}
+
+	st := New(storetest.Logger(), ds, NewHub(), *q)
+	st.Manifest = true
+
+	body := serve(t, st)
+	for _, id := range []string{"indicator--1", "indicator--2", "indicator--3"} {
+		if strings.Count(body, id) != 1 {
+			t.Errorf("%s was not sent exactly once: %s", id, body)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_ServeObjects(t *testing.T) {
+	q := collections.NewCollectionQuery("1234", 10)
+	q.STIXType = []string{"indicator"}
+	q.AddedAfter = []string{"2018-01-01T00:00:00.000000Z"}
+
+	st := New(storetest.Logger(), indicators(), NewHub(), *q)
+
+	// Only the last object of the page has an id
+	want := "event: object\ndata: {\"id\":\"indicator--1\",\"modified\":\"2018-01-01T00:00:00.000Z\"}\n\nid: 2018-01-03T00:00:00.000000Z\nevent: object\ndata: {\"id\":\"indicator--2\",\"modified\":\"2018-01-01T00:00:00.000Z\"}\n\n"
+	if body := serve(t, st); body != want {
+		t.Errorf("wrong events sent: got %q want %q", body, want)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Hub(t *testing.T) {
+	h := NewHub()
+	wake, unsubscribe := h.Subscribe("1234")
+
+	h.Notify("5678", []ingest.Added{{ID: "indicator--1", Type: "indicator"}})
+	select {
+	case <-wake:
+		t.Errorf("woken up by another collection")
+	default:
+	}
+
+	// A second notification before the first is handled must not block
+	h.Notify("1234", []ingest.Added{{ID: "indicator--1", Type: "indicator"}})
+	h.Notify("1234", []ingest.Added{{ID: "indicator--2", Type: "indicator"}})
+	select {
+	case <-wake:
+	default:
+		t.Errorf("not woken up by a notification")
+	}
+
+	unsubscribe()
+	if len(h.subscribers) != 0 {
+		t.Errorf("subscriber was not removed: %v", h.subscribers)
+	}
+}
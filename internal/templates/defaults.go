@@ -0,0 +1,79 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package templates
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// BuiltIn - The template path of the templates that are built in to the server.
+// It is used in place of a template directory when none is configured, so the
+// full path of a built in template is BuiltIn plus its file name.
+const BuiltIn = "builtin:"
+
+// AssetsPath - The URL path that the built in CSS and JavaScript files are
+// served from.
+const AssetsPath = "/static/"
+
+// These are the file names of the built in templates, which are also the
+// default file names when a template file is not configured.
+const (
+	Discovery   = "discoveryResource.html"
+	APIRoot     = "apirootResource.html"
+	Collections = "collectionsResource.html"
+	Collection  = "collectionResource.html"
+	Objects     = "objectsResource.html"
+	Versions    = "versionsResource.html"
+	Manifest    = "manifestResource.html"
+	Error       = "errorResource.html"
+)
+
+//go:embed defaults
+var defaults embed.FS
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+Exists - This function will return true if a template with the file name
+provided is built in to the server.
+*/
+func Exists(name string) bool {
+	if name == "" || strings.Contains(name, "/") {
+		return false
+	}
+	_, err := fs.Stat(defaults, "defaults/html/"+name)
+	return err == nil
+}
+
+/*
+Assets - This function will return a handler that serves the built in CSS and
+JavaScript files at AssetsPath.
+*/
+func Assets() http.Handler {
+	static, _ := fs.Sub(defaults, "defaults/static")
+	return http.StripPrefix(AssetsPath, http.FileServer(http.FS(static)))
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+parseBuiltIn - This function will parse a built in template from its full path.
+*/
+func parseBuiltIn(file string) (*entry, error) {
+	t, err := template.ParseFS(defaults, "defaults/html/"+strings.TrimPrefix(file, BuiltIn))
+	if err != nil {
+		return nil, err
+	}
+	return &entry{tmpl: t}, nil
+}
@@ -0,0 +1,15 @@
+/*
+ * Copyright 2015-2018 Bret Jordan, All rights reserved.
+ *
+ * Use of this source code is governed by an Apache 2.0 license
+ * that can be found in the LICENSE file in the root of the source tree.
+ */
+
+// Show the local time of every timestamp on the page when the mouse is over
+// it. Timestamps are marked with the class "timestamp" and are in UTC.
+document.querySelectorAll(".timestamp").forEach(function (e) {
+	var t = new Date(e.textContent.trim());
+	if (!isNaN(t)) {
+		e.title = t.toLocaleString();
+	}
+});
@@ -0,0 +1,20 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package templates keeps the HTML templates of the server parsed in memory. The
+templates are parsed once at startup, so a missing or broken template is found
+before the server starts listening instead of on the first request. They can be
+parsed again with Reload, which the server does when it gets a SIGHUP. A template
+that no longer parses keeps its last good version. In development mode the
+modification time of each file is checked on every request and a template is
+parsed again as soon as its file changes.
+
+The default templates, along with their CSS and JavaScript files, are built in
+to the server. They are used when no template directory is configured, so the
+server does not need any files on disk to serve HTML. A service can still use
+its own template files by configuring a template directory for that service.
+*/
+package templates
@@ -0,0 +1,206 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package templates
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gologme/log"
+)
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Cache - This type holds the parsed HTML templates, keyed by the full path of
+their file. It is safe to use from many requests at once.
+
+Logger  - The logger for reload messages
+DevMode - Parse a template again when its file changes, checked on every use
+*/
+type Cache struct {
+	Logger    *log.Logger
+	DevMode   bool
+	mu        sync.RWMutex
+	templates map[string]*entry
+}
+
+/*
+entry - This type holds a parsed template and the modification time of its file
+when it was parsed.
+*/
+type entry struct {
+	tmpl    *template.Template
+	modTime time.Time
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+New - This function will create a new empty template Cache.
+*/
+func New(logger *log.Logger) *Cache {
+	var c Cache
+
+	if logger == nil {
+		c.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	} else {
+		c.Logger = logger
+	}
+
+	c.templates = make(map[string]*entry)
+	return &c
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Cache
+// ----------------------------------------------------------------------
+
+/*
+Load - This method will parse the template files provided and add them to the
+cache. Every file is tried, and the first error is returned.
+*/
+func (c *Cache) Load(files ...string) error {
+	var firstErr error
+	for _, f := range files {
+		e, err := parse(f)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		c.mu.Lock()
+		c.templates[f] = e
+		c.mu.Unlock()
+	}
+	return firstErr
+}
+
+/*
+Reload - This method will parse every template in the cache again. A template
+that fails to parse keeps its previous version, so a file that is being edited
+can not break the pages that are being served. The number of templates that
+failed is returned.
+*/
+func (c *Cache) Reload() int {
+	c.mu.RLock()
+	files := make([]string, 0, len(c.templates))
+	for f := range c.templates {
+		files = append(files, f)
+	}
+	c.mu.RUnlock()
+
+	failed := 0
+	for _, f := range files {
+		e, err := parse(f)
+		if err != nil {
+			c.Logger.Errorln("ERROR: Unable to reload the HTML template, keeping the previous version:", err)
+			failed++
+			continue
+		}
+		c.mu.Lock()
+		c.templates[f] = e
+		c.mu.Unlock()
+	}
+	c.Logger.Infoln("INFO: Reloaded", len(files)-failed, "of", len(files), "HTML templates")
+	return failed
+}
+
+/*
+Execute - This method will render the template for a file with the data
+provided. The output is only written to w when the template runs without error,
+so a failure never leaves a partial page behind. A file that is not in the cache
+is parsed and added to it. If the cache is nil the file is parsed every time.
+*/
+func (c *Cache) Execute(w io.Writer, file string, data interface{}) error {
+	t, err := c.get(file)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return err
+	}
+	_, err = b.WriteTo(w)
+	return err
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - Cache
+// ----------------------------------------------------------------------
+
+/*
+get - This method will return the parsed template for a file, parsing it if it
+is not cached yet or, in development mode, if the file has changed.
+*/
+func (c *Cache) get(file string) (*template.Template, error) {
+	if c == nil {
+		return template.ParseFiles(file)
+	}
+
+	c.mu.RLock()
+	e, found := c.templates[file]
+	c.mu.RUnlock()
+
+	if found == true && c.DevMode == true {
+		if info, err := os.Stat(file); err == nil && info.ModTime().Equal(e.modTime) == false {
+			c.Logger.Debugln("DEBUG: HTML template", file, "changed, parsing it again")
+			found = false
+		}
+	}
+
+	if found == false {
+		newEntry, err := parse(file)
+		if err != nil {
+			// Keep serving the last good version of a template that broke
+			if e != nil {
+				c.Logger.Errorln("ERROR: Unable to parse the HTML template, using the previous version:", err)
+				return e.tmpl, nil
+			}
+			return nil, err
+		}
+		c.mu.Lock()
+		c.templates[file] = newEntry
+		c.mu.Unlock()
+		e = newEntry
+	}
+	return e.tmpl, nil
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+parse - This function will parse a template file and record its modification
+time. A full path that starts with BuiltIn is one of the built in templates.
+*/
+func parse(file string) (*entry, error) {
+	if strings.HasPrefix(file, BuiltIn) {
+		return parseBuiltIn(file)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	t, err := template.ParseFiles(file)
+	if err != nil {
+		return nil, err
+	}
+	return &entry{tmpl: t, modTime: info.ModTime()}, nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package templates
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freetaxii/libstix2/resources/taxiierror"
+	"github.com/freetaxii/server/internal/storetest"
+)
+
+// ----------------------------------------------------------------------
+func writeTemplate(t *testing.T, file, text string, modTime time.Time) {
+	if err := ioutil.WriteFile(file, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ----------------------------------------------------------------------
+func render(t *testing.T, c *Cache, file string) string {
+	var b bytes.Buffer
+	if err := c.Execute(&b, file, "FreeTAXII"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return b.String()
+}
+
+// ----------------------------------------------------------------------
+func Test_Reload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "discovery.html")
+	now := time.Now()
+	writeTemplate(t, file, "<h1>{{.}}</h1>", now)
+
+	c := New(storetest.Logger())
+	if err := c.Load(file); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without development mode an edited file is not used until a reload
+	writeTemplate(t, file, "<h2>{{.}}</h2>", now.Add(time.Second))
+	if got := render(t, c, file); got != "<h1>FreeTAXII</h1>" {
+		t.Errorf("template changed before a reload: %q", got)
+	}
+	if failed := c.Reload(); failed != 0 {
+		t.Errorf("%d templates failed to reload", failed)
+	}
+	if got := render(t, c, file); got != "<h2>FreeTAXII</h2>" {
+		t.Errorf("template did not change after a reload: %q", got)
+	}
+
+	// A broken file keeps the previous version
+	writeTemplate(t, file, "<h3>{{.</h3>", now.Add(2*time.Second))
+	if failed := c.Reload(); failed != 1 {
+		t.Errorf("broken template was reloaded")
+	}
+	if got := render(t, c, file); got != "<h2>FreeTAXII</h2>" {
+		t.Errorf("broken template replaced the previous version: %q", got)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_DevMode(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "discovery.html")
+	now := time.Now()
+	writeTemplate(t, file, "<h1>{{.}}</h1>", now)
+
+	c := New(storetest.Logger())
+	c.DevMode = true
+	if got := render(t, c, file); got != "<h1>FreeTAXII</h1>" {
+		t.Errorf("got %q", got)
+	}
+
+	writeTemplate(t, file, "<h2>{{.}}</h2>", now.Add(time.Second))
+	if got := render(t, c, file); got != "<h2>FreeTAXII</h2>" {
+		t.Errorf("changed file was not parsed again: %q", got)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_ExecuteError(t *testing.T) {
+	dir := t.TempDir()
+	c := New(storetest.Logger())
+
+	if err := c.Load(filepath.Join(dir, "missing.html")); err == nil {
+		t.Error("missing template did not return an error")
+	}
+
+	broken := filepath.Join(dir, "broken.html")
+	writeTemplate(t, broken, "{{.", time.Now())
+	if err := c.Load(broken); err == nil {
+		t.Error("broken template did not return an error")
+	}
+
+	// A template that fails while running writes nothing
+	failing := filepath.Join(dir, "failing.html")
+	writeTemplate(t, failing, "<p>{{.Missing}}</p>", time.Now())
+	var b bytes.Buffer
+	if err := c.Execute(&b, failing, "FreeTAXII"); err == nil {
+		t.Error("failing template did not return an error")
+	}
+	if b.Len() != 0 {
+		t.Errorf("failing template wrote %q", b.String())
+	}
+
+	// A nil cache parses the file every time
+	var none *Cache
+	if err := none.Execute(&b, failing, struct{ Missing string }{"ok"}); err != nil || b.String() != "<p>ok</p>" {
+		t.Errorf("nil cache: %q %v", b.String(), err)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_BuiltIn(t *testing.T) {
+	c := New(storetest.Logger())
+	c.DevMode = true
+
+	names := []string{Discovery, APIRoot, Collections, Collection, Objects, Versions, Manifest, Error}
+	for _, name := range names {
+		if Exists(name) == false {
+			t.Errorf("%s is not built in", name)
+		}
+		if err := c.Load(BuiltIn + name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	if Exists("missing.html") || Exists("../html/"+Discovery) {
+		t.Error("a template that is not built in was found")
+	}
+
+	// The built in templates link to the built in assets
+	rec := httptest.NewRecorder()
+	Assets().ServeHTTP(rec, httptest.NewRequest("GET", AssetsPath+"freetaxii.css", nil))
+	if rec.Code != 200 || rec.Body.Len() == 0 {
+		t.Errorf("freetaxii.css was not served: %d", rec.Code)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_ErrorTemplate(t *testing.T) {
+	c := New(storetest.Logger())
+
+	e := taxiierror.New()
+	e.SetTitle("No Objects Found")
+	e.SetDescription("There were no objects returned matching the request.")
+	e.SetErrorCode("404")
+	e.SetHTTPStatus("404 Not Found")
+	data := struct {
+		URLPath  string
+		Resource *taxiierror.Error
+	}{"/api1/collections/", e}
+
+	var b bytes.Buffer
+	if err := c.Execute(&b, BuiltIn+Error, data); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "<h2>No Objects Found</h2>") == false || strings.Contains(b.String(), "404 Not Found") == false {
+		t.Errorf("error page does not show the error: %s", b.String())
+	}
+}
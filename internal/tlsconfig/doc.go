@@ -0,0 +1,12 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package tlsconfig turns the TLS settings of the configuration file in to a
+tls.Config. It looks up the TLS versions, cipher suites, and curves by name,
+keeps the server certificate along with its stapled OCSP response so that both
+can be loaded again without a restart, and rotates the session ticket keys.
+*/
+package tlsconfig
@@ -0,0 +1,288 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package tlsconfig
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// versions - The TLS versions that can be configured, by name. Versions before
+// TLS 1.2 are not offered.
+var versions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// curves - The elliptic curves that can be configured, by name.
+var curves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// ErrInsecureCipherSuite - The error that is returned for a cipher suite that
+// is known to be insecure, or that does not use ECDHE key exchange and an AEAD
+// cipher. Static RSA key exchange has no forward secrecy and CBC mode ciphers
+// are open to padding oracle attacks, so they are not allowed.
+var ErrInsecureCipherSuite = errors.New("the cipher suite is insecure")
+
+// ErrUnknownCipherSuite - The error that is returned for a cipher suite name
+// that is not known.
+var ErrUnknownCipherSuite = errors.New("the cipher suite is not known")
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Certificate - This type holds the server certificate and its stapled OCSP
+response. Its GetCertificate method is used in the tls.Config so that a new
+certificate or OCSP response is used as soon as it is loaded.
+*/
+type Certificate struct {
+	CertFile string
+	KeyFile  string
+	OCSPFile string // The DER encoded OCSP response that is stapled, not stapled if empty
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+NewCertificate - This function will load the certificate, the private key, and
+if a file is provided the OCSP response.
+*/
+func NewCertificate(certFile, keyFile, ocspFile string) (*Certificate, error) {
+	var c Certificate
+	c.CertFile = certFile
+	c.KeyFile = keyFile
+	c.OCSPFile = ocspFile
+
+	if err := c.Load(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+Version - This function will return the TLS version with the name provided,
+example "1.2". A "TLS" prefix, like "TLS1.3", is allowed.
+*/
+func Version(name string) (uint16, bool) {
+	name = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "TLS")
+	v, found := versions[strings.TrimSpace(name)]
+	return v, found
+}
+
+/*
+VersionNames - This function will return the names of the TLS versions that
+can be configured.
+*/
+func VersionNames() []string {
+	list := make([]string, 0, len(versions))
+	for k := range versions {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return list
+}
+
+/*
+CipherSuite - This function will return the TLS 1.2 cipher suite with the name
+provided, example "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384". Only cipher suites
+with ECDHE key exchange and an AEAD cipher are allowed.
+*/
+func CipherSuite(name string) (uint16, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	for _, v := range tls.CipherSuites() {
+		if v.Name == name {
+			if tls12(v) == false {
+				return 0, ErrUnknownCipherSuite
+			}
+			if allowed(v) == false {
+				return 0, ErrInsecureCipherSuite
+			}
+			return v.ID, nil
+		}
+	}
+	for _, v := range tls.InsecureCipherSuites() {
+		if v.Name == name {
+			return 0, ErrInsecureCipherSuite
+		}
+	}
+	return 0, ErrUnknownCipherSuite
+}
+
+/*
+CipherSuiteNames - This function will return the names of the cipher suites
+that can be configured.
+*/
+func CipherSuiteNames() []string {
+	var list []string
+	for _, v := range tls.CipherSuites() {
+		if allowed(v) == true {
+			list = append(list, v.Name)
+		}
+	}
+	return list
+}
+
+/*
+DefaultCipherSuites - This function will return the cipher suites that are used
+for TLS 1.2 when none are configured, which is every one that can be configured.
+*/
+func DefaultCipherSuites() []uint16 {
+	var list []uint16
+	for _, v := range tls.CipherSuites() {
+		if allowed(v) == true {
+			list = append(list, v.ID)
+		}
+	}
+	return list
+}
+
+/*
+Curve - This function will return the elliptic curve with the name provided,
+example "X25519" or "P256". A "Curve" prefix, like "CurveP256", is allowed.
+*/
+func Curve(name string) (tls.CurveID, bool) {
+	name = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(name)), "CURVE")
+	v, found := curves[name]
+	return v, found
+}
+
+/*
+CurveNames - This function will return the names of the elliptic curves that
+can be configured.
+*/
+func CurveNames() []string {
+	list := make([]string, 0, len(curves))
+	for k := range curves {
+		list = append(list, k)
+	}
+	sort.Strings(list)
+	return list
+}
+
+/*
+RotateSessionTickets - This function will set a new session ticket key every
+interval until the stop channel is closed. The previous key is kept, so a
+ticket can be used to resume a session for up to two intervals. A nil channel
+never stops.
+*/
+func RotateSessionTickets(c *tls.Config, interval time.Duration, stop <-chan struct{}) {
+	var keys [][32]byte
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		keys = nextSessionTicketKeys(keys)
+		c.SetSessionTicketKeys(keys)
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Certificate
+// ----------------------------------------------------------------------
+
+/*
+Load - This method will load the certificate, the private key, and the OCSP
+response from their files. The certificate that is in use is only replaced if
+all of them can be loaded.
+*/
+func (c *Certificate) Load() error {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	if c.OCSPFile != "" {
+		staple, err := ioutil.ReadFile(c.OCSPFile)
+		if err != nil {
+			return err
+		}
+		cert.OCSPStaple = staple
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	return nil
+}
+
+/*
+GetCertificate - This method will return the certificate that is in use. It is
+used as the GetCertificate function of a tls.Config.
+*/
+func (c *Certificate) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+tls12 - This function will return true if the cipher suite can be used with
+TLS 1.2. The cipher suites of TLS 1.3 can not be configured.
+*/
+func tls12(v *tls.CipherSuite) bool {
+	for _, version := range v.SupportedVersions {
+		if version == tls.VersionTLS12 {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+allowed - This function will return true if the TLS 1.2 cipher suite uses ECDHE
+key exchange and an AEAD cipher, AES-GCM or ChaCha20-Poly1305.
+*/
+func allowed(v *tls.CipherSuite) bool {
+	if v.Insecure == true || tls12(v) == false || strings.HasPrefix(v.Name, "TLS_ECDHE_") == false {
+		return false
+	}
+	return strings.Contains(v.Name, "_GCM_") || strings.Contains(v.Name, "_CHACHA20_POLY1305")
+}
+
+/*
+nextSessionTicketKeys - This function will return a new random session ticket
+key followed by the newest of the previous keys.
+*/
+func nextSessionTicketKeys(previous [][32]byte) [][32]byte {
+	var key [32]byte
+	rand.Read(key[:])
+
+	keys := [][32]byte{key}
+	if len(previous) > 0 {
+		keys = append(keys, previous[0])
+	}
+	return keys
+}
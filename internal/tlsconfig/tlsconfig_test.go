@@ -0,0 +1,145 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// ----------------------------------------------------------------------
+func Test_Names(t *testing.T) {
+	if v, found := Version("TLS1.3"); !found || v != tls.VersionTLS13 {
+		t.Error("TLS1.3 was not found")
+	}
+	if _, found := Version("1.1"); found {
+		t.Error("TLS 1.1 was allowed")
+	}
+
+	if v, err := CipherSuite("TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"); err != nil || v != tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("cipher suite was not found: %v", err)
+	}
+	if _, err := CipherSuite("TLS_RSA_WITH_RC4_128_SHA"); err != ErrInsecureCipherSuite {
+		t.Errorf("insecure cipher suite returned %v", err)
+	}
+	if _, err := CipherSuite("TLS_NOT_A_CIPHER"); err != ErrUnknownCipherSuite {
+		t.Errorf("unknown cipher suite returned %v", err)
+	}
+
+	if v, found := Curve("CurveP384"); !found || v != tls.CurveP384 {
+		t.Error("CurveP384 was not found")
+	}
+	if v, found := Curve("x25519"); !found || v != tls.X25519 {
+		t.Error("x25519 was not found")
+	}
+	if _, found := Curve("P224"); found {
+		t.Error("P224 was allowed")
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_CipherSuites(t *testing.T) {
+	var tests = []struct {
+		name string
+		err  error
+	}{
+		{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", nil},
+		{"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256", nil},
+		{"TLS_RSA_WITH_AES_128_GCM_SHA256", ErrInsecureCipherSuite},
+		{"TLS_RSA_WITH_AES_256_CBC_SHA", ErrInsecureCipherSuite},
+		{"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA", ErrInsecureCipherSuite},
+		{"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256", ErrInsecureCipherSuite},
+		{"TLS_AES_128_GCM_SHA256", ErrUnknownCipherSuite},
+	}
+
+	for _, test := range tests {
+		if _, err := CipherSuite(test.name); err != test.err {
+			t.Errorf("cipher suite %s returned %v, expected %v", test.name, err, test.err)
+		}
+	}
+
+	defaults := DefaultCipherSuites()
+	if len(defaults) != len(CipherSuiteNames()) || len(defaults) == 0 {
+		t.Errorf("default cipher suites are %v, expected %v", defaults, CipherSuiteNames())
+	}
+	for _, name := range CipherSuiteNames() {
+		if _, err := CipherSuite(name); err != nil {
+			t.Errorf("cipher suite %s can not be configured: %v", name, err)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Certificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	ocspFile := filepath.Join(dir, "server.ocsp")
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	ioutil.WriteFile(ocspFile, []byte("first"), 0600)
+
+	if _, err := NewCertificate(certFile, keyFile, filepath.Join(dir, "missing.ocsp")); err == nil {
+		t.Error("a missing OCSP file was not reported")
+	}
+
+	c, err := NewCertificate(certFile, keyFile, ocspFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, _ := c.GetCertificate(nil); string(cert.OCSPStaple) != "first" {
+		t.Errorf("wrong OCSP staple %q", cert.OCSPStaple)
+	}
+
+	// A new OCSP response is used once it is loaded, a broken key pair keeps
+	// the previous certificate
+	ioutil.WriteFile(ocspFile, []byte("second"), 0600)
+	c.Load()
+	ioutil.WriteFile(keyFile, []byte("broken"), 0600)
+	if err := c.Load(); err == nil {
+		t.Error("a broken key was loaded")
+	}
+	if cert, _ := c.GetCertificate(nil); cert == nil || string(cert.OCSPStaple) != "second" {
+		t.Error("the OCSP staple was not reloaded")
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_SessionTicketKeys(t *testing.T) {
+	first := nextSessionTicketKeys(nil)
+	second := nextSessionTicketKeys(first)
+	third := nextSessionTicketKeys(second)
+
+	if len(first) != 1 || len(second) != 2 || len(third) != 2 {
+		t.Fatalf("wrong number of keys %d %d %d", len(first), len(second), len(third))
+	}
+	if second[1] != first[0] || third[1] != second[0] || third[0] == second[0] {
+		t.Error("the keys were not rotated")
+	}
+}
@@ -0,0 +1,11 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package uuid creates the UUIDs of the STIX bundles that the server sends. A
+bundle either gets a new random UUID, or one that is derived from its content,
+so that the same content is always sent with the same bundle identifier.
+*/
+package uuid
@@ -0,0 +1,51 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package uuid
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+)
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+New - This function will return a new random (version 4) UUID.
+*/
+func New() string {
+	var u [16]byte
+	rand.Read(u[:])
+	return format(u, 4)
+}
+
+/*
+FromContent - This function will return a name based (version 5) UUID from a
+hash of the data provided, so the same data always gets the same UUID.
+*/
+func FromContent(data []byte) string {
+	sum := sha1.Sum(data)
+
+	var u [16]byte
+	copy(u[:], sum[:16])
+	return format(u, 5)
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+format - This function will set the version and variant bits of a UUID and
+return it in its string form.
+*/
+func format(u [16]byte, version byte) string {
+	u[6] = (u[6] & 0x0f) | version<<4
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
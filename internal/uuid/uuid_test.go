@@ -0,0 +1,38 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package uuid
+
+import (
+	"regexp"
+	"testing"
+)
+
+var pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-([45])[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// ----------------------------------------------------------------------
+func Test_New(t *testing.T) {
+	a, b := New(), New()
+	if m := pattern.FindStringSubmatch(a); m == nil || m[1] != "4" {
+		t.Errorf("%s is not a version 4 UUID", a)
+	}
+	if a == b {
+		t.Errorf("two random UUIDs are the same: %s", a)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_FromContent(t *testing.T) {
+	a := FromContent([]byte(`{"id": "indicator--1"}`))
+	if m := pattern.FindStringSubmatch(a); m == nil || m[1] != "5" {
+		t.Errorf("%s is not a version 5 UUID", a)
+	}
+	if FromContent([]byte(`{"id": "indicator--1"}`)) != a {
+		t.Error("the same content has different UUIDs")
+	}
+	if FromContent([]byte(`{"id": "indicator--2"}`)) == a {
+		t.Error("different content has the same UUID")
+	}
+}
@@ -0,0 +1,13 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+/*
+Package webhooks posts a notification to the webhooks of a collection when new
+objects are added to it. Each notification lists the IDs and types of the
+objects that were added and is signed with HMAC-SHA256 when the webhook has a
+secret. Failed deliveries are retried with an exponential backoff and are
+written to a dead letter log once all attempts have failed.
+*/
+package webhooks
@@ -0,0 +1,402 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/freetaxii/server/internal/config"
+	"github.com/freetaxii/server/internal/ingest"
+	"github.com/gologme/log"
+)
+
+// SignatureHeader - The HTTP header that carries the HMAC-SHA256 signature of
+// the notification body, as "sha256=" followed by the hex encoded signature.
+const SignatureHeader = "X-FreeTAXII-Signature"
+
+// queueSize - The number of deliveries that can be waiting to be sent before
+// new notifications go straight to the dead letter log.
+const queueSize = 1000
+
+// workers - The number of deliveries that are sent at the same time.
+const workers = 4
+
+// metrics - The delivery counters, these are published with the rest of the
+// server metrics.
+var metrics = expvar.NewMap("webhooks")
+
+// ----------------------------------------------------------------------
+// Define Types
+// ----------------------------------------------------------------------
+
+/*
+Notification - This type defines the JSON body that is posted to a webhook.
+*/
+type Notification struct {
+	ID           string         `json:"id"`
+	CollectionID string         `json:"collection_id"`
+	Created      string         `json:"created"`
+	Objects      []ingest.Added `json:"objects"`
+}
+
+/*
+Dispatcher - This type holds the webhooks of every collection and sends the
+notifications to them. It implements the ingest.Notifier interface.
+*/
+type Dispatcher struct {
+	Logger      *log.Logger
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     time.Duration
+	DeadLetter  io.Writer // Failed deliveries are written here as JSON, one per line
+
+	hooks   map[string][]hook // The key in the map is the collection ID
+	queue   chan *delivery
+	mu      sync.Mutex // Protects writes to the dead letter log
+	state   sync.Mutex // Protects stopped and retries
+	stopped bool
+	retries map[*delivery]*time.Timer // The deliveries that are waiting for their backoff
+}
+
+/*
+hook - This type holds a single webhook with its type filter as a set.
+*/
+type hook struct {
+	url    string
+	secret string
+	types  map[string]bool
+}
+
+/*
+delivery - This type tracks a single notification to a single webhook.
+*/
+type delivery struct {
+	hook    hook
+	id      string
+	body    []byte
+	attempt int
+}
+
+/*
+deadLetter - This type defines a record in the dead letter log.
+*/
+type deadLetter struct {
+	URL          string          `json:"url"`
+	Attempts     int             `json:"attempts"`
+	Error        string          `json:"error"`
+	Failed       string          `json:"failed"`
+	Notification json.RawMessage `json:"notification"`
+}
+
+// ----------------------------------------------------------------------
+// Public Create Functions
+// ----------------------------------------------------------------------
+
+/*
+New - This function will create a new Dispatcher for every enabled webhook in
+the collection resources of the configuration.
+*/
+func New(logger *log.Logger, c config.ServerConfig, deadLetter io.Writer) *Dispatcher {
+	var d Dispatcher
+
+	if logger == nil {
+		d.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	} else {
+		d.Logger = logger
+	}
+
+	d.Client = &http.Client{Timeout: 30 * time.Second}
+	d.MaxAttempts = c.Webhooks.MaxAttempts
+	d.Backoff = c.Webhooks.BackoffDuration
+	d.DeadLetter = deadLetter
+	d.hooks = make(map[string][]hook)
+	d.queue = make(chan *delivery, queueSize)
+	d.retries = make(map[*delivery]*time.Timer)
+
+	for _, value := range c.CollectionResources {
+		for _, w := range value.Webhooks {
+			if w.Enabled == false {
+				continue
+			}
+
+			h := hook{url: w.URL, secret: w.Secret}
+			if len(w.Types) > 0 {
+				h.types = make(map[string]bool)
+				for _, t := range w.Types {
+					h.types[t] = true
+				}
+			}
+			d.hooks[value.ID] = append(d.hooks[value.ID], h)
+		}
+	}
+	return &d
+}
+
+// ----------------------------------------------------------------------
+// Public Methods - Dispatcher
+// ----------------------------------------------------------------------
+
+/*
+Notify - This method will queue a notification for each webhook of the
+collection, with only the objects that match the type filter of the webhook.
+It does not wait for the notifications to be sent.
+*/
+func (d *Dispatcher) Notify(collectionID string, added []ingest.Added) {
+	for _, h := range d.hooks[collectionID] {
+		var n Notification
+		n.ID = newID()
+		n.CollectionID = collectionID
+		n.Created = time.Now().UTC().Format(time.RFC3339Nano)
+
+		for _, a := range added {
+			if h.types == nil || h.types[a.Type] == true {
+				n.Objects = append(n.Objects, a)
+			}
+		}
+
+		if len(n.Objects) == 0 {
+			continue
+		}
+
+		body, err := json.Marshal(n)
+		if err != nil {
+			d.Logger.Errorln("ERROR: Unable to encode webhook notification", err)
+			continue
+		}
+
+		metrics.Add("notifications", 1)
+		d.enqueue(&delivery{hook: h, id: n.ID, body: body})
+	}
+}
+
+/*
+Run - This method will send the queued notifications until the stop channel is
+closed. The deliveries that are still queued or waiting to be tried again are
+then written to the dead letter log, along with any notification that comes in
+after it has stopped.
+*/
+func (d *Dispatcher) Run(stop <-chan struct{}) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case dl := <-d.queue:
+					d.deliver(dl)
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	d.shutdown()
+}
+
+// ----------------------------------------------------------------------
+// Private Methods - Dispatcher
+// ----------------------------------------------------------------------
+
+/*
+enqueue - This method will add a delivery to the queue, or write it to the dead
+letter log if the queue is full.
+*/
+func (d *Dispatcher) enqueue(dl *delivery) {
+	d.state.Lock()
+	if d.stopped == true {
+		d.state.Unlock()
+		d.deadLetter(dl, "webhook dispatcher has stopped")
+		return
+	}
+
+	select {
+	case d.queue <- dl:
+		d.state.Unlock()
+		return
+	default:
+	}
+	d.state.Unlock()
+	d.deadLetter(dl, "delivery queue is full")
+}
+
+/*
+deliver - This method will make a single attempt to send a notification. If it
+fails it is queued again after the backoff, until the maximum number of
+attempts is reached.
+*/
+func (d *Dispatcher) deliver(dl *delivery) {
+	dl.attempt++
+
+	err := d.post(dl)
+	if err == nil {
+		d.Logger.Debugln("DEBUG: Delivered webhook notification", dl.id, "to", dl.hook.url)
+		metrics.Add("delivered", 1)
+		return
+	}
+
+	d.Logger.Warnln("WARN: Webhook notification", dl.id, "to", dl.hook.url, "failed attempt", dl.attempt, "of", d.MaxAttempts, err)
+
+	if dl.attempt >= d.MaxAttempts {
+		d.deadLetter(dl, err.Error())
+		return
+	}
+
+	metrics.Add("retries", 1)
+	d.retry(dl, d.Backoff<<uint(dl.attempt-1))
+}
+
+/*
+retry - This method will queue a delivery again after the wait. The delivery is
+tracked until then, so that it is not lost if the dispatcher stops first.
+*/
+func (d *Dispatcher) retry(dl *delivery, wait time.Duration) {
+	d.state.Lock()
+	if d.stopped == true {
+		d.state.Unlock()
+		d.deadLetter(dl, "webhook dispatcher has stopped")
+		return
+	}
+
+	d.retries[dl] = time.AfterFunc(wait, func() {
+		d.state.Lock()
+		delete(d.retries, dl)
+		d.state.Unlock()
+		d.enqueue(dl)
+	})
+	d.state.Unlock()
+}
+
+/*
+shutdown - This method will stop the dispatcher and write every delivery that
+is still queued or waiting to be tried again to the dead letter log.
+*/
+func (d *Dispatcher) shutdown() {
+	var pending []*delivery
+
+	d.state.Lock()
+	d.stopped = true
+	for dl, t := range d.retries {
+		// A timer that already fired queues its delivery, which then goes to
+		// the dead letter log since the dispatcher has stopped
+		if t.Stop() == true {
+			pending = append(pending, dl)
+		}
+	}
+	d.retries = make(map[*delivery]*time.Timer)
+	d.state.Unlock()
+
+	for done := false; done == false; {
+		select {
+		case dl := <-d.queue:
+			pending = append(pending, dl)
+		default:
+			done = true
+		}
+	}
+
+	for _, dl := range pending {
+		d.deadLetter(dl, "webhook dispatcher stopped before the notification was delivered")
+	}
+}
+
+/*
+post - This method will post a notification to a webhook and return an error
+if the webhook did not accept it.
+*/
+func (d *Dispatcher) post(dl *delivery) error {
+	req, err := http.NewRequest("POST", dl.hook.url, bytes.NewReader(dl.body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-FreeTAXII-Delivery", dl.id)
+	req.Header.Set("X-FreeTAXII-Attempt", strconv.Itoa(dl.attempt))
+	if dl.hook.secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(dl.hook.secret, dl.body))
+	}
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+/*
+deadLetter - This method will record a notification that could not be
+delivered.
+*/
+func (d *Dispatcher) deadLetter(dl *delivery, reason string) {
+	d.Logger.Errorln("ERROR: Giving up on webhook notification", dl.id, "to", dl.hook.url, reason)
+	metrics.Add("deadletter", 1)
+
+	if d.DeadLetter == nil {
+		return
+	}
+
+	record := deadLetter{
+		URL:          dl.hook.url,
+		Attempts:     dl.attempt,
+		Error:        reason,
+		Failed:       time.Now().UTC().Format(time.RFC3339Nano),
+		Notification: dl.body,
+	}
+	data, _ := json.Marshal(record)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.DeadLetter.Write(append(data, '\n'))
+}
+
+// ----------------------------------------------------------------------
+// Public Functions
+// ----------------------------------------------------------------------
+
+/*
+Sign - This function will return the hex encoded HMAC-SHA256 of a body, so that
+a webhook can verify that a notification came from this server.
+*/
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ----------------------------------------------------------------------
+// Private Functions
+// ----------------------------------------------------------------------
+
+/*
+newID - This function will return a new random identifier for a notification.
+*/
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,181 @@
+// Copyright 2015-2018 Bret Jordan, All rights reserved.
+//
+// Use of this source code is governed by an Apache 2.0 license
+// that can be found in the LICENSE file in the root of the source tree.
+
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freetaxii/libstix2/resources/collections"
+	"github.com/freetaxii/server/internal/config"
+	"github.com/freetaxii/server/internal/ingest"
+	"github.com/freetaxii/server/internal/storetest"
+)
+
+// testConfig - This function returns a configuration with a single webhook on
+// collection 1234 that only wants indicators.
+func testConfig(url string) config.ServerConfig {
+	var c config.ServerConfig
+	c.Webhooks.MaxAttempts = 3
+	c.Webhooks.BackoffDuration = time.Millisecond
+
+	var r config.CollectionResource
+	r.Collection = collections.Collection{ID: "1234"}
+	r.Webhooks = []config.Webhook{{Enabled: true, URL: url, Secret: "secret", Types: []string{"indicator"}}}
+	c.CollectionResources = map[string]config.CollectionResource{"collection--1": r}
+	return c
+}
+
+// ----------------------------------------------------------------------
+func Test_Notify(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []Notification
+	calls := 0
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+
+		// Fail the first attempt so that the retry is exercised
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != "sha256="+Sign("secret", body) {
+			t.Errorf("wrong signature: %s", r.Header.Get(SignatureHeader))
+		}
+
+		var n Notification
+		if err := json.Unmarshal(body, &n); err != nil {
+			t.Errorf("unable to decode notification: %v", err)
+		}
+		bodies = append(bodies, n)
+	}))
+	defer ts.Close()
+
+	d := New(storetest.Logger(), testConfig(ts.URL), nil)
+	stop := make(chan struct{})
+	defer close(stop)
+	go d.Run(stop)
+
+	d.Notify("1234", []ingest.Added{
+		{ID: "indicator--1", Type: "indicator"},
+		{ID: "malware--1", Type: "malware"},
+	})
+	// Nothing matches the type filter so nothing should be sent
+	d.Notify("1234", []ingest.Added{{ID: "malware--2", Type: "malware"}})
+	// No webhooks on this collection
+	d.Notify("5678", []ingest.Added{{ID: "indicator--2", Type: "indicator"}})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		done := len(bodies) > 0
+		mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(bodies) != 1 || calls != 2 {
+		t.Fatalf("wrong number of deliveries: got %d in %d calls want 1 in 2", len(bodies), calls)
+	}
+
+	n := bodies[0]
+	if n.CollectionID != "1234" || len(n.Objects) != 1 || n.Objects[0].ID != "indicator--1" {
+		t.Errorf("wrong notification sent: %+v", n)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_DeadLetter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	var out bytes.Buffer
+	d := New(storetest.Logger(), testConfig(ts.URL), &out)
+
+	// Deliver by hand so the test does not depend on the retry timers
+	d.Notify("1234", []ingest.Added{{ID: "indicator--1", Type: "indicator"}})
+	dl := <-d.queue
+	for i := 0; i < d.MaxAttempts; i++ {
+		d.deliver(dl)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("wrong number of dead letter records: got %d want 1", len(lines))
+	}
+
+	var record deadLetter
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("unable to decode dead letter record: %v", err)
+	}
+	if record.Attempts != 3 || record.URL != ts.URL {
+		t.Errorf("wrong dead letter record: %+v", record)
+	}
+}
+
+// ----------------------------------------------------------------------
+func Test_Shutdown(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	var out bytes.Buffer
+	d := New(storetest.Logger(), testConfig(ts.URL), &out)
+	d.Backoff = time.Hour
+
+	// One delivery is waiting for its backoff and one is still queued when
+	// the dispatcher stops
+	d.Notify("1234", []ingest.Added{{ID: "indicator--1", Type: "indicator"}})
+	d.deliver(<-d.queue)
+	d.Notify("1234", []ingest.Added{{ID: "indicator--2", Type: "indicator"}})
+
+	stop := make(chan struct{})
+	close(stop)
+	d.Run(stop)
+
+	// A notification that comes in after it stopped is not lost either
+	d.Notify("1234", []ingest.Added{{ID: "indicator--3", Type: "indicator"}})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("wrong number of dead letter records: got %d want 3", len(lines))
+	}
+	for _, line := range lines {
+		var record deadLetter
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("unable to decode dead letter record: %v", err)
+		}
+		if record.URL != ts.URL {
+			t.Errorf("wrong dead letter record: %+v", record)
+		}
+	}
+}